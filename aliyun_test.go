@@ -1,12 +1,20 @@
 package tests
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	openapi "github.com/alibabacloud-go/darabonba-openapi/client"
 	"github.com/alibabacloud-go/dm-20151123/client"
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+
+	"tests/credentials"
+	"tests/mail"
+	"tests/sms"
+	"tests/storage"
 )
 
 func TestAliyunOssUpload(t *testing.T) {
@@ -19,83 +27,161 @@ func TestAliyunOssUpload(t *testing.T) {
 		OSS_UPLOAD_FILEPATH = "./assets/a.txt"
 	)
 
-	accessKeyId := os.Getenv("ALIYUN_OSS_ACCESS_KEY_ID")
-	accessKeySecret := os.Getenv("ALIYUN_OSS_ACCESS_KEY_SECRET")
+	creds := credentials.New(credentials.Options{EnvPrefixes: []string{"ALIYUN_OSS"}})
 
-	provider, err := oss.NewEnvironmentVariableCredentialsProvider()
+	bucket, err := storage.OpenOSS(OSS_BUCKET_ENDPOINT, OSS_BUCKET_REGION, OSS_BUCKET_NAME, oss.SetCredentialsProvider(creds.OSS()))
 	if err != nil {
-		t.Fatalf("Failed to create credentials provider: %v", err)
+		t.Fatalf("Failed to open bucket: %v", err)
 	}
 
-	clientOptions := []oss.ClientOption{
-		oss.SetCredentialsProvider(&provider),
-		oss.Region(OSS_BUCKET_REGION),
-		oss.AuthVersion(oss.AuthV4),
+	err = storage.PutFile(context.Background(), bucket, OSS_OBJECT_KEY, OSS_UPLOAD_FILEPATH, nil)
+	if err != nil {
+		t.Fatalf("Failed to put object from file: %v", err)
 	}
 
-	client, err := oss.New(OSS_BUCKET_ENDPOINT, accessKeyId, accessKeySecret, clientOptions...)
+	t.Logf("%s\n", "File uploaded successfully.")
+
+}
+
+func TestAliyunOssMultipartUpload(t *testing.T) {
+
+	const (
+		OSS_BUCKET_REGION     = "cn-hongkong"
+		OSS_BUCKET_ENDPOINT   = "https://oss-cn-hongkong.aliyuncs.com"
+		OSS_BUCKET_NAME       = "a"
+		OSS_OBJECT_KEY        = "assets/3.40.0.14.hwdev"
+		OSS_UPLOAD_FILEPATH   = "./assets/3.40.0.14.hwdev"
+		OSS_UPLOAD_CHECKPOINT = "./assets/3.40.0.14.hwdev.ossckp"
+	)
+
+	creds := credentials.New(credentials.Options{EnvPrefixes: []string{"ALIYUN_OSS"}})
+
+	bucket, err := storage.OpenOSS(OSS_BUCKET_ENDPOINT, OSS_BUCKET_REGION, OSS_BUCKET_NAME, oss.SetCredentialsProvider(creds.OSS()))
 	if err != nil {
-		t.Fatalf("Failed to create OSS client: %v", err)
+		t.Fatalf("Failed to open bucket: %v", err)
 	}
 
-	bucket, err := client.Bucket(OSS_BUCKET_NAME)
+	err = bucket.UploadFile(context.Background(), OSS_OBJECT_KEY, OSS_UPLOAD_FILEPATH, &storage.MultipartOptions{
+		PartSize:    storage.DEFAULT_PART_SIZE,
+		Concurrency: 4,
+		Checkpoint:  OSS_UPLOAD_CHECKPOINT,
+		Progress: func(p storage.MultipartProgress) {
+			t.Logf("Uploaded %d/%d parts, %d/%d bytes", p.Parts, p.TotalParts, p.Bytes, p.TotalBytes)
+		},
+	})
 	if err != nil {
-		t.Fatalf("Failed to get bucket: %v", err)
+		t.Fatalf("Failed to upload the file in parts: %v", err)
 	}
+}
+
+func TestAliyunEmailSend(t *testing.T) {
+	const (
+		EMAIL_ENDPOINT      = "dm.aliyuncs.com"
+		EMAIL_ACCOUNT       = "noreply@mail.synwell.net"
+		EMAIL_TO_ADDRESS    = "a@outlook.com"
+		EMAIL_TEMPLATE      = "test"
+		EMAIL_TEMPLATE_HTML = `{{define "subject"}}Test Email{{end}}<h1>Test Email</h1><p>Sent at {{.}}</p>`
+	)
+	creds := credentials.New(credentials.Options{EnvPrefixes: []string{"ALIYUN_EMAIL"}})
 
-	err = bucket.PutObjectFromFile(OSS_OBJECT_KEY, OSS_UPLOAD_FILEPATH)
+	endpoint := EMAIL_ENDPOINT
+
+	c, err := client.NewClient(&openapi.Config{
+		Credential: creds.OpenAPI(),
+		Endpoint:   &endpoint,
+	})
 	if err != nil {
-		t.Fatalf("Failed to put object from file: %v", err)
+		t.Fatalf("Failed to create email client: %v", err)
 	}
 
-	t.Logf("%s\n", "File uploaded successfully.")
+	templates := mail.NewTemplates()
+	if err := templates.AddHTML(EMAIL_TEMPLATE, "", EMAIL_TEMPLATE_HTML); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	service := &mail.Service{
+		Provider:  &mail.DirectMail{Client: c, AccountName: EMAIL_ACCOUNT},
+		Templates: templates,
+	}
+
+	receipt, err := service.Send(context.Background(), &mail.Mail{
+		Template: EMAIL_TEMPLATE,
+		To:       []string{EMAIL_TO_ADDRESS},
+		Data:     time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
 
+	t.Logf("Email sent successfully: %+v\n", receipt)
 }
 
-func TestAliyunEmailSend(t *testing.T) {
+func TestAliyunEmailReports(t *testing.T) {
 	const (
-		EMAIL_ENDPOINT          = "dm.aliyuncs.com"
-		EMAIL_ACCOUNT           = "noreply@mail.synwell.net"
-		EMAIL_ADDRESS_TYPE      = 1
-		EMAIL_REPLAY_TO_ADDRESS = false
-		EMAIL_TO_ADDRESS        = "a@outlook.com"
-		EMAIL_SUBJECT           = "Test Email"
-		EMAIL_HTML_BODY         = "<h1>Test Email</h1>"
+		EMAIL_ENDPOINT = "dm.aliyuncs.com"
+		EMAIL_ACCOUNT  = "noreply@mail.synwell.net"
+		EMAIL_LOOKBACK = 24 * time.Hour
 	)
-	accessKeyId := os.Getenv("ALIYUN_EMAIL_ACCESS_KEY_ID")
-	accessKeySecret := os.Getenv("ALIYUN_EMAIL_ACCESS_KEY_SECRET")
+	ctx := context.Background()
+	creds := credentials.New(credentials.Options{EnvPrefixes: []string{"ALIYUN_EMAIL"}})
 
 	endpoint := EMAIL_ENDPOINT
 
 	c, err := client.NewClient(&openapi.Config{
-		AccessKeyId:     &accessKeyId,
-		AccessKeySecret: &accessKeySecret,
-		Endpoint:        &endpoint,
+		Credential: creds.OpenAPI(),
+		Endpoint:   &endpoint,
 	})
 	if err != nil {
 		t.Fatalf("Failed to create email client: %v", err)
 	}
 
-	accountName := EMAIL_ACCOUNT
-	addressType := int32(EMAIL_ADDRESS_TYPE)
-	replyToAddress := EMAIL_REPLAY_TO_ADDRESS
-	toAddress := EMAIL_TO_ADDRESS
-	subject := EMAIL_SUBJECT
-	htmlBody := EMAIL_HTML_BODY
-
-	singleSendMailRequest := &client.SingleSendMailRequest{
-		AccountName:    &accountName,
-		AddressType:    &addressType,
-		ReplyToAddress: &replyToAddress,
-		ToAddress:      &toAddress,
-		Subject:        &subject,
-		HtmlBody:       &htmlBody,
+	tracker, err := mail.OpenTracker(ctx, filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("Failed to open the tracker: %v", err)
 	}
+	defer tracker.Close()
 
-	resp, err := c.SingleSendMail(singleSendMailRequest)
+	reports := &mail.DirectMailReports{Client: c, AccountName: EMAIL_ACCOUNT}
+	events, err := reports.Events(ctx, time.Now().Add(-EMAIL_LOOKBACK), time.Now())
 	if err != nil {
-		t.Fatalf("Failed to send email: %v", err)
+		t.Fatalf("Failed to fetch reports: %v", err)
+	}
+	if err := tracker.Ingest(ctx, events...); err != nil {
+		t.Fatalf("Failed to ingest reports: %v", err)
+	}
+
+	for _, e := range events {
+		t.Logf("%s %s %s %s\n", e.Time.Format(time.RFC3339), e.Address, e.Status, e.Detail)
+	}
+}
+
+func TestAliyunSmsNotify(t *testing.T) {
+	const (
+		SMS_SIGN_NAME         = "Synwell"
+		SMS_TEMPLATE          = "test"
+		SMS_TEMPLATE_CODE     = "SMS_154950909"
+		SMS_SEND_COUNTRY_CODE = "86"
+	)
+	creds := credentials.New(credentials.Options{EnvPrefixes: []string{"ALIYUN_SMS"}})
+
+	router := &sms.Router{Routes: []sms.Route{
+		{Provider: &sms.Aliyun{
+			Credentials: creds,
+			SignName:    SMS_SIGN_NAME,
+			Templates:   map[string]string{SMS_TEMPLATE: SMS_TEMPLATE_CODE},
+		}, Weight: 1},
+		{Provider: &sms.Mob{AppKey: os.Getenv("MOB_APP_KEY")}, Weight: 1},
+	}}
+
+	receipt, err := router.Notify(context.Background(), &sms.Notification{
+		Zone:     SMS_SEND_COUNTRY_CODE,
+		Phone:    os.Getenv("ALIYUN_SMS_PHONE"),
+		Template: SMS_TEMPLATE,
+		Params:   map[string]string{"code": "1234"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send SMS: %v", err)
 	}
 
-	t.Logf("Email sent successfully: %v\n", resp)
+	t.Logf("SMS sent successfully: %+v\n", receipt)
 }
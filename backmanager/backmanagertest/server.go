@@ -0,0 +1,362 @@
+// Package backmanagertest provides an in-process fake of a Haiwell HMI's
+// back-management service, so project transfers can be tested without a
+// panel on the network. Its download endpoint follows the client's
+// unverified assumptions about that direction (see
+// backmanager.DOWNLOAD_PROJECT_PATH) rather than a real panel.
+package backmanagertest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"tests/backmanager"
+)
+
+// DEFAULT_PASSWORD is the project password a new Server expects.
+const DEFAULT_PASSWORD = "b51b74011735cf017faeda4520932bab"
+
+// Server is a fake HMI serving the update and uonline endpoints on one
+// port. It serves its project in whatever cutsize the client asks for and
+// accepts pushed projects whose MD5 checks out.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	project  []byte
+	info     map[string]any
+	password string
+	signSalt string
+	signed   bool
+	delay    time.Duration
+
+	failures        map[int]int
+	truncations     map[int]int
+	received        map[int][]byte
+	ignoreDownloads bool
+
+	requests    []int
+	inflight    int
+	maxInflight int
+}
+
+// NewServer starts a fake HMI with an empty project that permits both
+// transfer directions.
+func NewServer() *Server {
+	s := &Server{
+		password: DEFAULT_PASSWORD,
+		info: map[string]any{
+			backmanager.FIELD_LOAD_PWD_STATE:      1,
+			backmanager.FIELD_UPLOAD_PRJ_PERMIT:   1,
+			backmanager.FIELD_DOWNLOAD_PRJ_PERMIT: 1,
+		},
+		failures:    make(map[int]int),
+		truncations: make(map[int]int),
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// NewServerFromFile starts a fake HMI serving the project file at path.
+func NewServerFromFile(path string) (*Server, error) {
+	project, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewServer()
+	s.SetProject(project)
+	return s, nil
+}
+
+// Client returns a client for the server with the expected password.
+func (s *Server) Client() *backmanager.Client {
+	u, _ := url.Parse(s.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	p, _ := strconv.Atoi(port)
+
+	client := backmanager.NewClient(host)
+	client.UpdatePort = p
+	client.UonlinePort = p
+	client.Password = s.Password()
+	return client
+}
+
+// Port is the single port both services listen on.
+func (s *Server) Port() int {
+	u, _ := url.Parse(s.URL)
+	_, port, _ := net.SplitHostPort(u.Host)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+func (s *Server) Project() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.project
+}
+
+func (s *Server) SetProject(project []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.project = project
+}
+
+// MD5 is the hex MD5 the server reports for its current project.
+func (s *Server) MD5() string {
+	sum := md5.Sum(s.Project())
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) Password() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.password
+}
+
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// SetInfo sets a getHmiInfo field, e.g. to add a model or to deny a
+// transfer by setting uploadPrjPermit to 0. A nil value removes the field.
+func (s *Server) SetInfo(field string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if value == nil {
+		delete(s.info, field)
+		return
+	}
+	s.info[field] = value
+}
+
+// RequireSign rejects requests whose sign does not match salt with 401.
+// An empty salt checks unsalted signs.
+func (s *Server) RequireSign(salt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signSalt = salt
+	s.signed = true
+}
+
+// SetDelay slows every response down by d.
+func (s *Server) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// FailChunk makes the next n requests for chunk index answer 500.
+func (s *Server) FailChunk(index, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[index] = n
+}
+
+// TruncateChunk makes the next n requests for chunk index return half of
+// its data.
+func (s *Server) TruncateChunk(index, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truncations[index] = n
+}
+
+// IgnoreDownloads acknowledges pushed chunks but keeps the old project, as
+// a panel that silently drops a project would.
+func (s *Server) IgnoreDownloads(ignore bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ignoreDownloads = ignore
+}
+
+// Requests lists the chunk indexes requested or pushed so far, in order.
+func (s *Server) Requests() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.requests...)
+}
+
+// ResetRequests clears the request log and the failure plans.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+	s.maxInflight = 0
+	clear(s.failures)
+	clear(s.truncations)
+}
+
+// MaxInflight is the most chunk requests served at once so far.
+func (s *Server) MaxInflight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInflight
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if r.URL.Path == backmanager.DOWNLOAD_PROJECT_PATH {
+		err = r.ParseMultipartForm(32 << 20)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	delay, salt, signed := s.delay, s.signSalt, s.signed
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+
+	if signed && r.Form.Get(backmanager.FIELD_SIGN) != backmanager.Sign(r.Form, salt) {
+		http.Error(w, "bad sign", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case backmanager.GET_HMI_INFO_PATH:
+		s.mu.Lock()
+		data, _ := json.Marshal(s.info)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case backmanager.GET_FILE_COUNT_PATH:
+		s.serveFileCount(w, r)
+	case backmanager.UPLOAD_PROJECT_PATH:
+		s.serveUpload(w, r)
+	case backmanager.DOWNLOAD_PROJECT_PATH:
+		s.serveDownload(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveFileCount(w http.ResponseWriter, r *http.Request) {
+	cutSize, err := strconv.Atoi(r.Form.Get(backmanager.FIELD_CUTSIZE))
+	if err != nil || cutSize <= 0 {
+		http.Error(w, "bad cutsize", http.StatusBadRequest)
+		return
+	}
+
+	project := s.Project()
+	sum := md5.Sum(project)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		backmanager.FIELD_CUTSIZE:    cutSize,
+		backmanager.FIELD_FILE_TYPE:  r.Form.Get(backmanager.FIELD_FILE_TYPE),
+		backmanager.FIELD_FILE_COUNT: (len(project) + cutSize - 1) / cutSize,
+		backmanager.FIELD_MD5:        hex.EncodeToString(sum[:]),
+	})
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request) {
+	cutSize, _ := strconv.Atoi(r.Form.Get(backmanager.FIELD_CUT_SIZE))
+	index, _ := strconv.Atoi(r.Form.Get(backmanager.FIELD_INDEX))
+	if cutSize <= 0 || index < 0 {
+		http.Error(w, "bad chunk", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, index)
+	s.inflight++
+	s.maxInflight = max(s.maxInflight, s.inflight)
+	s.mu.Unlock()
+
+	// Hold the request open briefly so that concurrent fetches overlap.
+	time.Sleep(time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inflight--
+
+	if r.Form.Get(backmanager.FIELD_PASSWORD) != s.password {
+		http.Error(w, "wrong password", http.StatusForbidden)
+		return
+	}
+	if s.failures[index] > 0 {
+		s.failures[index]--
+		http.Error(w, "busy", http.StatusInternalServerError)
+		return
+	}
+
+	start := min(index*cutSize, len(s.project))
+	data := s.project[start:min(start+cutSize, len(s.project))]
+	if s.truncations[index] > 0 {
+		s.truncations[index]--
+		data = data[:len(data)/2]
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request) {
+	index, _ := strconv.Atoi(r.FormValue(backmanager.FIELD_INDEX))
+	fileCount, _ := strconv.Atoi(r.FormValue(backmanager.FIELD_FILE_COUNT))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, index)
+
+	if r.FormValue(backmanager.FIELD_PASSWORD) != s.password {
+		writeResult(w, 0, "wrong password")
+		return
+	}
+
+	file, _, err := r.FormFile(backmanager.FIELD_FILE)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.received == nil {
+		s.received = make(map[int][]byte)
+	}
+	s.received[index] = data
+
+	if len(s.received) == fileCount {
+		var project []byte
+		for i := range fileCount {
+			project = append(project, s.received[i]...)
+		}
+		s.received = nil
+
+		sum := md5.Sum(project)
+		if hex.EncodeToString(sum[:]) != r.FormValue(backmanager.FIELD_MD5) {
+			writeResult(w, 0, "md5 mismatch")
+			return
+		}
+		if !s.ignoreDownloads {
+			s.project = project
+		}
+	}
+
+	writeResult(w, 1, "")
+}
+
+func writeResult(w http.ResponseWriter, result int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{backmanager.FIELD_RESULT: result, backmanager.FIELD_MSG: msg})
+}
@@ -0,0 +1,135 @@
+package backmanagertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tests/backmanager"
+)
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	project := bytes.Repeat([]byte("haiwell"), 1000)
+
+	projectPath := filepath.Join(t.TempDir(), "project.hwdev")
+	if err := os.WriteFile(projectPath, project, 0o644); err != nil {
+		t.Fatalf("Failed to write the project: %v", err)
+	}
+
+	server, err := NewServerFromFile(projectPath)
+	if err != nil {
+		t.Fatalf("Failed to start the server: %v", err)
+	}
+	defer server.Close()
+	client := server.Client()
+
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+	if count.FileCount != 7 || count.MD5 != server.MD5() {
+		t.Fatalf("Unexpected file count %+v", count)
+	}
+
+	path := filepath.Join(t.TempDir(), "saved.hwdev")
+	if err := client.SaveProject(ctx, path, count, &backmanager.UploadOptions{Backoff: time.Millisecond}); err != nil {
+		t.Fatalf("Failed to save the project: %v", err)
+	}
+	if saved, _ := os.ReadFile(path); !bytes.Equal(saved, project) {
+		t.Fatalf("Saved project does not match")
+	}
+
+	pushed := []byte("new project")
+	pushedPath := filepath.Join(t.TempDir(), "pushed.hwdev")
+	os.WriteFile(pushedPath, pushed, 0o644)
+	if err := client.DownloadProject(ctx, pushedPath, &backmanager.DownloadOptions{CutSize: 4}); err != nil {
+		t.Fatalf("Failed to download the project: %v", err)
+	}
+	if !bytes.Equal(server.Project(), pushed) {
+		t.Errorf("Server project = %q, want %q", server.Project(), pushed)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	ctx := context.Background()
+	opts := &backmanager.UploadOptions{Retries: 2, Backoff: time.Millisecond}
+
+	newServer := func(t *testing.T) *Server {
+		server := NewServer()
+		t.Cleanup(server.Close)
+		server.SetProject(bytes.Repeat([]byte{7}, 100))
+		return server
+	}
+	save := func(client *backmanager.Client) error {
+		count, err := client.GetFileCount(ctx, 10)
+		if err != nil {
+			return err
+		}
+		return client.SaveProject(ctx, filepath.Join(t.TempDir(), "project.hwdev"), count, opts)
+	}
+
+	t.Run("Permission denied", func(t *testing.T) {
+		server := newServer(t)
+		server.SetInfo(backmanager.FIELD_UPLOAD_PRJ_PERMIT, 0)
+
+		info, err := server.Client().GetHmiInfo(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get the HMI info: %v", err)
+		}
+		if err := info.CheckUploadPermission(); !errors.Is(err, backmanager.ErrUploadNotPermitted) {
+			t.Errorf("got %v, want ErrUploadNotPermitted", err)
+		}
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		server := newServer(t)
+		client := server.Client()
+		client.Password = "wrong"
+
+		var status *backmanager.StatusError
+		if err := save(client); !errors.As(err, &status) || status.StatusCode != 403 {
+			t.Errorf("got %v, want a 403 status error", err)
+		}
+		if len(server.Requests()) != 1 {
+			t.Errorf("A rejected password should not be retried, got %v", server.Requests())
+		}
+	})
+
+	t.Run("Truncated chunk", func(t *testing.T) {
+		server := newServer(t)
+		server.TruncateChunk(3, 1)
+
+		if err := save(server.Client()); err != nil {
+			t.Fatalf("Failed to save with a truncated chunk: %v", err)
+		}
+		if requests := server.Requests(); len(requests) != 11 {
+			t.Errorf("Expected one retry, got requests %v", requests)
+		}
+	})
+
+	t.Run("Failing chunk", func(t *testing.T) {
+		server := newServer(t)
+		server.FailChunk(0, 10)
+
+		var status *backmanager.StatusError
+		if err := save(server.Client()); !errors.As(err, &status) || status.StatusCode != 500 {
+			t.Errorf("got %v, want a 500 status error", err)
+		}
+	})
+
+	t.Run("Slow responses", func(t *testing.T) {
+		server := newServer(t)
+		server.SetDelay(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if _, err := server.Client().GetHmiInfo(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
@@ -0,0 +1,391 @@
+// Package backmanager talks to the back-management service of Haiwell HMI
+// panels. The update service on port 81 reports panel state, the uonline
+// service on port 82 transfers project files in fixed-size chunks.
+//
+// Haiwell names transfers from the panel's point of view: uploading a
+// project copies it from the HMI to the PC, downloading copies it from the
+// PC to the HMI.
+package backmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	DEFAULT_SCHEME       = "http"
+	DEFAULT_UPDATE_PORT  = 81
+	DEFAULT_UONLINE_PORT = 82
+
+	GET_HMI_INFO_PATH   = "/update/getHmiInfo"
+	GET_FILE_COUNT_PATH = "/uonline/getFileCount/"
+	UPLOAD_PROJECT_PATH = "/uonline/uploadProject/"
+
+	FILE_TYPE_PROJECT = "project"
+	DEFAULT_CUT_SIZE  = 512 * 1024
+
+	FIELD_LOAD_PWD_STATE    = "loadPwdState"
+	FIELD_UPLOAD_PRJ_PERMIT = "uploadPrjPermit"
+	FIELD_CUTSIZE           = "cutsize"
+	FIELD_FILE_TYPE         = "fileType"
+	FIELD_FILE_COUNT        = "fileCount"
+	FIELD_MD5               = "md5"
+	FIELD_CUT_SIZE          = "cutSize"
+	FIELD_INDEX             = "index"
+	FIELD_PASSWORD          = "password"
+)
+
+// The download direction is not documented by Haiwell and has not been
+// checked against a panel: the path, the permission field, the multipart
+// file field and the JSON acknowledgement below are assumptions modelled on
+// the upload flow. backmanagertest implements the same assumptions, so its
+// tests only show that the client agrees with them.
+const (
+	DOWNLOAD_PROJECT_PATH = "/uonline/downloadProject/"
+
+	FIELD_DOWNLOAD_PRJ_PERMIT = "downloadPrjPermit"
+	FIELD_FILE                = "file"
+	FIELD_RESULT              = "result"
+	FIELD_MSG                 = "msg"
+)
+
+var (
+	ErrUploadNotPermitted   = errors.New("backmanager: project upload is not permitted")
+	ErrDownloadNotPermitted = errors.New("backmanager: project download is not permitted")
+	ErrInvalidResponse      = errors.New("backmanager: invalid response")
+	ErrChunkSize            = errors.New("backmanager: unexpected chunk size")
+)
+
+// StatusError is returned when the HMI answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("backmanager: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// Client talks to a single HMI. The zero ports fall back to the defaults.
+type Client struct {
+	Scheme      string
+	Host        string
+	UpdatePort  int
+	UonlinePort int
+
+	// Password is the project password, sent as-is with every chunk
+	// request. HashPassword turns a clear-text password into this form.
+	Password string
+
+	// Signer signs the parameters of every request. NewClient installs
+	// DefaultSigner; set it to nil for panels that reject unknown
+	// parameters.
+	Signer *Signer
+
+	HTTPClient *http.Client
+}
+
+func NewClient(host string) *Client {
+	return &Client{
+		Scheme:      DEFAULT_SCHEME,
+		Host:        host,
+		UpdatePort:  DEFAULT_UPDATE_PORT,
+		UonlinePort: DEFAULT_UONLINE_PORT,
+		Signer:      DefaultSigner(),
+	}
+}
+
+// HmiInfo is the panel state reported by /update/getHmiInfo. Fields holds
+// the full response, including fields this package does not interpret.
+type HmiInfo struct {
+	LoadPwdState      int
+	UploadPrjPermit   int
+	DownloadPrjPermit int
+	Fields            map[string]json.RawMessage
+}
+
+func (i *HmiInfo) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &i.Fields); err != nil {
+		return err
+	}
+
+	var err error
+	if i.LoadPwdState, err = intField(i.Fields, FIELD_LOAD_PWD_STATE); err != nil {
+		return err
+	}
+	if i.UploadPrjPermit, err = intField(i.Fields, FIELD_UPLOAD_PRJ_PERMIT); err != nil {
+		return err
+	}
+	// Only firmware that accepts projects over the network reports this.
+	if _, ok := i.Fields[FIELD_DOWNLOAD_PRJ_PERMIT]; ok {
+		if i.DownloadPrjPermit, err = intField(i.Fields, FIELD_DOWNLOAD_PRJ_PERMIT); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckUploadPermission reports whether the panel allows its project to be
+// copied off, returning ErrUploadNotPermitted otherwise.
+func (i *HmiInfo) CheckUploadPermission() error {
+	if i.LoadPwdState != 1 || i.UploadPrjPermit != 1 {
+		return fmt.Errorf("%w: %s=%d %s=%d", ErrUploadNotPermitted,
+			FIELD_LOAD_PWD_STATE, i.LoadPwdState, FIELD_UPLOAD_PRJ_PERMIT, i.UploadPrjPermit)
+	}
+	return nil
+}
+
+// CheckDownloadPermission reports whether the panel accepts a project pushed
+// from the PC, returning ErrDownloadNotPermitted otherwise. The permission
+// field is an unverified assumption, see FIELD_DOWNLOAD_PRJ_PERMIT.
+func (i *HmiInfo) CheckDownloadPermission() error {
+	if i.LoadPwdState != 1 || i.DownloadPrjPermit != 1 {
+		return fmt.Errorf("%w: %s=%d %s=%d", ErrDownloadNotPermitted,
+			FIELD_LOAD_PWD_STATE, i.LoadPwdState, FIELD_DOWNLOAD_PRJ_PERMIT, i.DownloadPrjPermit)
+	}
+	return nil
+}
+
+// FileCount describes how a project is split into chunks for transfer.
+type FileCount struct {
+	CutSize   int64
+	FileType  string
+	FileCount int
+	MD5       string
+}
+
+func (c *FileCount) UnmarshalJSON(data []byte) error {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	cutSize, err := intField(fields, FIELD_CUTSIZE)
+	if err != nil {
+		return err
+	}
+	count, err := intField(fields, FIELD_FILE_COUNT)
+	if err != nil {
+		return err
+	}
+	fileType, err := stringField(fields, FIELD_FILE_TYPE)
+	if err != nil {
+		return err
+	}
+	md5, err := stringField(fields, FIELD_MD5)
+	if err != nil {
+		return err
+	}
+
+	*c = FileCount{CutSize: int64(cutSize), FileType: fileType, FileCount: count, MD5: md5}
+	return nil
+}
+
+// Chunk is one piece of a project file.
+type Chunk struct {
+	Index int
+	Data  []byte
+}
+
+func (c *Client) GetHmiInfo(ctx context.Context) (*HmiInfo, error) {
+	info := new(HmiInfo)
+	if err := c.postJSON(ctx, c.updateURL(GET_HMI_INFO_PATH), nil, info); err != nil {
+		return nil, fmt.Errorf("get HMI info: %w", err)
+	}
+	return info, nil
+}
+
+// GetFileCount asks the HMI to split its project into cutSize chunks.
+func (c *Client) GetFileCount(ctx context.Context, cutSize int64) (*FileCount, error) {
+	count := new(FileCount)
+	if err := c.postJSON(ctx, c.uonlineURL(GET_FILE_COUNT_PATH), fileCountValues(cutSize), count); err != nil {
+		return nil, fmt.Errorf("get file count: %w", err)
+	}
+	if count.FileCount < 0 || count.CutSize <= 0 {
+		return nil, fmt.Errorf("get file count: %w: %d chunks of %d bytes", ErrInvalidResponse, count.FileCount, count.CutSize)
+	}
+	return count, nil
+}
+
+// UploadProjectChunk copies chunk index of the project off the HMI. Every
+// chunk but the last is exactly cutSize bytes; longer chunks are rejected
+// with ErrChunkSize.
+func (c *Client) UploadProjectChunk(ctx context.Context, cutSize int64, index int) (*Chunk, error) {
+	values := fileCountValues(cutSize)
+	values.Set(FIELD_CUT_SIZE, strconv.FormatInt(cutSize, 10))
+	values.Set(FIELD_PASSWORD, c.Password)
+	values.Set(FIELD_INDEX, strconv.Itoa(index))
+
+	resp, err := c.post(ctx, c.uonlineURL(UPLOAD_PROJECT_PATH), values)
+	if err != nil {
+		return nil, fmt.Errorf("upload project chunk %d: %w", index, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, cutSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("upload project chunk %d: %w", index, err)
+	}
+	if int64(len(data)) > cutSize {
+		return nil, fmt.Errorf("upload project chunk %d: %w: more than %d bytes", index, ErrChunkSize, cutSize)
+	}
+
+	return &Chunk{Index: index, Data: data}, nil
+}
+
+// UploadProject copies the whole project described by count off the HMI
+// into w, one chunk at a time, without retries. SaveProject is the
+// resumable, verified variant.
+func (c *Client) UploadProject(ctx context.Context, w io.Writer, count *FileCount) error {
+	for i := range count.FileCount {
+		chunk, err := c.UploadProjectChunk(ctx, count.CutSize, i)
+		if err == nil {
+			err = checkChunk(count, chunk)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return fmt.Errorf("write project chunk %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) updateURL(path string) string {
+	return c.url(c.UpdatePort, DEFAULT_UPDATE_PORT, path)
+}
+
+func (c *Client) uonlineURL(path string) string {
+	return c.url(c.UonlinePort, DEFAULT_UONLINE_PORT, path)
+}
+
+func (c *Client) url(port, defaultPort int, path string) string {
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = DEFAULT_SCHEME
+	}
+	if port == 0 {
+		port = defaultPort
+	}
+
+	u := url.URL{Scheme: scheme, Host: net.JoinHostPort(c.Host, strconv.Itoa(port)), Path: path}
+	return u.String()
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) post(ctx context.Context, url string, values url.Values) (*http.Response, error) {
+	values = c.sign(values)
+	return c.do(ctx, url, "application/x-www-form-urlencoded", bytes.NewBufferString(values.Encode()))
+}
+
+// sign returns a signed copy of values, or values itself without a Signer.
+func (c *Client) sign(values url.Values) url.Values {
+	if c.Signer == nil {
+		return values
+	}
+
+	signed := make(url.Values, len(values)+2)
+	for key, vs := range values {
+		signed[key] = append([]string(nil), vs...)
+	}
+	c.Signer.Apply(signed)
+	return signed
+}
+
+func (c *Client) do(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) postJSON(ctx context.Context, url string, values url.Values, v any) error {
+	resp, err := c.post(ctx, url, values)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	buff, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(buff, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	return nil
+}
+
+func fileCountValues(cutSize int64) url.Values {
+	return url.Values{
+		FIELD_CUTSIZE:   {strconv.FormatInt(cutSize, 10)},
+		FIELD_FILE_TYPE: {FILE_TYPE_PROJECT},
+	}
+}
+
+// intField reads a numeric field. Panels running older firmware quote some
+// numbers, so numeric strings are accepted as well.
+func intField(fields map[string]json.RawMessage, key string) (int, error) {
+	raw, ok := fields[key]
+	if !ok {
+		return 0, fmt.Errorf("%w: missing %s", ErrInvalidResponse, key)
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrInvalidResponse, key, err)
+	}
+
+	v, err := strconv.Atoi(n.String())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrInvalidResponse, key, err)
+	}
+
+	return v, nil
+}
+
+func stringField(fields map[string]json.RawMessage, key string) (string, error) {
+	raw, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%w: missing %s", ErrInvalidResponse, key)
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidResponse, key, err)
+	}
+
+	return s, nil
+}
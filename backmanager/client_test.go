@@ -0,0 +1,132 @@
+package backmanager_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"tests/backmanager"
+	"tests/backmanager/backmanagertest"
+)
+
+// newServer starts a fake HMI serving a random project of size bytes.
+func newServer(t testing.TB, size int) (*backmanagertest.Server, []byte) {
+	t.Helper()
+
+	project := make([]byte, size)
+	rand.Read(project)
+
+	server := backmanagertest.NewServer()
+	t.Cleanup(server.Close)
+	server.SetProject(project)
+	return server, project
+}
+
+// newHandlerClient returns a client for handler, for answers the fake HMI
+// never gives.
+func newHandlerClient(t testing.TB, handler http.Handler) *backmanager.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	p, _ := strconv.Atoi(port)
+
+	client := backmanager.NewClient(host)
+	client.UpdatePort = p
+	client.UonlinePort = p
+	return client
+}
+
+func TestUploadProject(t *testing.T) {
+	server, project := newServer(t, 3*1024+100)
+	server.SetInfo(backmanager.FIELD_UPLOAD_PRJ_PERMIT, "1")
+	server.SetInfo("model", "C7S-W")
+	client := server.Client()
+	ctx := context.Background()
+
+	info, err := client.GetHmiInfo(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get the HMI info: %v", err)
+	}
+	if err := info.CheckUploadPermission(); err != nil {
+		t.Fatalf("Upload should be permitted: %v", err)
+	}
+	if string(info.Fields["model"]) != `"C7S-W"` {
+		t.Errorf("Unexpected model field %s", info.Fields["model"])
+	}
+
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+	if count.FileCount != 4 || count.CutSize != 1024 || count.FileType != backmanager.FILE_TYPE_PROJECT {
+		t.Fatalf("Unexpected file count %+v", count)
+	}
+
+	var buf bytes.Buffer
+	if err := client.UploadProject(ctx, &buf, count); err != nil {
+		t.Fatalf("Failed to upload the project: %v", err)
+	}
+	sum := md5.Sum(buf.Bytes())
+	if !bytes.Equal(buf.Bytes(), project) || hex.EncodeToString(sum[:]) != count.MD5 {
+		t.Errorf("Uploaded project does not match")
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Permission denied", func(t *testing.T) {
+		server, _ := newServer(t, 0)
+		server.SetInfo(backmanager.FIELD_UPLOAD_PRJ_PERMIT, 0)
+
+		info, err := server.Client().GetHmiInfo(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get the HMI info: %v", err)
+		}
+		if err := info.CheckUploadPermission(); !errors.Is(err, backmanager.ErrUploadNotPermitted) {
+			t.Errorf("got %v, want ErrUploadNotPermitted", err)
+		}
+	})
+
+	t.Run("Unexpected payload", func(t *testing.T) {
+		server, _ := newServer(t, 0)
+		server.SetInfo(backmanager.FIELD_LOAD_PWD_STATE, "yes")
+
+		if _, err := server.Client().GetHmiInfo(ctx); !errors.Is(err, backmanager.ErrInvalidResponse) {
+			t.Errorf("got %v, want ErrInvalidResponse", err)
+		}
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		server, _ := newServer(t, 10)
+		client := server.Client()
+		client.Password = "wrong"
+
+		var statusErr *backmanager.StatusError
+		if _, err := client.UploadProjectChunk(ctx, 1024, 0); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+			t.Errorf("got %v, want 403 StatusError", err)
+		}
+	})
+
+	t.Run("Oversized chunk", func(t *testing.T) {
+		client := newHandlerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(make([]byte, 2048))
+		}))
+		if _, err := client.UploadProjectChunk(ctx, 1024, 0); !errors.Is(err, backmanager.ErrChunkSize) {
+			t.Errorf("got %v, want ErrChunkSize", err)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package backmanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDownloadRejected    = errors.New("backmanager: HMI rejected the project chunk")
+	ErrDownloadNotAccepted = errors.New("backmanager: HMI did not accept the project")
+	ErrEmptyProject        = errors.New("backmanager: empty project file")
+)
+
+// DownloadOptions tunes DownloadProject. The zero value uses the defaults.
+type DownloadOptions struct {
+	// CutSize is the chunk size, DEFAULT_CUT_SIZE if zero.
+	CutSize int64
+	// Retries and Backoff behave as in UploadOptions.
+	Retries int
+	Backoff time.Duration
+	// Progress, if set, is called after every chunk the HMI acknowledged.
+	Progress func(Progress)
+}
+
+// DownloadProject pushes the project file at path to the HMI.
+//
+// The HMI must report download permission first. Every chunk is sent as a
+// multipart form carrying the same password field as the upload flow plus
+// the chunk index, count and whole-file MD5; the HMI acknowledges each with
+// a JSON result. Once all chunks are in, the project the HMI reports through
+// /uonline/getFileCount/ must carry the same MD5, or ErrDownloadNotAccepted
+// is returned.
+//
+// Unlike the upload flow, this protocol is an unverified assumption; see
+// DOWNLOAD_PROJECT_PATH. Try it on a panel whose project can be restored
+// before relying on it.
+func (c *Client) DownloadProject(ctx context.Context, path string, opts *DownloadOptions) error {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	cutSize := opts.CutSize
+	if cutSize <= 0 {
+		cutSize = DEFAULT_CUT_SIZE
+	}
+
+	info, err := c.GetHmiInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if err := info.CheckDownloadPermission(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size, sum, err := fileMD5(f)
+	if err != nil {
+		return fmt.Errorf("hash project: %w", err)
+	}
+	if size == 0 {
+		return fmt.Errorf("%w: %s", ErrEmptyProject, path)
+	}
+
+	count := &FileCount{
+		CutSize:   cutSize,
+		FileType:  FILE_TYPE_PROJECT,
+		FileCount: int((size + cutSize - 1) / cutSize),
+		MD5:       sum,
+	}
+
+	buf := make([]byte, cutSize)
+	var sent int64
+	for i := range count.FileCount {
+		n, err := f.ReadAt(buf, int64(i)*cutSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read project chunk %d: %w", i, err)
+		}
+
+		chunk := &Chunk{Index: i, Data: buf[:n]}
+		err = retry(ctx, opts.Retries, opts.Backoff, nil, func() error {
+			return c.DownloadProjectChunk(ctx, count, chunk)
+		})
+		if err != nil {
+			return err
+		}
+
+		sent += int64(n)
+		if opts.Progress != nil {
+			opts.Progress(Progress{Chunks: i + 1, FileCount: count.FileCount, Bytes: sent, Concurrency: 1})
+		}
+	}
+
+	current, err := c.GetFileCount(ctx, cutSize)
+	if err != nil {
+		return fmt.Errorf("confirm project: %w", err)
+	}
+	if !strings.EqualFold(current.MD5, sum) {
+		return fmt.Errorf("%w: HMI reports md5 %s, sent %s", ErrDownloadNotAccepted, current.MD5, sum)
+	}
+
+	return nil
+}
+
+// DownloadProjectChunk sends one chunk of the project described by count
+// to the HMI.
+func (c *Client) DownloadProjectChunk(ctx context.Context, count *FileCount, chunk *Chunk) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	values := c.sign(url.Values{
+		FIELD_FILE_TYPE:  {count.FileType},
+		FIELD_CUT_SIZE:   {strconv.FormatInt(count.CutSize, 10)},
+		FIELD_FILE_COUNT: {strconv.Itoa(count.FileCount)},
+		FIELD_MD5:        {count.MD5},
+		FIELD_INDEX:      {strconv.Itoa(chunk.Index)},
+		FIELD_PASSWORD:   {c.Password},
+	})
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := w.WriteField(key, values.Get(key)); err != nil {
+			return err
+		}
+	}
+
+	part, err := w.CreateFormFile(FIELD_FILE, fmt.Sprintf("%s.%d", count.MD5, chunk.Index))
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(chunk.Data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, c.uonlineURL(DOWNLOAD_PROJECT_PATH), w.FormDataContentType(), &body)
+	if err != nil {
+		return fmt.Errorf("download project chunk %d: %w", chunk.Index, err)
+	}
+	defer resp.Body.Close()
+
+	ack := make(map[string]json.RawMessage)
+	if err := json.NewDecoder(resp.Body).Decode(&ack); err != nil {
+		return fmt.Errorf("download project chunk %d: %w: %v", chunk.Index, ErrInvalidResponse, err)
+	}
+
+	result, err := intField(ack, FIELD_RESULT)
+	if err != nil {
+		return fmt.Errorf("download project chunk %d: %w", chunk.Index, err)
+	}
+	if result != 1 {
+		msg, _ := stringField(ack, FIELD_MSG)
+		return fmt.Errorf("download project chunk %d: %w: result=%d %s", chunk.Index, ErrDownloadRejected, result, msg)
+	}
+
+	return nil
+}
+
+func fileMD5(r io.Reader) (int64, string, error) {
+	h := md5.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
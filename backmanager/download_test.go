@@ -0,0 +1,110 @@
+package backmanager_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tests/backmanager"
+)
+
+func writeProject(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+
+	project := make([]byte, size)
+	rand.Read(project)
+
+	path := filepath.Join(t.TempDir(), "project.hwdev")
+	if err := os.WriteFile(path, project, 0o644); err != nil {
+		t.Fatalf("Failed to write the project: %v", err)
+	}
+	return path, project
+}
+
+func TestDownloadProject(t *testing.T) {
+	path, project := writeProject(t, 3*1024+1)
+
+	server, _ := newServer(t, 0)
+	server.SetProject([]byte("old project"))
+	client := server.Client()
+	ctx := context.Background()
+
+	var progress []backmanager.Progress
+	err := client.DownloadProject(ctx, path, &backmanager.DownloadOptions{
+		CutSize:  1024,
+		Progress: func(p backmanager.Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("Failed to download the project: %v", err)
+	}
+	if !bytes.Equal(server.Project(), project) {
+		t.Fatalf("HMI project does not match the pushed file")
+	}
+	if len(progress) != 4 || progress[3].Bytes != int64(len(project)) {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+
+	// The pushed project can be copied back off the panel.
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+	back := filepath.Join(t.TempDir(), "back.hwdev")
+	if err := client.SaveProject(ctx, back, count, nil); err != nil {
+		t.Fatalf("Failed to save the project: %v", err)
+	}
+	if saved, _ := os.ReadFile(back); !bytes.Equal(saved, project) {
+		t.Errorf("Round-tripped project does not match")
+	}
+}
+
+func TestDownloadProjectErrors(t *testing.T) {
+	ctx := context.Background()
+	path, _ := writeProject(t, 2048)
+
+	t.Run("Permission denied", func(t *testing.T) {
+		server, _ := newServer(t, 0)
+		server.SetInfo(backmanager.FIELD_DOWNLOAD_PRJ_PERMIT, nil)
+
+		if err := server.Client().DownloadProject(ctx, path, nil); !errors.Is(err, backmanager.ErrDownloadNotPermitted) {
+			t.Fatalf("got %v, want ErrDownloadNotPermitted", err)
+		}
+		if len(server.Requests()) != 0 {
+			t.Errorf("Chunks were sent without permission")
+		}
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		server, _ := newServer(t, 0)
+		client := server.Client()
+		client.Password = "wrong"
+
+		if err := client.DownloadProject(ctx, path, &backmanager.DownloadOptions{CutSize: 1024}); !errors.Is(err, backmanager.ErrDownloadRejected) {
+			t.Fatalf("got %v, want ErrDownloadRejected", err)
+		}
+	})
+
+	t.Run("Not accepted", func(t *testing.T) {
+		server, _ := newServer(t, 0)
+		server.SetProject([]byte("old project"))
+		server.IgnoreDownloads(true)
+
+		if err := server.Client().DownloadProject(ctx, path, &backmanager.DownloadOptions{CutSize: 1024}); !errors.Is(err, backmanager.ErrDownloadNotAccepted) {
+			t.Fatalf("got %v, want ErrDownloadNotAccepted", err)
+		}
+	})
+
+	t.Run("Empty project", func(t *testing.T) {
+		empty := filepath.Join(t.TempDir(), "empty.hwdev")
+		os.WriteFile(empty, nil, 0o644)
+		server, _ := newServer(t, 0)
+
+		if err := server.Client().DownloadProject(ctx, empty, nil); !errors.Is(err, backmanager.ErrEmptyProject) {
+			t.Fatalf("got %v, want ErrEmptyProject", err)
+		}
+	})
+}
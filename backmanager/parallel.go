@@ -0,0 +1,187 @@
+package backmanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type chunkResult struct {
+	index int
+	size  int
+	err   error
+}
+
+// uploadParallel fetches chunks start..FileCount-1 with a bounded worker
+// pool and writes each at its offset. On failure the part file is cut back
+// to the chunks completed without gaps, so a later SaveProject resumes from
+// there. A process killed mid-transfer may leave gaps behind; those fail the
+// MD5 check and the project is fetched again from scratch.
+func (c *Client) uploadParallel(ctx context.Context, f *os.File, count *FileCount, start int, opts *UploadOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit := newAdaptiveLimit(ctx, opts.Concurrency)
+	jobs := make(chan int)
+	results := make(chan chunkResult)
+
+	var wg sync.WaitGroup
+	for range min(opts.Concurrency, count.FileCount-start) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results <- c.uploadChunkAt(ctx, f, count, index, opts, limit)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := start; i < count.FileCount; i++ {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var (
+		firstErr error
+		done     = make(map[int]bool)
+		chunks   = start
+		written  = int64(start) * count.CutSize
+		prefix   = start
+	)
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+				cancel()
+			}
+			continue
+		}
+
+		done[result.index] = true
+		for done[prefix] {
+			delete(done, prefix)
+			prefix++
+		}
+
+		chunks++
+		written += int64(result.size)
+		if opts.Progress != nil {
+			opts.Progress(Progress{Chunks: chunks, FileCount: count.FileCount, Bytes: written, Concurrency: limit.current()})
+		}
+	}
+
+	if firstErr != nil {
+		if err := f.Truncate(int64(prefix) * count.CutSize); err != nil {
+			return fmt.Errorf("%w (truncate part file: %v)", firstErr, err)
+		}
+		return firstErr
+	}
+
+	return nil
+}
+
+func (c *Client) uploadChunkAt(ctx context.Context, f *os.File, count *FileCount, index int, opts *UploadOptions, limit *adaptiveLimit) chunkResult {
+	if err := limit.acquire(ctx); err != nil {
+		return chunkResult{index: index, err: err}
+	}
+	defer limit.release()
+
+	chunk, err := c.uploadChunkWithRetry(ctx, count, index, opts, limit.failed)
+	if err != nil {
+		return chunkResult{index: index, err: err}
+	}
+	limit.succeeded()
+
+	if _, err := f.WriteAt(chunk.Data, int64(index)*count.CutSize); err != nil {
+		return chunkResult{index: index, err: fmt.Errorf("write project chunk %d: %w", index, err)}
+	}
+
+	return chunkResult{index: index, size: len(chunk.Data)}
+}
+
+// adaptiveLimit is a semaphore whose size follows the HMI's health: every
+// failure halves it, and each run of as many successes as the current limit
+// grows it by one, up to max.
+type adaptiveLimit struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	max    int
+	active int
+	streak int
+}
+
+func newAdaptiveLimit(ctx context.Context, max int) *adaptiveLimit {
+	l := &adaptiveLimit{limit: max, max: max}
+	l.cond = sync.NewCond(&l.mu)
+
+	context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.cond.Broadcast()
+	})
+
+	return l
+}
+
+func (l *adaptiveLimit) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.active >= l.limit && ctx.Err() == nil {
+		l.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.active++
+	return nil
+}
+
+func (l *adaptiveLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.cond.Broadcast()
+}
+
+func (l *adaptiveLimit) failed() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = max(1, l.limit/2)
+	l.streak = 0
+}
+
+func (l *adaptiveLimit) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.streak++
+	if l.streak >= l.limit && l.limit < l.max {
+		l.limit++
+		l.streak = 0
+		l.cond.Broadcast()
+	}
+}
+
+func (l *adaptiveLimit) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit
+}
@@ -0,0 +1,74 @@
+package backmanager
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FIELD_SIGN      = "sign"
+	FIELD_TIMESTAMP = "timestamp"
+)
+
+// Sign computes the HMI's parameter signature: the first value of every
+// parameter except sign itself, ordered by parameter name and concatenated,
+// followed by salt, hashed with MD5 and hex-encoded in lower case.
+func Sign(vs url.Values, salt string) string {
+	keys := make([]string, 0, len(vs))
+	for key := range vs {
+		if key != FIELD_SIGN {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	sb := strings.Builder{}
+	for _, key := range keys {
+		sb.WriteString(vs.Get(key))
+	}
+	sb.WriteString(salt)
+
+	return HashPassword(sb.String())
+}
+
+// HashPassword returns the lower-case hex MD5 of s, the form the HMI
+// expects project passwords in.
+func HashPassword(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Signer attaches a signature to every request a Client sends.
+type Signer struct {
+	// Salt is appended to the signed string, if set.
+	Salt string
+	// Timestamp adds the current Unix time in seconds as the timestamp
+	// parameter before signing, so a captured request cannot be replayed
+	// later.
+	Timestamp bool
+	// Now overrides the clock, for tests.
+	Now func() time.Time
+}
+
+// DefaultSigner returns the signer NewClient installs: timestamped and
+// unsalted, which is what panels without a configured salt check.
+func DefaultSigner() *Signer {
+	return &Signer{Timestamp: true}
+}
+
+// Apply sets the timestamp, if enabled, and the sign parameter on vs.
+func (s *Signer) Apply(vs url.Values) {
+	if s.Timestamp {
+		now := time.Now
+		if s.Now != nil {
+			now = s.Now
+		}
+		vs.Set(FIELD_TIMESTAMP, strconv.FormatInt(now().Unix(), 10))
+	}
+	vs.Set(FIELD_SIGN, Sign(vs, s.Salt))
+}
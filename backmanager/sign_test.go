@@ -0,0 +1,124 @@
+package backmanager_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tests/backmanager"
+)
+
+func TestSign(t *testing.T) {
+	testCases := []struct {
+		name   string
+		values url.Values
+		salt   string
+		want   string
+	}{
+		{
+			name:   "File count",
+			values: url.Values{backmanager.FIELD_CUTSIZE: {"524288"}, backmanager.FIELD_FILE_TYPE: {"project"}},
+			want:   "971944dfa43555cbcb0db0f1d606694d",
+		},
+		{
+			name:   "Salt and timestamp",
+			values: url.Values{backmanager.FIELD_CUTSIZE: {"524288"}, backmanager.FIELD_FILE_TYPE: {"project"}, backmanager.FIELD_TIMESTAMP: {"1700000000"}},
+			salt:   "secret",
+			want:   "2ddb9c87862aeef366f4904e01860847",
+		},
+		{
+			name:   "Existing sign is ignored",
+			values: url.Values{backmanager.FIELD_CUTSIZE: {"524288"}, backmanager.FIELD_FILE_TYPE: {"project"}, backmanager.FIELD_SIGN: {"stale"}},
+			want:   "971944dfa43555cbcb0db0f1d606694d",
+		},
+		{
+			name: "No parameters",
+			salt: "secret",
+			want: "5ebe2294ecd0e0f08eab7690d2a6ee69",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := backmanager.Sign(tc.values, tc.salt); got != tc.want {
+				t.Errorf("Sign() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	if got := backmanager.HashPassword("123456"); got != "e10adc3949ba59abbe56e057f20f883e" {
+		t.Errorf("HashPassword() = %s", got)
+	}
+}
+
+func TestSignerApply(t *testing.T) {
+	signer := &backmanager.Signer{Salt: "secret", Timestamp: true, Now: func() time.Time { return time.Unix(1700000000, 0) }}
+
+	values := url.Values{backmanager.FIELD_CUTSIZE: {"524288"}, backmanager.FIELD_FILE_TYPE: {"project"}}
+	signer.Apply(values)
+
+	if values.Get(backmanager.FIELD_TIMESTAMP) != "1700000000" || values.Get(backmanager.FIELD_SIGN) != "2ddb9c87862aeef366f4904e01860847" {
+		t.Errorf("Apply() = %v", values)
+	}
+}
+
+func TestClientSignsRequests(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newServer(t, 2500)
+	server.RequireSign("secret")
+	client := server.Client()
+
+	var statusErr *backmanager.StatusError
+	if _, err := client.GetHmiInfo(ctx); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Unsigned request: got %v, want 401", err)
+	}
+
+	client.Signer = &backmanager.Signer{Salt: "secret", Timestamp: true}
+
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "project.hwdev")
+	if err := client.SaveProject(ctx, path, count, nil); err != nil {
+		t.Fatalf("Failed to save the project: %v", err)
+	}
+	if err := client.DownloadProject(ctx, path, &backmanager.DownloadOptions{CutSize: 1024}); err != nil {
+		t.Fatalf("Failed to download the project: %v", err)
+	}
+	if saved, _ := os.ReadFile(path); !bytes.Equal(saved, server.Project()) {
+		t.Errorf("Signed round trip does not match")
+	}
+}
+
+func TestNewClientSigns(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newServer(t, 2500)
+	server.RequireSign("")
+
+	client := server.Client()
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "project.hwdev")
+	if err := client.SaveProject(ctx, path, count, nil); err != nil {
+		t.Fatalf("Failed to save the project: %v", err)
+	}
+	if err := client.DownloadProject(ctx, path, &backmanager.DownloadOptions{CutSize: 1024}); err != nil {
+		t.Fatalf("Failed to download the project: %v", err)
+	}
+
+	client.Signer = nil
+
+	var statusErr *backmanager.StatusError
+	if _, err := client.GetHmiInfo(ctx); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Unsigned request: got %v, want 401", err)
+	}
+}
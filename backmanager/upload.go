@@ -0,0 +1,226 @@
+package backmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_RETRIES = 3
+	DEFAULT_BACKOFF = 500 * time.Millisecond
+	MAX_BACKOFF     = 10 * time.Second
+)
+
+var ErrMD5Mismatch = errors.New("backmanager: project md5 mismatch")
+
+// UploadOptions tunes SaveProject. The zero value uses the defaults.
+type UploadOptions struct {
+	// Retries is the number of extra attempts per chunk.
+	Retries int
+	// Backoff is the delay before the first retry; it doubles on every
+	// further attempt, up to MAX_BACKOFF.
+	Backoff time.Duration
+	// Concurrency is the maximum number of chunks fetched at once. Values
+	// above 1 enable the worker pool, which halves its concurrency whenever
+	// the HMI fails a request and grows it back as requests succeed.
+	Concurrency int
+	// Progress, if set, is called after every chunk written. Calls are
+	// never concurrent.
+	Progress func(Progress)
+}
+
+type Progress struct {
+	Chunks      int
+	FileCount   int
+	Bytes       int64
+	Concurrency int
+}
+
+// SaveProject copies the project described by count off the HMI into path.
+//
+// Chunks go to a part file next to path, named after the project MD5. If a
+// previous call was interrupted, the transfer resumes after the last
+// complete chunk in that file. The result is verified against count.MD5
+// before being renamed to path; on a mismatch the part file is removed and
+// ErrMD5Mismatch returned.
+func (c *Client) SaveProject(ctx context.Context, path string, count *FileCount, opts *UploadOptions) error {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+
+	partPath := fmt.Sprintf("%s.%s.part", path, count.MD5)
+	f, start, err := openPart(partPath, count)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if opts.Concurrency > 1 {
+		err = c.uploadParallel(ctx, f, count, start, opts)
+	} else {
+		err = c.uploadSequential(ctx, f, count, start, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	return finishPart(f, partPath, path, count)
+}
+
+func (c *Client) uploadSequential(ctx context.Context, f *os.File, count *FileCount, start int, opts *UploadOptions) error {
+	written := int64(start) * count.CutSize
+	for i := start; i < count.FileCount; i++ {
+		chunk, err := c.uploadChunkWithRetry(ctx, count, i, opts, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(chunk.Data); err != nil {
+			return fmt.Errorf("write project chunk %d: %w", i, err)
+		}
+
+		written += int64(len(chunk.Data))
+		if opts.Progress != nil {
+			opts.Progress(Progress{Chunks: i + 1, FileCount: count.FileCount, Bytes: written, Concurrency: 1})
+		}
+	}
+	return nil
+}
+
+// openPart opens the part file and truncates it to the last complete chunk,
+// returning the index of the first chunk still missing.
+func openPart(partPath string, count *FileCount) (*os.File, int, error) {
+	if err := os.MkdirAll(filepath.Dir(partPath), 0o755); err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	start := min(int(stat.Size()/count.CutSize), count.FileCount)
+	offset := int64(start) * count.CutSize
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	return f, start, nil
+}
+
+// finishPart verifies the part file against the project MD5 and moves it
+// into place.
+func finishPart(f *os.File, partPath, path string, count *FileCount) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, sum, err := fileMD5(f)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	if !strings.EqualFold(sum, count.MD5) {
+		os.Remove(partPath)
+		return fmt.Errorf("%w: got %s, want %s", ErrMD5Mismatch, sum, count.MD5)
+	}
+
+	return os.Rename(partPath, path)
+}
+
+// uploadChunkWithRetry fetches and checks one chunk, retrying with
+// exponential backoff. onFailure, if set, is called for every failed
+// attempt.
+func (c *Client) uploadChunkWithRetry(ctx context.Context, count *FileCount, index int, opts *UploadOptions, onFailure func()) (*Chunk, error) {
+	var chunk *Chunk
+	err := retry(ctx, opts.Retries, opts.Backoff, onFailure, func() error {
+		var err error
+		if chunk, err = c.UploadProjectChunk(ctx, count.CutSize, index); err != nil {
+			return err
+		}
+		return checkChunk(count, chunk)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// retry calls fn until it succeeds, it fails with a final error, or the
+// retries run out. Zero retries and backoff fall back to the defaults.
+func retry(ctx context.Context, retries int, backoff time.Duration, onFailure func(), fn func() error) error {
+	if retries <= 0 {
+		retries = DEFAULT_RETRIES
+	}
+	if backoff <= 0 {
+		backoff = DEFAULT_BACKOFF
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if onFailure != nil && ctx.Err() == nil {
+			onFailure()
+		}
+		if attempt >= retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, MAX_BACKOFF)
+	}
+}
+
+// checkChunk verifies that every chunk but the last is exactly CutSize
+// bytes and the last one is not empty, catching truncated responses.
+func checkChunk(count *FileCount, chunk *Chunk) error {
+	size := int64(len(chunk.Data))
+	if chunk.Index < count.FileCount-1 && size != count.CutSize ||
+		chunk.Index == count.FileCount-1 && (size == 0 || size > count.CutSize) {
+		return fmt.Errorf("upload project chunk %d: %w: got %d bytes of %d", chunk.Index, ErrChunkSize, size, count.CutSize)
+	}
+	return nil
+}
+
+// retryable reports whether a chunk request may succeed when repeated.
+// Cancellation, client errors such as a wrong password and chunks the HMI
+// explicitly rejected are final.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrDownloadRejected) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return true
+}
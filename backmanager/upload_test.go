@@ -0,0 +1,240 @@
+package backmanager_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"tests/backmanager"
+)
+
+func TestSaveProject(t *testing.T) {
+	server, project := newServer(t, 5*1024+300)
+	server.FailChunk(1, 2)
+	server.TruncateChunk(3, 1)
+	client := server.Client()
+	ctx := context.Background()
+
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+	// Some panels report the MD5 in upper case.
+	count.MD5 = strings.ToUpper(count.MD5)
+
+	var progress []backmanager.Progress
+	path := filepath.Join(t.TempDir(), count.MD5+".hwdev")
+	err = client.SaveProject(ctx, path, count, &backmanager.UploadOptions{
+		Backoff:  time.Millisecond,
+		Progress: func(p backmanager.Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("Failed to save the project: %v", err)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(saved, project) {
+		t.Fatalf("Saved project does not match (%v)", err)
+	}
+	if want := []int{0, 1, 1, 1, 2, 3, 3, 4, 5}; !slices.Equal(server.Requests(), want) {
+		t.Errorf("Requested chunks %v, want %v", server.Requests(), want)
+	}
+	if len(progress) != 6 || progress[5].Bytes != int64(len(project)) || progress[5].FileCount != 6 {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+	if matches, _ := filepath.Glob(path + ".*.part"); len(matches) != 0 {
+		t.Errorf("Part files left behind: %v", matches)
+	}
+}
+
+func TestSaveProjectResume(t *testing.T) {
+	server, project := newServer(t, 4*1024)
+	client := server.Client()
+	ctx := context.Background()
+
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+
+	// Two complete chunks and half of the third survived the last attempt.
+	path := filepath.Join(t.TempDir(), "project.hwdev")
+	if err := os.WriteFile(path+"."+count.MD5+".part", project[:2*1024+512], 0o644); err != nil {
+		t.Fatalf("Failed to write the part file: %v", err)
+	}
+
+	if err := client.SaveProject(ctx, path, count, nil); err != nil {
+		t.Fatalf("Failed to resume the project: %v", err)
+	}
+
+	saved, _ := os.ReadFile(path)
+	if !bytes.Equal(saved, project) {
+		t.Fatalf("Resumed project does not match")
+	}
+	if want := []int{2, 3}; !slices.Equal(server.Requests(), want) {
+		t.Errorf("Requested chunks %v, want %v", server.Requests(), want)
+	}
+}
+
+func TestSaveProjectErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("MD5 mismatch", func(t *testing.T) {
+		server, _ := newServer(t, 2048)
+		client := server.Client()
+		count := &backmanager.FileCount{CutSize: 1024, FileType: backmanager.FILE_TYPE_PROJECT, FileCount: 2, MD5: "00000000000000000000000000000000"}
+
+		path := filepath.Join(t.TempDir(), "project.hwdev")
+		if err := client.SaveProject(ctx, path, count, nil); !errors.Is(err, backmanager.ErrMD5Mismatch) {
+			t.Fatalf("got %v, want backmanager.ErrMD5Mismatch", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Corrupt project was moved into place")
+		}
+		if matches, _ := filepath.Glob(path + ".*.part"); len(matches) != 0 {
+			t.Errorf("Corrupt part file kept: %v", matches)
+		}
+	})
+
+	t.Run("Wrong password is not retried", func(t *testing.T) {
+		server, _ := newServer(t, 2048)
+		client := server.Client()
+		client.Password = "wrong"
+
+		count, _ := client.GetFileCount(ctx, 1024)
+		var statusErr *backmanager.StatusError
+		err := client.SaveProject(ctx, filepath.Join(t.TempDir(), "project.hwdev"), count, &backmanager.UploadOptions{Backoff: time.Millisecond})
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+			t.Fatalf("got %v, want 403 backmanager.StatusError", err)
+		}
+		if len(server.Requests()) != 1 {
+			t.Errorf("Wrong password was requested %d times", len(server.Requests()))
+		}
+	})
+
+	t.Run("Retries exhausted", func(t *testing.T) {
+		server, _ := newServer(t, 2048)
+		server.FailChunk(0, 10)
+		client := server.Client()
+
+		count, _ := client.GetFileCount(ctx, 1024)
+		var statusErr *backmanager.StatusError
+		err := client.SaveProject(ctx, filepath.Join(t.TempDir(), "project.hwdev"), count, &backmanager.UploadOptions{Retries: 2, Backoff: time.Millisecond})
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("got %v, want 500 backmanager.StatusError", err)
+		}
+	})
+}
+
+func TestSaveProjectParallel(t *testing.T) {
+	server, project := newServer(t, 40*1024+7)
+	server.FailChunk(5, 1)
+	server.FailChunk(6, 1)
+	server.TruncateChunk(20, 1)
+	server.SetDelay(2 * time.Millisecond)
+	client := server.Client()
+	ctx := context.Background()
+
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+
+	var progress []backmanager.Progress
+	path := filepath.Join(t.TempDir(), "project.hwdev")
+	err = client.SaveProject(ctx, path, count, &backmanager.UploadOptions{
+		Backoff:     time.Millisecond,
+		Concurrency: 8,
+		Progress:    func(p backmanager.Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("Failed to save the project: %v", err)
+	}
+
+	saved, _ := os.ReadFile(path)
+	if !bytes.Equal(saved, project) {
+		t.Fatalf("Saved project does not match")
+	}
+	if inflight := server.MaxInflight(); inflight < 2 || inflight > 8 {
+		t.Errorf("Fetched up to %d chunks at once, want 2..8", inflight)
+	}
+
+	last := progress[len(progress)-1]
+	if len(progress) != count.FileCount || last.Bytes != int64(len(project)) {
+		t.Errorf("Unexpected final progress %+v after %d calls", last, len(progress))
+	}
+	if !slices.ContainsFunc(progress, func(p backmanager.Progress) bool { return p.Concurrency < 8 }) {
+		t.Errorf("Concurrency never backed off after failures")
+	}
+}
+
+func TestSaveProjectParallelResume(t *testing.T) {
+	server, project := newServer(t, 16*1024)
+	server.FailChunk(9, 10)
+	client := server.Client()
+	ctx := context.Background()
+
+	count, err := client.GetFileCount(ctx, 1024)
+	if err != nil {
+		t.Fatalf("Failed to get the file count: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "project.hwdev")
+	opts := &backmanager.UploadOptions{Retries: 1, Backoff: time.Millisecond, Concurrency: 4}
+	if err := client.SaveProject(ctx, path, count, opts); err == nil {
+		t.Fatalf("Expected chunk 9 to fail")
+	}
+
+	// Only the gap-free prefix before the failed chunk may survive.
+	stat, err := os.Stat(path + "." + count.MD5 + ".part")
+	if err != nil || stat.Size() > 9*1024 || stat.Size()%1024 != 0 {
+		t.Fatalf("Unexpected part file after failure: %v %v", stat, err)
+	}
+
+	server.ResetRequests()
+
+	if err := client.SaveProject(ctx, path, count, opts); err != nil {
+		t.Fatalf("Failed to resume the project: %v", err)
+	}
+	saved, _ := os.ReadFile(path)
+	if !bytes.Equal(saved, project) {
+		t.Fatalf("Resumed project does not match")
+	}
+	if len(server.Requests()) != count.FileCount-int(stat.Size()/1024) {
+		t.Errorf("Resume fetched %d chunks, want %d", len(server.Requests()), count.FileCount-int(stat.Size()/1024))
+	}
+}
+
+func BenchmarkSaveProject(b *testing.B) {
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("Concurrency%d", concurrency), func(b *testing.B) {
+			server, project := newServer(b, 64*1024)
+			server.SetDelay(time.Millisecond)
+			client := server.Client()
+			ctx := context.Background()
+
+			count, err := client.GetFileCount(ctx, 1024)
+			if err != nil {
+				b.Fatalf("Failed to get the file count: %v", err)
+			}
+
+			dir := b.TempDir()
+			b.SetBytes(int64(len(project)))
+			b.ResetTimer()
+			for i := range b.N {
+				path := filepath.Join(dir, fmt.Sprintf("%d.hwdev", i))
+				if err := client.SaveProject(ctx, path, count, &backmanager.UploadOptions{Concurrency: concurrency}); err != nil {
+					b.Fatalf("Failed to save the project: %v", err)
+				}
+			}
+		})
+	}
+}
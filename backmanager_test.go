@@ -1,166 +1,186 @@
 package tests
 
 import (
-	"crypto/md5"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"math/rand"
 	"os"
-	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-)
 
-// func TestHmiProjectDownload(t *testing.T) {
-// 	const (
-// 		HAIWELL_PROJECT_FILEPATH = "./assets/3.40.0.14.hwdev"
-// 	)
-// 	password := os.Getenv("HAIWELL_PROJECT_ENCRYPT_PASSWORD")
-//
-// 	db, err := sql.Open("sqlite3", fmt.Sprintf("%s?_key=%s", HAIWELL_PROJECT_FILEPATH, password))
-// 	if err != nil {
-// 		t.Fatalf("Failed to open the database: %v", err)
-// 	}
-// 	defer db.Close()
-//
-// 	rows, err := db.Query("SELECT * FROM haiwell")
-// 	if err != nil {
-// 		t.Fatalf("Failed to query the comand: %v", err)
-// 	}
-//
-// 	defer rows.Close()
-// }
+	"tests/backmanager"
+	"tests/backmanager/backmanagertest"
+	"tests/fleet"
+)
 
-func TestHmiProjectUpload(t *testing.T) {
+func TestHmiProjectDownload(t *testing.T) {
 
 	const (
-		BACKMANAGE_PROTOCOL     = "http"
-		BACKMANAGE_IP           = "192.168.22.23"
-		BACKMANAGE_UPDATE_PORT  = 81
-		BACKMANAGE_UONLINE_PORT = 82
-
-		BACKMANAGE_GET_HMI_INFO                             = "/update/getHmiInfo"
-		BACKMANAGE_GET_HMI_INFO_UPLAOD_PASSWORD_STATE_FIELD = "loadPwdState"
-		BACKMANAGE_GET_HMI_INFO_UPLOAD_PROJECT_PREMIT_FIELD = "uploadPrjPermit"
-
-		BACKMANAGE_PROJECT_FILE_COUNT                    = "/uonline/getFileCount/"
-		BACKMANAGE_PROJECT_FILE_COUNT_FILE_CUTSIZE_FILED = "cutsize"
-		BACKMANAGE_PROJECT_FILE_COUNT_FILE_TYPE_FIELD    = "fileType"
-		BACKMANAGE_PROJECT_FILE_COUNT_FILE_COUNT_FIELD   = "fileCount"
-		BACKMANAGE_PROJECT_FILE_COUNT_FILE_MD5_FIELD     = "md5"
-		BACKMANAGE_PROJECT_FILE_COUNT_FILE_TYPE_VALUE    = "project"
-		BACKMANAGE_PROJECT_FILE_COUNT_FILE_CUTSIZE_VALUE = 512 * 1024
-
-		BACKMANAGE_UPLOAD_PROJECT_FILE                = "/uonline/uploadProject/"
-		BACKMANAGE_UPLOAD_PROJECT_FILE_STORAGE_DIR    = "./assets/"
-		BACKMANAGE_UPLOAD_PROJECT_FILE_CUTSIZE_FILED  = "cutSize"
-		BACKMANAGE_UPLOAD_PROJECT_FILE_CUTSIZE_VALUE  = 512 * 1024
-		BACKMANAGE_UPLOAD_PROJECT_FILE_INDEX_FILED    = "index"
-		BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_FILED = "password"
-		BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_VALUE = "b51b74011735cf017faeda4520932bab"
+		HAIWELL_PROJECT_FILEPATH = "./assets/3.40.0.14.hwdev"
 	)
 
-	requestUrl := fmt.Sprintf("%s://%s:%d%s", BACKMANAGE_PROTOCOL, BACKMANAGE_IP, BACKMANAGE_UPDATE_PORT, BACKMANAGE_GET_HMI_INFO)
-	m, err := httpPostForm(requestUrl, nil)
-	if err != nil {
-		t.Fatalf("Failed to get the HMI info: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	client, real := newHmiClient(t)
+	path := HAIWELL_PROJECT_FILEPATH
+	// Pushing overwrites the project on the panel, so the hardware run
+	// needs its own opt-in on top of BACKMANAGE_IP.
+	if real && os.Getenv("BACKMANAGE_ALLOW_DOWNLOAD") != "1" {
+		t.Skip("BACKMANAGE_ALLOW_DOWNLOAD is not 1")
+	}
+	if !real {
+		path = t.TempDir() + "/project.hwdev"
+		if err := os.WriteFile(path, []byte("fake haiwell project"), 0o644); err != nil {
+			t.Fatalf("Failed to write the project file: %v", err)
+		}
 	}
 
-	if m[BACKMANAGE_GET_HMI_INFO_UPLAOD_PASSWORD_STATE_FIELD].(float64) != 1 ||
-		m[BACKMANAGE_GET_HMI_INFO_UPLOAD_PROJECT_PREMIT_FIELD].(float64) != 1 {
-		t.Fatalf("The HMI upload project permission is not allowed")
+	err := client.DownloadProject(ctx, path, &backmanager.DownloadOptions{
+		Progress: func(p backmanager.Progress) {
+			t.Logf("Downloaded %d/%d chunks, %d bytes", p.Chunks, p.FileCount, p.Bytes)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to download the project file: %v", err)
 	}
+}
 
-	requestUrl = fmt.Sprintf("%s://%s:%d%s", BACKMANAGE_PROTOCOL, BACKMANAGE_IP, BACKMANAGE_UONLINE_PORT, BACKMANAGE_PROJECT_FILE_COUNT)
+func TestHmiProjectUpload(t *testing.T) {
 
-	values := url.Values{
-		BACKMANAGE_PROJECT_FILE_COUNT_FILE_CUTSIZE_FILED: {fmt.Sprintf("%d", BACKMANAGE_PROJECT_FILE_COUNT_FILE_CUTSIZE_VALUE)},
-		BACKMANAGE_PROJECT_FILE_COUNT_FILE_TYPE_FIELD:    {BACKMANAGE_PROJECT_FILE_COUNT_FILE_TYPE_VALUE},
+	const (
+		BACKMANAGE_UPLOAD_PROJECT_FILE_STORAGE_DIR = "./assets/"
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	client, real := newHmiClient(t)
+	dir := BACKMANAGE_UPLOAD_PROJECT_FILE_STORAGE_DIR
+	if !real {
+		dir = t.TempDir() + "/"
 	}
 
-	m, err = httpPostForm(requestUrl, values)
+	info, err := client.GetHmiInfo(ctx)
 	if err != nil {
-		t.Fatalf("Failed to get the project file count: %v", err)
+		t.Fatalf("Failed to get the HMI info: %v", err)
 	}
 
-	requestUrl = fmt.Sprintf("%s://%s:%d%s", BACKMANAGE_PROTOCOL, BACKMANAGE_IP, BACKMANAGE_UONLINE_PORT, BACKMANAGE_UPLOAD_PROJECT_FILE)
+	if err := info.CheckUploadPermission(); err != nil {
+		t.Fatalf("The HMI upload project permission is not allowed: %v", err)
+	}
 
-	values.Set(BACKMANAGE_UPLOAD_PROJECT_FILE_CUTSIZE_FILED, fmt.Sprintf("%d", BACKMANAGE_UPLOAD_PROJECT_FILE_CUTSIZE_VALUE))
-	// passwordMd5 := md5.New()
-	// passwordMd5.Write([]byte(BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_VALUE))
-	// values.Set(BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_FILED, string(passwordMd5.Sum(nil)))
-	values.Set(BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_FILED, BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_VALUE)
+	count, err := client.GetFileCount(ctx, backmanager.DEFAULT_CUT_SIZE)
+	if err != nil {
+		t.Fatalf("Failed to get the project file count: %v", err)
+	}
 
-	f, err := os.Create(fmt.Sprintf("%s%s.hwdev", BACKMANAGE_UPLOAD_PROJECT_FILE_STORAGE_DIR, m[BACKMANAGE_PROJECT_FILE_COUNT_FILE_MD5_FIELD].(string)))
+	path := fmt.Sprintf("%s%s.hwdev", dir, count.MD5)
+	err = client.SaveProject(ctx, path, count, &backmanager.UploadOptions{
+		Concurrency: 4,
+		Progress: func(p backmanager.Progress) {
+			t.Logf("Uploaded %d/%d chunks, %d bytes", p.Chunks, p.FileCount, p.Bytes)
+		},
+	})
 	if err != nil {
-		t.Fatalf("Failed to create the project file: %v", err)
+		t.Fatalf("Failed to upload the project file: %v", err)
 	}
+}
 
-	for i := range int(m[BACKMANAGE_PROJECT_FILE_COUNT_FILE_COUNT_FIELD].(float64)) {
-		values.Set(BACKMANAGE_UPLOAD_PROJECT_FILE_INDEX_FILED, fmt.Sprintf("%d", i))
+func TestHmiDiscovery(t *testing.T) {
 
-		resp, err := http.PostForm(requestUrl, values)
-		if err != nil {
-			t.Fatalf("Failed to upload the project file: %v", err)
-		}
+	const (
+		BACKMANAGE_SUBNET = "192.168.22.0/24"
+	)
 
-		buff, err := io.ReadAll(resp.Body)
-		if err != nil {
-			t.Fatalf("Failed to read the response body: %v", err)
-		}
+	// Scanning the panel subnet only makes sense on the LAN that has them.
+	if os.Getenv("BACKMANAGE_IP") == "" {
+		t.Skip("BACKMANAGE_IP is not set")
+	}
 
-		_, err = f.Write(buff)
-		if err != nil {
-			t.Fatalf("Failed to write the project file: %v", err)
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
-		resp.Body.Close()
+	inv, err := fleet.OpenInventory(ctx, fleet.DEFAULT_INVENTORY_DB_PATH)
+	if err != nil {
+		t.Fatalf("Failed to open the inventory: %v", err)
 	}
-}
+	defer inv.Close()
 
-func httpPostForm(url string, values url.Values) (map[string]any, error) {
-	resp, err := http.PostForm(url, values)
+	devices, err := inv.Discover(ctx, &fleet.Scanner{}, BACKMANAGE_SUBNET)
 	if err != nil {
-		return nil, err
+		t.Fatalf("Failed to discover the HMIs: %v", err)
 	}
 
-	buff, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	for _, d := range devices {
+		t.Logf("%s model=%s firmware=%s uploadPrjPermit=%d", d.Host, d.Model, d.Firmware, d.UploadPrjPermit)
 	}
-	defer resp.Body.Close()
+}
 
-	m := make(map[string]any)
+func TestHmiProjectBackup(t *testing.T) {
 
-	if err := json.Unmarshal(buff, &m); err != nil {
-		return nil, err
+	const (
+		BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_VALUE = "b51b74011735cf017faeda4520932bab"
+		BACKMANAGE_BACKUP_KEEP                        = 10
+	)
+
+	// The inventory only lists real panels, found by TestHmiDiscovery.
+	if os.Getenv("BACKMANAGE_IP") == "" {
+		t.Skip("BACKMANAGE_IP is not set")
 	}
 
-	return m, nil
-}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
 
-func calculateSign(vs url.Values) string {
+	inv, err := fleet.OpenInventory(ctx, fleet.DEFAULT_INVENTORY_DB_PATH)
+	if err != nil {
+		t.Fatalf("Failed to open the inventory: %v", err)
+	}
+	defer inv.Close()
 
-	keys := make([]string, 0, len(vs))
+	targets, err := fleet.TargetsFromInventory(ctx, inv, time.Now().AddDate(0, 0, -7), BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_VALUE)
+	if err != nil {
+		t.Fatalf("Failed to list the HMIs: %v", err)
+	}
 
-	for key := range vs {
-		keys = append(keys, key)
+	job := &fleet.BackupJob{
+		Store:     &fleet.DirStore{Root: fleet.DEFAULT_BACKUP_DIR},
+		Retention: fleet.Retention{Keep: BACKMANAGE_BACKUP_KEEP},
 	}
 
-	sort.Strings(keys)
+	report := job.Run(ctx, targets)
+	var sb strings.Builder
+	report.WriteText(&sb)
+	t.Log(sb.String())
 
-	sb := strings.Builder{}
+	if failed := report.Failed(); len(failed) > 0 {
+		t.Errorf("%d HMIs failed to back up", len(failed))
+	}
+}
+
+// newHmiClient talks to the panel at BACKMANAGE_IP when it is set, and to a
+// local fake serving a random project otherwise. It reports which one it
+// returned.
+func newHmiClient(t *testing.T) (*backmanager.Client, bool) {
+	const (
+		BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_VALUE = "b51b74011735cf017faeda4520932bab"
+	)
 
-	for _, key := range keys {
-		sb.WriteString(vs.Get(key))
+	if ip := os.Getenv("BACKMANAGE_IP"); ip != "" {
+		client := backmanager.NewClient(ip)
+		client.Password = BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_VALUE
+		return client, true
 	}
 
-	h := md5.New()
-	h.Write([]byte(sb.String()))
-	return string(h.Sum(nil))
+	project := make([]byte, 3*backmanager.DEFAULT_CUT_SIZE+1234)
+	rand.New(rand.NewSource(1)).Read(project)
 
+	server := backmanagertest.NewServer()
+	t.Cleanup(server.Close)
+	server.SetProject(project)
+	server.SetPassword(BACKMANAGE_UPLOAD_PROJECT_FILE_PASSWORD_VALUE)
+	return server.Client(), false
 }
@@ -0,0 +1,71 @@
+// Command hwdevdiff compares two Haiwell .hwdev projects table by table.
+//
+//	hwdevdiff [-password key] [-old-password key] [-json] old.hwdev new.hwdev
+//
+// The password defaults to $HAIWELL_PROJECT_ENCRYPT_PASSWORD. Like diff(1),
+// it exits 0 when the projects match, 1 when they differ and 2 on error.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"tests/hwdev"
+)
+
+func main() {
+	password := flag.String("password", os.Getenv("HAIWELL_PROJECT_ENCRYPT_PASSWORD"), "project password")
+	oldPassword := flag.String("old-password", "", "password of the old project, if it differs")
+	asJSON := flag.Bool("json", false, "write the report as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] old.hwdev new.hwdev\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *oldPassword == "" {
+		oldPassword = password
+	}
+
+	differ, err := run(context.Background(), flag.Arg(0), *oldPassword, flag.Arg(1), *password, *asJSON)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "hwdevdiff:", err)
+		os.Exit(2)
+	}
+	if differ {
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, oldPath, oldPassword, newPath, newPassword string, asJSON bool) (bool, error) {
+	old, err := hwdev.Open(ctx, oldPath, oldPassword)
+	if err != nil {
+		return false, err
+	}
+	defer old.Close()
+
+	new, err := hwdev.Open(ctx, newPath, newPassword)
+	if err != nil {
+		return false, err
+	}
+	defer new.Close()
+
+	report, err := hwdev.Diff(ctx, old, new)
+	if err != nil {
+		return false, err
+	}
+
+	if asJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+
+	return !report.Empty(), err
+}
@@ -0,0 +1,85 @@
+// Command redismigrate runs the Redis key migrations described in a JSON
+// spec file, one after another.
+//
+//	redismigrate [-addr host:port] [-password key] [-db n] [-batch n] [-dry-run | -verify] specs.json
+//
+// The address and password default to $REDIS_ADDRESS and $REDIS_PASSWORD.
+// With -dry-run the planned writes are printed instead of executed; with
+// -verify the destinations are only checked. It exits 0 when every
+// destination verifies, 1 when some members are missing and 2 on error.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-redis/redis/v8"
+
+	"tests/redismigrate"
+)
+
+func main() {
+	addr := flag.String("addr", os.Getenv("REDIS_ADDRESS"), "Redis address")
+	password := flag.String("password", os.Getenv("REDIS_PASSWORD"), "Redis password")
+	db := flag.Int("db", 0, "Redis database")
+	batch := flag.Int("batch", redismigrate.DEFAULT_BATCH_SIZE, "commands per pipeline")
+	dryRun := flag.Bool("dry-run", false, "print the writes instead of executing them")
+	verifyOnly := flag.Bool("verify", false, "only verify the destinations")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] specs.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || (*dryRun && *verifyOnly) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: *addr, Password: *password, DB: *db})
+	defer client.Close()
+
+	m := &redismigrate.Migrator{Redis: client, BatchSize: *batch, DryRun: *dryRun, Log: os.Stdout}
+	ok, err := run(context.Background(), m, flag.Arg(0), *verifyOnly)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "redismigrate:", err)
+		os.Exit(2)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, m *redismigrate.Migrator, path string, verifyOnly bool) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	specs, err := redismigrate.Load(f)
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+	for _, spec := range specs {
+		var report *redismigrate.Report
+		if verifyOnly {
+			report, err = m.Verify(ctx, spec)
+		} else {
+			report, err = m.Migrate(ctx, spec)
+		}
+		if err != nil {
+			return false, err
+		}
+		if err := report.WriteText(os.Stderr); err != nil {
+			return false, err
+		}
+		// A dry run reports what it would add, which is not a failure.
+		ok = ok && (report.OK() || m.DryRun)
+	}
+	return ok, nil
+}
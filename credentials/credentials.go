@@ -0,0 +1,250 @@
+// Package credentials resolves Aliyun access keys the same way for every
+// client: explicit config, then environment variables, then the aliyun CLI
+// profile file, optionally exchanged for STS AssumeRole tokens, refreshed
+// before they expire.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+const (
+	DEFAULT_ENV_PREFIX     = "ALIBABA_CLOUD"
+	DEFAULT_REFRESH_BEFORE = 5 * time.Minute
+
+	ENV_ACCESS_KEY_ID     = "_ACCESS_KEY_ID"
+	ENV_ACCESS_KEY_SECRET = "_ACCESS_KEY_SECRET"
+	ENV_SECURITY_TOKEN    = "_SECURITY_TOKEN"
+	ENV_ROLE_ARN          = "ALIBABA_CLOUD_ROLE_ARN"
+	ENV_ROLE_SESSION_NAME = "ALIBABA_CLOUD_ROLE_SESSION_NAME"
+)
+
+// ErrNoCredentials means a provider has nothing configured, so a Chain
+// moves on to the next one. Any other error stops the chain.
+var ErrNoCredentials = errors.New("credentials: no credentials found")
+
+// Credentials is an access key pair, with a security token and expiry for
+// temporary STS credentials.
+type Credentials struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	SecurityToken   string
+	// Expiration is zero for long-lived access keys.
+	Expiration time.Time
+	// Source names the provider that supplied the credentials.
+	Source string
+}
+
+func (c *Credentials) GetAccessKeyID() string     { return c.AccessKeyID }
+func (c *Credentials) GetAccessKeySecret() string { return c.AccessKeySecret }
+func (c *Credentials) GetSecurityToken() string   { return c.SecurityToken }
+
+func (c *Credentials) valid() bool {
+	return c != nil && c.AccessKeyID != "" && c.AccessKeySecret != ""
+}
+
+// Provider supplies credentials.
+type Provider interface {
+	Retrieve(ctx context.Context) (*Credentials, error)
+}
+
+// Static returns fixed credentials, or ErrNoCredentials when the key pair
+// is incomplete.
+type Static struct {
+	Credentials
+}
+
+func (s *Static) Retrieve(ctx context.Context) (*Credentials, error) {
+	if !s.valid() {
+		return nil, fmt.Errorf("%w: static", ErrNoCredentials)
+	}
+	creds := s.Credentials
+	creds.Source = "static"
+	return &creds, nil
+}
+
+// Env reads <Prefix>_ACCESS_KEY_ID, <Prefix>_ACCESS_KEY_SECRET and
+// <Prefix>_SECURITY_TOKEN.
+type Env struct {
+	Prefix string
+}
+
+func (e *Env) Retrieve(ctx context.Context) (*Credentials, error) {
+	creds := &Credentials{
+		AccessKeyID:     os.Getenv(e.Prefix + ENV_ACCESS_KEY_ID),
+		AccessKeySecret: os.Getenv(e.Prefix + ENV_ACCESS_KEY_SECRET),
+		SecurityToken:   os.Getenv(e.Prefix + ENV_SECURITY_TOKEN),
+		Source:          "env:" + e.Prefix,
+	}
+	if !creds.valid() {
+		return nil, fmt.Errorf("%w: %s%s", ErrNoCredentials, e.Prefix, ENV_ACCESS_KEY_ID)
+	}
+	return creds, nil
+}
+
+// Chain returns the credentials of the first provider that has any.
+type Chain []Provider
+
+func (c Chain) Retrieve(ctx context.Context) (*Credentials, error) {
+	for _, p := range c {
+		creds, err := p.Retrieve(ctx)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return creds, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// Cache keeps a provider's credentials and refreshes them RefreshBefore
+// their expiry. If a refresh fails while the old credentials are still
+// valid, it keeps serving them.
+type Cache struct {
+	Provider Provider
+	// RefreshBefore defaults to DEFAULT_REFRESH_BEFORE.
+	RefreshBefore time.Duration
+	// Now defaults to time.Now.
+	Now func() time.Time
+
+	mu    sync.Mutex
+	creds *Credentials
+}
+
+func NewCache(p Provider) *Cache {
+	return &Cache{Provider: p}
+}
+
+func (c *Cache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *Cache) Retrieve(ctx context.Context) (*Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	refreshBefore := c.RefreshBefore
+	if refreshBefore == 0 {
+		refreshBefore = DEFAULT_REFRESH_BEFORE
+	}
+
+	now := c.now()
+	if c.creds != nil && (c.creds.Expiration.IsZero() || now.Add(refreshBefore).Before(c.creds.Expiration)) {
+		return c.creds, nil
+	}
+
+	creds, err := c.Provider.Retrieve(ctx)
+	if err != nil {
+		if c.creds != nil && now.Before(c.creds.Expiration) {
+			return c.creds, nil
+		}
+		return nil, err
+	}
+	c.creds = creds
+	return creds, nil
+}
+
+// Expire drops the cached credentials, e.g. after the service rejected them.
+func (c *Cache) Expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.creds = nil
+}
+
+// Options configures New. Every field is optional.
+type Options struct {
+	// AccessKeyID and AccessKeySecret are explicit credentials that take
+	// precedence over everything else.
+	AccessKeyID     string
+	AccessKeySecret string
+	SecurityToken   string
+
+	// EnvPrefixes are tried in order before DEFAULT_ENV_PREFIX, e.g.
+	// "ALIYUN_OSS" for ALIYUN_OSS_ACCESS_KEY_ID.
+	EnvPrefixes []string
+
+	// ProfilePath and ProfileName select the aliyun CLI profile; see
+	// Profile for the defaults.
+	ProfilePath string
+	ProfileName string
+
+	// RoleArn, or ALIBABA_CLOUD_ROLE_ARN, exchanges whatever the chain
+	// found for STS tokens of that role.
+	RoleArn         string
+	RoleSessionName string
+	RoleDuration    time.Duration
+	STSEndpoint     string
+}
+
+// New builds the standard chain: explicit credentials, each env prefix,
+// DEFAULT_ENV_PREFIX, the profile file, then AssumeRole when a role is
+// configured, all behind a Cache.
+func New(opts Options) *Cache {
+	chain := Chain{&Static{Credentials{
+		AccessKeyID:     opts.AccessKeyID,
+		AccessKeySecret: opts.AccessKeySecret,
+		SecurityToken:   opts.SecurityToken,
+	}}}
+	for _, prefix := range slices.Concat(opts.EnvPrefixes, []string{DEFAULT_ENV_PREFIX}) {
+		chain = append(chain, &Env{Prefix: prefix})
+	}
+	chain = append(chain, &Profile{Path: opts.ProfilePath, Name: opts.ProfileName, STSEndpoint: opts.STSEndpoint})
+
+	roleArn := opts.RoleArn
+	if roleArn == "" {
+		roleArn = os.Getenv(ENV_ROLE_ARN)
+	}
+	if roleArn == "" {
+		return NewCache(chain)
+	}
+
+	sessionName := opts.RoleSessionName
+	if sessionName == "" {
+		sessionName = os.Getenv(ENV_ROLE_SESSION_NAME)
+	}
+	return NewCache(&AssumeRole{
+		Source:      NewCache(chain),
+		RoleArn:     roleArn,
+		SessionName: sessionName,
+		Duration:    opts.RoleDuration,
+		Endpoint:    opts.STSEndpoint,
+	})
+}
+
+// OSS adapts c for oss.SetCredentialsProvider.
+func (c *Cache) OSS() oss.CredentialsProvider {
+	return ossProvider{c}
+}
+
+type ossProvider struct {
+	cache *Cache
+}
+
+// GetCredentials returns empty credentials on failure, which OSS then
+// rejects; the SDK prefers GetCredentialsE where it can report the error.
+func (p ossProvider) GetCredentials() oss.Credentials {
+	creds, err := p.cache.Retrieve(context.Background())
+	if err != nil {
+		return &Credentials{}
+	}
+	return creds
+}
+
+func (p ossProvider) GetCredentialsE() (oss.Credentials, error) {
+	creds, err := p.cache.Retrieve(context.Background())
+	if err != nil {
+		// Not creds: a nil *Credentials would make a non-nil interface.
+		return nil, err
+	}
+	return creds, nil
+}
@@ -0,0 +1,192 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// countingProvider hands out numbered credentials, failing when err is set.
+type countingProvider struct {
+	calls      int
+	expiration time.Time
+	err        error
+}
+
+func (p *countingProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Credentials{AccessKeyID: "id-" + string(rune('0'+p.calls)), AccessKeySecret: "secret", Expiration: p.expiration}, nil
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TEST_OSS_ACCESS_KEY_ID", "oss-id")
+	t.Setenv("TEST_OSS_ACCESS_KEY_SECRET", "oss-secret")
+	t.Setenv("TEST_OSS_SECURITY_TOKEN", "oss-token")
+	t.Setenv(DEFAULT_ENV_PREFIX+ENV_ACCESS_KEY_ID, "")
+	t.Setenv(DEFAULT_ENV_PREFIX+ENV_ACCESS_KEY_SECRET, "")
+	t.Setenv(ENV_ROLE_ARN, "")
+	t.Setenv(ENV_PROFILE_NAME, "")
+
+	missingProfile := filepath.Join(t.TempDir(), "config.json")
+
+	testCases := []struct {
+		name   string
+		opts   Options
+		id     string
+		source string
+	}{
+		{"Explicit wins", Options{AccessKeyID: "explicit", AccessKeySecret: "s", EnvPrefixes: []string{"TEST_OSS"}, ProfilePath: missingProfile}, "explicit", "static"},
+		{"Env prefix", Options{EnvPrefixes: []string{"TEST_MISSING", "TEST_OSS"}, ProfilePath: missingProfile}, "oss-id", "env:TEST_OSS"},
+		{"Incomplete explicit falls through", Options{AccessKeyID: "explicit", EnvPrefixes: []string{"TEST_OSS"}, ProfilePath: missingProfile}, "oss-id", "env:TEST_OSS"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			creds, err := New(tc.opts).Retrieve(ctx)
+			if err != nil {
+				t.Fatalf("Failed to retrieve: %v", err)
+			}
+			if creds.AccessKeyID != tc.id || creds.Source != tc.source {
+				t.Errorf("Retrieve() = %s from %s, want %s from %s", creds.AccessKeyID, creds.Source, tc.id, tc.source)
+			}
+		})
+	}
+
+	if _, err := New(Options{ProfilePath: missingProfile}).Retrieve(ctx); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("got %v, want ErrNoCredentials", err)
+	}
+
+	// New must not write the default prefix into the caller's spare capacity.
+	prefixes := make([]string, 1, 2)
+	prefixes[0] = "TEST_OSS"
+	New(Options{EnvPrefixes: prefixes, ProfilePath: missingProfile})
+	if spare := prefixes[:2][1]; spare != "" {
+		t.Errorf("New wrote %q into EnvPrefixes", spare)
+	}
+
+	// Errors other than ErrNoCredentials stop the chain.
+	broken := errors.New("broken")
+	chain := Chain{&countingProvider{err: broken}, &Static{Credentials{AccessKeyID: "id", AccessKeySecret: "s"}}}
+	if _, err := chain.Retrieve(ctx); !errors.Is(err, broken) {
+		t.Errorf("got %v, want the first provider's error", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	provider := &countingProvider{expiration: now.Add(time.Hour)}
+	cache := &Cache{Provider: provider, Now: func() time.Time { return now }}
+
+	for range 3 {
+		if creds, err := cache.Retrieve(ctx); err != nil || creds.AccessKeyID != "id-1" {
+			t.Fatalf("Retrieve() = %+v, %v", creds, err)
+		}
+	}
+
+	// Within RefreshBefore of expiry the credentials are refreshed.
+	now = now.Add(56 * time.Minute)
+	provider.expiration = now.Add(time.Hour)
+	if creds, _ := cache.Retrieve(ctx); creds.AccessKeyID != "id-2" {
+		t.Errorf("Expected a refresh, got %s", creds.AccessKeyID)
+	}
+
+	// A failed refresh keeps serving credentials that have not expired.
+	now = now.Add(58 * time.Minute)
+	provider.err = errors.New("sts unavailable")
+	if creds, err := cache.Retrieve(ctx); err != nil || creds.AccessKeyID != "id-2" {
+		t.Errorf("Retrieve() = %+v, %v, want the still-valid id-2", creds, err)
+	}
+
+	now = now.Add(5 * time.Minute)
+	if _, err := cache.Retrieve(ctx); err == nil {
+		t.Errorf("Expected an error once the credentials expired")
+	}
+
+	if provider.calls != 4 {
+		t.Errorf("provider called %d times, want 4", provider.calls)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{
+		"current": "default",
+		"profiles": [
+			{"name": "default", "mode": "AK", "access_key_id": "ak-id", "access_key_secret": "ak-secret"},
+			{"name": "temporary", "mode": "StsToken", "access_key_id": "sts-id", "access_key_secret": "sts-secret", "sts_token": "token"},
+			{"name": "broken", "mode": "AK"},
+			{"name": "ecs", "mode": "EcsRamRole", "access_key_id": "x", "access_key_secret": "y"}
+		]
+	}`), 0o600)
+	t.Setenv(ENV_PROFILE_NAME, "")
+
+	testCases := []struct {
+		name  string
+		id    string
+		token string
+		err   error
+	}{
+		{"", "ak-id", "", nil},
+		{"temporary", "sts-id", "token", nil},
+		{"broken", "", "", ErrProfile},
+		{"ecs", "", "", ErrProfile},
+		{"missing", "", "", ErrNoCredentials},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			creds, err := (&Profile{Path: path, Name: tc.name}).Retrieve(ctx)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("got %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil || creds.AccessKeyID != tc.id || creds.SecurityToken != tc.token {
+				t.Errorf("Retrieve() = %+v, %v", creds, err)
+			}
+		})
+	}
+
+	t.Setenv(ENV_PROFILE_NAME, "temporary")
+	if creds, err := (&Profile{Path: path}).Retrieve(ctx); err != nil || creds.AccessKeyID != "sts-id" {
+		t.Errorf("Retrieve() with %s = %+v, %v", ENV_PROFILE_NAME, creds, err)
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	cache := NewCache(&Static{Credentials{AccessKeyID: "id", AccessKeySecret: "secret", SecurityToken: "token"}})
+
+	creds := cache.OSS().GetCredentials()
+	if creds.GetAccessKeyID() != "id" || creds.GetAccessKeySecret() != "secret" || creds.GetSecurityToken() != "token" {
+		t.Errorf("Unexpected OSS credentials %+v", creds)
+	}
+
+	openapi := cache.OpenAPI()
+	id, err := openapi.GetAccessKeyId()
+	if err != nil || *id != "id" || *openapi.GetType() != CREDENTIAL_TYPE_STS {
+		t.Errorf("Unexpected OpenAPI credentials %v, %v, %s", id, err, *openapi.GetType())
+	}
+
+	empty := NewCache(Chain{})
+	if creds := empty.OSS().GetCredentials(); creds.GetAccessKeyID() != "" {
+		t.Errorf("Expected empty OSS credentials, got %+v", creds)
+	}
+	if _, err := empty.OpenAPI().GetAccessKeySecret(); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("got %v, want ErrNoCredentials", err)
+	}
+	if creds, err := empty.OSS().(oss.CredentialsProviderE).GetCredentialsE(); creds != nil || !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("GetCredentialsE() = %v, %v, want nil, ErrNoCredentials", creds, err)
+	}
+}
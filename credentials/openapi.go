@@ -0,0 +1,67 @@
+package credentials
+
+import (
+	"context"
+
+	alicredentials "github.com/aliyun/credentials-go/credentials"
+)
+
+const (
+	CREDENTIAL_TYPE_ACCESS_KEY = "access_key"
+	CREDENTIAL_TYPE_STS        = "sts"
+)
+
+// OpenAPI adapts c for openapi.Config.Credential, as used by the
+// dm-20151123 DirectMail client and the other darabonba SDKs.
+//
+// The SDK reads the key ID, secret and token with separate calls. The Cache
+// refreshes well before expiry and serves one set at a time, so the three
+// only straddle a rotation if a refresh lands between two calls.
+func (c *Cache) OpenAPI() alicredentials.Credential {
+	return openAPICredential{c}
+}
+
+type openAPICredential struct {
+	cache *Cache
+}
+
+func (o openAPICredential) retrieve() (*Credentials, error) {
+	return o.cache.Retrieve(context.Background())
+}
+
+func (o openAPICredential) GetAccessKeyId() (*string, error) {
+	creds, err := o.retrieve()
+	if err != nil {
+		return nil, err
+	}
+	return &creds.AccessKeyID, nil
+}
+
+func (o openAPICredential) GetAccessKeySecret() (*string, error) {
+	creds, err := o.retrieve()
+	if err != nil {
+		return nil, err
+	}
+	return &creds.AccessKeySecret, nil
+}
+
+func (o openAPICredential) GetSecurityToken() (*string, error) {
+	creds, err := o.retrieve()
+	if err != nil {
+		return nil, err
+	}
+	return &creds.SecurityToken, nil
+}
+
+func (o openAPICredential) GetBearerToken() *string {
+	empty := ""
+	return &empty
+}
+
+func (o openAPICredential) GetType() *string {
+	t := CREDENTIAL_TYPE_ACCESS_KEY
+	if creds, err := o.retrieve(); err == nil && creds.SecurityToken != "" {
+		t = CREDENTIAL_TYPE_STS
+	}
+	return &t
+}
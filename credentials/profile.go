@@ -0,0 +1,123 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	ENV_PROFILE_NAME = "ALIBABA_CLOUD_PROFILE"
+
+	PROFILE_MODE_AK           = "AK"
+	PROFILE_MODE_STS_TOKEN    = "StsToken"
+	PROFILE_MODE_RAM_ROLE_ARN = "RamRoleArn"
+)
+
+var ErrProfile = errors.New("credentials: invalid profile")
+
+// Profile reads a profile from the aliyun CLI config file. Path defaults
+// to ~/.aliyun/config.json; Name defaults to ALIBABA_CLOUD_PROFILE and then
+// the file's current profile. RamRoleArn profiles assume their role with
+// the profile's access key.
+type Profile struct {
+	Path        string
+	Name        string
+	STSEndpoint string
+}
+
+type profileFile struct {
+	Current  string          `json:"current"`
+	Profiles []profileConfig `json:"profiles"`
+}
+
+type profileConfig struct {
+	Name            string `json:"name"`
+	Mode            string `json:"mode"`
+	AccessKeyID     string `json:"access_key_id"`
+	AccessKeySecret string `json:"access_key_secret"`
+	StsToken        string `json:"sts_token"`
+	RamRoleArn      string `json:"ram_role_arn"`
+	RamSessionName  string `json:"ram_session_name"`
+	ExpiredSeconds  int    `json:"expired_seconds"`
+}
+
+func (p *Profile) path() (string, error) {
+	if p.Path != "" {
+		return p.Path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoCredentials, err)
+	}
+	return filepath.Join(home, ".aliyun", "config.json"), nil
+}
+
+func (p *Profile) Retrieve(ctx context.Context) (*Credentials, error) {
+	path, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCredentials, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file profileFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrProfile, path, err)
+	}
+
+	name := p.Name
+	if name == "" {
+		name = os.Getenv(ENV_PROFILE_NAME)
+	}
+	if name == "" {
+		name = file.Current
+	}
+
+	for _, profile := range file.Profiles {
+		if profile.Name == name {
+			return p.credentials(ctx, path, profile)
+		}
+	}
+	return nil, fmt.Errorf("%w: no profile %q in %s", ErrNoCredentials, name, path)
+}
+
+func (p *Profile) credentials(ctx context.Context, path string, profile profileConfig) (*Credentials, error) {
+	creds := &Credentials{
+		AccessKeyID:     profile.AccessKeyID,
+		AccessKeySecret: profile.AccessKeySecret,
+		Source:          "profile:" + profile.Name,
+	}
+	if !creds.valid() {
+		return nil, fmt.Errorf("%w: profile %q in %s has no access key", ErrProfile, profile.Name, path)
+	}
+
+	switch profile.Mode {
+	case PROFILE_MODE_AK, "":
+		return creds, nil
+	case PROFILE_MODE_STS_TOKEN:
+		creds.SecurityToken = profile.StsToken
+		return creds, nil
+	case PROFILE_MODE_RAM_ROLE_ARN:
+		role := &AssumeRole{
+			Source:      &Static{*creds},
+			RoleArn:     profile.RamRoleArn,
+			SessionName: profile.RamSessionName,
+			Duration:    time.Duration(profile.ExpiredSeconds) * time.Second,
+			Endpoint:    p.STSEndpoint,
+		}
+		return role.Retrieve(ctx)
+	default:
+		return nil, fmt.Errorf("%w: unsupported mode %q in profile %q", ErrProfile, profile.Mode, profile.Name)
+	}
+}
@@ -0,0 +1,50 @@
+package credentials
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignRPC(t *testing.T) {
+	// The example from the Aliyun RPC signature documentation.
+	values := url.Values{
+		"AccessKeyId":      {"testid"},
+		"Action":           {"DescribeRegions"},
+		"Format":           {"XML"},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureNonce":   {"3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf"},
+		"SignatureVersion": {"1.0"},
+		"Timestamp":        {"2016-02-23T12:46:24Z"},
+		"Version":          {"2014-05-26"},
+	}
+
+	if got, want := SignRPC(http.MethodGet, values, "testsecret"), "OLeaidS1JvxuMvnyHOwuJ+uX5qY="; got != want {
+		t.Errorf("SignRPC() = %s, want %s", got, want)
+	}
+}
+
+func TestRPCValues(t *testing.T) {
+	creds := &Credentials{AccessKeyID: "testid", AccessKeySecret: "testsecret", SecurityToken: "token"}
+	now := func() time.Time { return time.Date(2016, 2, 23, 20, 46, 24, 0, time.FixedZone("CST", 8*3600)) }
+
+	values := RPCValues("2014-05-26", creds, now, func() string { return "nonce" })
+	want := url.Values{
+		"AccessKeyId":      {"testid"},
+		"Format":           {"JSON"},
+		"SecurityToken":    {"token"},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureNonce":   {"nonce"},
+		"SignatureVersion": {"1.0"},
+		"Timestamp":        {"2016-02-23T12:46:24Z"},
+		"Version":          {"2014-05-26"},
+	}
+	if values.Encode() != want.Encode() {
+		t.Errorf("RPCValues() = %v, want %v", values, want)
+	}
+
+	if values := RPCValues("2014-05-26", &Credentials{AccessKeyID: "testid"}, nil, nil); values.Has("SecurityToken") || values.Get("SignatureNonce") == "" {
+		t.Errorf("Unexpected values without a token %v", values)
+	}
+}
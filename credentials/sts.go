@@ -0,0 +1,160 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_STS_ENDPOINT      = "https://sts.aliyuncs.com"
+	DEFAULT_ROLE_SESSION_NAME = "tests"
+	DEFAULT_ROLE_DURATION     = time.Hour
+	MIN_ROLE_DURATION         = 15 * time.Minute
+	STS_API_VERSION           = "2015-04-01"
+	STS_ACTION_ASSUME_ROLE    = "AssumeRole"
+)
+
+// STSError is an error response from STS.
+type STSError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+}
+
+func (e *STSError) Error() string {
+	return fmt.Sprintf("credentials: sts %d %s: %s (request %s)", e.StatusCode, e.Code, e.Message, e.RequestID)
+}
+
+// AssumeRole exchanges Source's credentials for temporary credentials of
+// RoleArn through the STS AssumeRole API. Wrap it in a Cache to refresh
+// them before they expire.
+type AssumeRole struct {
+	Source      Provider
+	RoleArn     string
+	SessionName string
+	// Duration defaults to DEFAULT_ROLE_DURATION; STS requires at least
+	// MIN_ROLE_DURATION.
+	Duration time.Duration
+	// Policy optionally narrows the role's permissions.
+	Policy     string
+	Endpoint   string
+	HTTPClient *http.Client
+	Now        func() time.Time
+	// Nonce defaults to a random hex string.
+	Nonce func() string
+}
+
+func (a *AssumeRole) Retrieve(ctx context.Context) (*Credentials, error) {
+	if a.RoleArn == "" {
+		return nil, fmt.Errorf("%w: no role ARN", ErrNoCredentials)
+	}
+	source, err := a.Source.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := a.values(source)
+	if err != nil {
+		return nil, err
+	}
+	values.Set("Signature", SignRPC(http.MethodGet, values, source.AccessKeySecret))
+
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = DEFAULT_STS_ENDPOINT
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/?"+values.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		stsErr := &STSError{StatusCode: resp.StatusCode}
+		var result struct {
+			Code      string `json:"Code"`
+			Message   string `json:"Message"`
+			RequestID string `json:"RequestId"`
+		}
+		if json.Unmarshal(body, &result) == nil {
+			stsErr.Code, stsErr.Message, stsErr.RequestID = result.Code, result.Message, result.RequestID
+		} else {
+			stsErr.Message = string(body)
+		}
+		return nil, stsErr
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string `json:"AccessKeyId"`
+			AccessKeySecret string `json:"AccessKeySecret"`
+			SecurityToken   string `json:"SecurityToken"`
+			Expiration      string `json:"Expiration"`
+		} `json:"Credentials"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("credentials: decode sts response: %w", err)
+	}
+
+	expiration, err := time.Parse(time.RFC3339, result.Credentials.Expiration)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: sts expiration: %w", err)
+	}
+	creds := &Credentials{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		AccessKeySecret: result.Credentials.AccessKeySecret,
+		SecurityToken:   result.Credentials.SecurityToken,
+		Expiration:      expiration,
+		Source:          "sts:" + a.RoleArn,
+	}
+	if !creds.valid() || creds.SecurityToken == "" {
+		return nil, errors.New("credentials: sts returned incomplete credentials")
+	}
+	return creds, nil
+}
+
+func (a *AssumeRole) values(source *Credentials) (url.Values, error) {
+	duration := a.Duration
+	if duration == 0 {
+		duration = DEFAULT_ROLE_DURATION
+	}
+	if duration < MIN_ROLE_DURATION {
+		return nil, fmt.Errorf("credentials: role duration %s is below %s", duration, MIN_ROLE_DURATION)
+	}
+
+	sessionName := a.SessionName
+	if sessionName == "" {
+		sessionName = DEFAULT_ROLE_SESSION_NAME
+	}
+
+	values := RPCValues(STS_API_VERSION, source, a.Now, a.Nonce)
+	values.Set("Action", STS_ACTION_ASSUME_ROLE)
+	values.Set("RoleArn", a.RoleArn)
+	values.Set("RoleSessionName", sessionName)
+	values.Set("DurationSeconds", strconv.Itoa(int(duration/time.Second)))
+	if a.Policy != "" {
+		values.Set("Policy", a.Policy)
+	}
+	return values, nil
+}
@@ -0,0 +1,122 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newFakeSTS answers AssumeRole for requests signed with secret.
+func newFakeSTS(t *testing.T, secret string) (*httptest.Server, *[]url.Values) {
+	t.Helper()
+
+	var requests []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		requests = append(requests, query)
+
+		if query.Get("Signature") != SignRPC(http.MethodGet, query, secret) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"Code": "SignatureDoesNotMatch", "Message": "bad signature", "RequestId": "req-1"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"RequestId": "req-2",
+			"Credentials": map[string]string{
+				"AccessKeyId":     "STS.temporary",
+				"AccessKeySecret": "temporary-secret",
+				"SecurityToken":   "security-token",
+				"Expiration":      "2024-05-01T09:00:00Z",
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestAssumeRole(t *testing.T) {
+	ctx := context.Background()
+	server, requests := newFakeSTS(t, "source-secret")
+
+	role := &AssumeRole{
+		Source:      &Static{Credentials{AccessKeyID: "source-id", AccessKeySecret: "source-secret"}},
+		RoleArn:     "acs:ram::123456789:role/oss-writer",
+		SessionName: "backup",
+		Duration:    30 * time.Minute,
+		Endpoint:    server.URL,
+		Now:         func() time.Time { return time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC) },
+		Nonce:       func() string { return "nonce" },
+	}
+
+	creds, err := role.Retrieve(ctx)
+	if err != nil {
+		t.Fatalf("Failed to assume the role: %v", err)
+	}
+	if creds.AccessKeyID != "STS.temporary" || creds.SecurityToken != "security-token" || !creds.Expiration.Equal(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected credentials %+v", creds)
+	}
+
+	query := (*requests)[0]
+	for name, want := range map[string]string{
+		"Action":          STS_ACTION_ASSUME_ROLE,
+		"RoleArn":         "acs:ram::123456789:role/oss-writer",
+		"RoleSessionName": "backup",
+		"DurationSeconds": "1800",
+		"Timestamp":       "2024-05-01T08:00:00Z",
+		"AccessKeyId":     "source-id",
+	} {
+		if query.Get(name) != want {
+			t.Errorf("%s = %q, want %q", name, query.Get(name), want)
+		}
+	}
+
+	role.Source = &Static{Credentials{AccessKeyID: "source-id", AccessKeySecret: "wrong"}}
+	var stsErr *STSError
+	if _, err := role.Retrieve(ctx); !errors.As(err, &stsErr) || stsErr.Code != "SignatureDoesNotMatch" {
+		t.Errorf("got %v, want SignatureDoesNotMatch", err)
+	}
+
+	role.Duration = time.Minute
+	if _, err := role.Retrieve(ctx); err == nil {
+		t.Errorf("Expected an error for a duration below %s", MIN_ROLE_DURATION)
+	}
+}
+
+func TestNewWithRole(t *testing.T) {
+	ctx := context.Background()
+	server, requests := newFakeSTS(t, "profile-secret")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"current": "default", "profiles": [
+		{"name": "default", "mode": "AK", "access_key_id": "profile-id", "access_key_secret": "profile-secret"},
+		{"name": "role", "mode": "RamRoleArn", "access_key_id": "profile-id", "access_key_secret": "profile-secret",
+		 "ram_role_arn": "acs:ram::123456789:role/profile", "ram_session_name": "cli", "expired_seconds": 900}
+	]}`), 0o600)
+	t.Setenv(DEFAULT_ENV_PREFIX+ENV_ACCESS_KEY_ID, "")
+	t.Setenv(ENV_PROFILE_NAME, "")
+	t.Setenv(ENV_ROLE_ARN, "")
+
+	// The profile's key assumes the configured role.
+	cache := New(Options{ProfilePath: path, RoleArn: "acs:ram::123456789:role/app", STSEndpoint: server.URL})
+	creds, err := cache.Retrieve(ctx)
+	if err != nil || creds.SecurityToken != "security-token" || (*requests)[0].Get("RoleArn") != "acs:ram::123456789:role/app" {
+		t.Fatalf("Retrieve() = %+v, %v", creds, err)
+	}
+
+	// A RamRoleArn profile assumes its own role.
+	creds, err = New(Options{ProfilePath: path, ProfileName: "role", STSEndpoint: server.URL}).Retrieve(ctx)
+	if err != nil || creds.SecurityToken != "security-token" {
+		t.Fatalf("Retrieve() = %+v, %v", creds, err)
+	}
+	if last := (*requests)[len(*requests)-1]; last.Get("RoleArn") != "acs:ram::123456789:role/profile" || last.Get("DurationSeconds") != "900" {
+		t.Errorf("Unexpected AssumeRole request %v", last)
+	}
+}
@@ -0,0 +1,462 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"tests/backmanager"
+	"tests/storage"
+)
+
+const (
+	DEFAULT_BACKUP_DIR         = "./assets/"
+	BACKUP_TIMESTAMP_LAYOUT    = "20060102T150405Z"
+	BACKUP_EXT                 = ".hwdev"
+	DEFAULT_BACKUP_CONCURRENCY = 4
+
+	BACKUP_STATUS_SAVED     = "saved"
+	BACKUP_STATUS_UNCHANGED = "unchanged"
+	BACKUP_STATUS_FAILED    = "failed"
+)
+
+var ErrInvalidInterval = errors.New("fleet: schedule interval must be positive")
+
+// Version is one stored backup of an HMI project, named
+// <timestamp>-<md5>.hwdev under a directory per HMI.
+type Version struct {
+	HMI      string
+	Time     time.Time
+	MD5      string
+	Location string
+}
+
+func (v Version) Name() string {
+	return fmt.Sprintf("%s-%s%s", v.Time.UTC().Format(BACKUP_TIMESTAMP_LAYOUT), v.MD5, BACKUP_EXT)
+}
+
+// ParseVersion parses a backup file name; ok is false for other files.
+func ParseVersion(hmi, name string) (v Version, ok bool) {
+	stamp, sum, found := strings.Cut(strings.TrimSuffix(name, BACKUP_EXT), "-")
+	if !found || !strings.HasSuffix(name, BACKUP_EXT) || len(sum) != 32 {
+		return Version{}, false
+	}
+
+	t, err := time.Parse(BACKUP_TIMESTAMP_LAYOUT, stamp)
+	if err != nil {
+		return Version{}, false
+	}
+	return Version{HMI: hmi, Time: t, MD5: sum}, true
+}
+
+// BackupStore keeps backup versions. List returns them oldest first.
+type BackupStore interface {
+	List(ctx context.Context, hmi string) ([]Version, error)
+	Save(ctx context.Context, file string, v Version) (Version, error)
+	Delete(ctx context.Context, v Version) error
+}
+
+// DirStore keeps backups in Root/<hmi>/<timestamp>-<md5>.hwdev. HMI names
+// are made safe for use as a directory name, so they cannot escape Root.
+type DirStore struct {
+	Root string
+}
+
+func (s *DirStore) List(ctx context.Context, hmi string) ([]Version, error) {
+	dir := filepath.Join(s.Root, safeName(hmi))
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for _, entry := range entries {
+		if v, ok := ParseVersion(hmi, entry.Name()); ok && entry.Type().IsRegular() {
+			v.Location = filepath.Join(dir, entry.Name())
+			versions = append(versions, v)
+		}
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// Save moves file into the store, copying when it lives on another device.
+func (s *DirStore) Save(ctx context.Context, file string, v Version) (Version, error) {
+	dir := filepath.Join(s.Root, safeName(v.HMI))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return v, err
+	}
+
+	v.Location = filepath.Join(dir, v.Name())
+	if err := os.Rename(file, v.Location); err == nil {
+		return v, nil
+	}
+	return v, copyFile(file, v.Location)
+}
+
+func (s *DirStore) Delete(ctx context.Context, v Version) error {
+	return os.Remove(v.Location)
+}
+
+// BucketStore keeps backups in an object storage bucket under
+// Prefix<hmi>/. HMI names are made safe as in DirStore, so they cannot
+// escape Prefix.
+type BucketStore struct {
+	Bucket storage.Bucket
+	Prefix string
+}
+
+func (s *BucketStore) List(ctx context.Context, hmi string) ([]Version, error) {
+	prefix := path.Join(s.Prefix, safeName(hmi)) + "/"
+
+	objects, err := s.Bucket.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for _, object := range objects {
+		if v, ok := ParseVersion(hmi, strings.TrimPrefix(object.Key, prefix)); ok {
+			v.Location = object.Key
+			versions = append(versions, v)
+		}
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+func (s *BucketStore) Save(ctx context.Context, file string, v Version) (Version, error) {
+	v.Location = path.Join(s.Prefix, safeName(v.HMI), v.Name())
+	if err := storage.PutFile(ctx, s.Bucket, v.Location, file, nil); err != nil {
+		return v, err
+	}
+	return v, os.Remove(file)
+}
+
+func (s *BucketStore) Delete(ctx context.Context, v Version) error {
+	return s.Bucket.Delete(ctx, v.Location)
+}
+
+// Retention decides which versions survive a backup. The newest version is
+// always kept.
+type Retention struct {
+	// Keep is the number of newest versions kept; zero keeps all.
+	Keep int
+	// MaxAge drops versions older than this; zero keeps them regardless.
+	MaxAge time.Duration
+}
+
+// Expired returns the versions, given oldest first, that the policy drops.
+func (r Retention) Expired(versions []Version, now time.Time) []Version {
+	var expired []Version
+	for i, v := range versions {
+		newer := len(versions) - 1 - i
+		if newer == 0 {
+			break
+		}
+		if r.Keep > 0 && newer >= r.Keep || r.MaxAge > 0 && now.Sub(v.Time) > r.MaxAge {
+			expired = append(expired, v)
+		}
+	}
+	return expired
+}
+
+// BackupTarget is one HMI to back up. Name is its directory in the store.
+type BackupTarget struct {
+	Name   string
+	Client *backmanager.Client
+}
+
+// TargetsFromInventory backs up every device seen since the given time,
+// using password for all of them.
+func TargetsFromInventory(ctx context.Context, inv *Inventory, since time.Time, password string) ([]BackupTarget, error) {
+	devices, err := inv.Devices(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]BackupTarget, len(devices))
+	for i, d := range devices {
+		client := d.Client()
+		client.Password = password
+		targets[i] = BackupTarget{Name: d.Host, Client: client}
+	}
+	return targets, nil
+}
+
+// BackupJob pulls the project off every target and stores a new version
+// when its MD5 differs from the newest stored one.
+type BackupJob struct {
+	Store     BackupStore
+	Retention Retention
+
+	// CutSize is the transfer chunk size, backmanager.DEFAULT_CUT_SIZE if
+	// zero.
+	CutSize int64
+	// Upload tunes each transfer.
+	Upload *backmanager.UploadOptions
+	// Concurrency bounds the HMIs backed up at once,
+	// DEFAULT_BACKUP_CONCURRENCY if zero.
+	Concurrency int
+	// TempDir holds transfers in progress, os.TempDir() if empty.
+	TempDir string
+
+	Now func() time.Time
+}
+
+// BackupResult is the outcome for one HMI.
+type BackupResult struct {
+	HMI      string
+	Status   string
+	Version  Version
+	Pruned   []Version
+	Err      error
+	Duration time.Duration
+}
+
+// BackupReport is the outcome of one run, with results in target order.
+type BackupReport struct {
+	Started  time.Time
+	Finished time.Time
+	Results  []BackupResult
+}
+
+func (r *BackupReport) Failed() []BackupResult {
+	var failed []BackupResult
+	for _, result := range r.Results {
+		if result.Status == BACKUP_STATUS_FAILED {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// WriteText writes one line per HMI followed by a summary.
+func (r *BackupReport) WriteText(w io.Writer) error {
+	var sb strings.Builder
+	counts := make(map[string]int)
+	for _, result := range r.Results {
+		counts[result.Status]++
+
+		fmt.Fprintf(&sb, "%-20s %-9s", result.HMI, result.Status)
+		if result.Err != nil {
+			fmt.Fprintf(&sb, " %v", result.Err)
+		} else {
+			fmt.Fprintf(&sb, " %s", result.Version.Location)
+		}
+		if len(result.Pruned) > 0 {
+			fmt.Fprintf(&sb, " (pruned %d)", len(result.Pruned))
+		}
+		fmt.Fprintf(&sb, " %s\n", result.Duration.Round(time.Millisecond))
+	}
+
+	fmt.Fprintf(&sb, "%d saved, %d unchanged, %d failed in %s\n",
+		counts[BACKUP_STATUS_SAVED], counts[BACKUP_STATUS_UNCHANGED], counts[BACKUP_STATUS_FAILED],
+		r.Finished.Sub(r.Started).Round(time.Millisecond))
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Run backs up every target. A failing or panicking HMI is recorded in the
+// report and does not affect the others.
+func (j *BackupJob) Run(ctx context.Context, targets []BackupTarget) *BackupReport {
+	concurrency := j.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_BACKUP_CONCURRENCY
+	}
+
+	report := &BackupReport{Started: j.now(), Results: make([]BackupResult, len(targets))}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			report.Results[i] = j.backupIsolated(ctx, target)
+		}()
+	}
+	wg.Wait()
+
+	report.Finished = j.now()
+	return report
+}
+
+// Schedule runs the job every interval until ctx is done, resolving the
+// targets afresh each time so that newly discovered HMIs are picked up.
+// onReport, if set, is called after every run. Schedule returns ctx's error
+// once it is done, or ErrInvalidInterval without running.
+func (j *BackupJob) Schedule(ctx context.Context, interval time.Duration, targets func(context.Context) ([]BackupTarget, error), onReport func(*BackupReport, error)) error {
+	if interval <= 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidInterval, interval)
+	}
+	if onReport == nil {
+		onReport = func(*BackupReport, error) {}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		list, err := targets(ctx)
+		if err != nil {
+			onReport(nil, err)
+		} else {
+			onReport(j.Run(ctx, list), nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *BackupJob) backupIsolated(ctx context.Context, target BackupTarget) (result BackupResult) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			result = BackupResult{HMI: target.Name, Status: BACKUP_STATUS_FAILED, Err: fmt.Errorf("fleet: panic: %v", r)}
+		}
+		result.Duration = time.Since(start)
+	}()
+
+	result, err := j.backup(ctx, target)
+	if err != nil {
+		result.Status = BACKUP_STATUS_FAILED
+		result.Err = err
+	}
+	return result
+}
+
+func (j *BackupJob) backup(ctx context.Context, target BackupTarget) (BackupResult, error) {
+	result := BackupResult{HMI: target.Name}
+
+	info, err := target.Client.GetHmiInfo(ctx)
+	if err != nil {
+		return result, err
+	}
+	if err := info.CheckUploadPermission(); err != nil {
+		return result, err
+	}
+
+	cutSize := j.CutSize
+	if cutSize <= 0 {
+		cutSize = backmanager.DEFAULT_CUT_SIZE
+	}
+	count, err := target.Client.GetFileCount(ctx, cutSize)
+	if err != nil {
+		return result, err
+	}
+
+	versions, err := j.Store.List(ctx, target.Name)
+	if err != nil {
+		return result, fmt.Errorf("list backups: %w", err)
+	}
+
+	if n := len(versions); n > 0 && versions[n-1].MD5 == count.MD5 {
+		result.Status = BACKUP_STATUS_UNCHANGED
+		result.Version = versions[n-1]
+	} else {
+		v := Version{HMI: target.Name, Time: j.now(), MD5: count.MD5}
+
+		// The part file is named after the MD5, so an interrupted backup
+		// resumes on the next run.
+		tempDir := j.TempDir
+		if tempDir == "" {
+			tempDir = os.TempDir()
+		}
+		file := filepath.Join(tempDir, fmt.Sprintf("fleet-%s-%s%s", safeName(target.Name), count.MD5, BACKUP_EXT))
+		if err := target.Client.SaveProject(ctx, file, count, j.Upload); err != nil {
+			return result, err
+		}
+
+		if v, err = j.Store.Save(ctx, file, v); err != nil {
+			os.Remove(file)
+			return result, fmt.Errorf("store backup: %w", err)
+		}
+
+		result.Status = BACKUP_STATUS_SAVED
+		result.Version = v
+		versions = append(versions, v)
+	}
+
+	for _, v := range j.Retention.Expired(versions, j.now()) {
+		if err := j.Store.Delete(ctx, v); err != nil {
+			return result, fmt.Errorf("prune %s: %w", v.Location, err)
+		}
+		result.Pruned = append(result.Pruned, v)
+	}
+
+	return result, nil
+}
+
+func (j *BackupJob) now() time.Time {
+	if j.Now != nil {
+		return j.Now()
+	}
+	return time.Now()
+}
+
+func sortVersions(versions []Version) {
+	slices.SortFunc(versions, func(a, b Version) int {
+		return a.Time.Compare(b.Time)
+	})
+}
+
+func safeName(name string) string {
+	switch name {
+	case "", ".", "..":
+		// These name the store or its parent rather than a directory in it.
+		return strings.Repeat("_", max(len(name), 1))
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
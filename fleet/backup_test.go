@@ -0,0 +1,252 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"tests/backmanager"
+	"tests/backmanager/backmanagertest"
+	"tests/storage"
+)
+
+func newBackupTarget(t *testing.T, name string, project string) (BackupTarget, *backmanagertest.Server) {
+	t.Helper()
+
+	hmi := backmanagertest.NewServer()
+	t.Cleanup(hmi.Close)
+	hmi.SetProject([]byte(project))
+	return BackupTarget{Name: name, Client: hmi.Client()}, hmi
+}
+
+func TestBackupJob(t *testing.T) {
+	ctx := context.Background()
+	store := &DirStore{Root: t.TempDir()}
+
+	target, hmi := newBackupTarget(t, "hmi-a", "project v1")
+	denied, deniedHmi := newBackupTarget(t, "hmi-denied", "secret")
+	deniedHmi.SetInfo(backmanager.FIELD_UPLOAD_PRJ_PERMIT, 0)
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer empty.Close()
+	u, _ := url.Parse(empty.URL)
+	emptyClient := backmanager.NewClient(u.Hostname())
+	emptyClient.UpdatePort, _ = strconv.Atoi(u.Port())
+	targets := []BackupTarget{target, denied, {Name: "hmi-empty", Client: emptyClient}, {Name: "hmi-nil"}}
+
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	job := &BackupJob{
+		Store:     store,
+		Retention: Retention{Keep: 2},
+		CutSize:   4,
+		TempDir:   t.TempDir(),
+		Now:       func() time.Time { return now },
+	}
+
+	report := job.Run(ctx, targets)
+	statuses := []string{}
+	for _, result := range report.Results {
+		statuses = append(statuses, result.Status)
+	}
+	if want := []string{BACKUP_STATUS_SAVED, BACKUP_STATUS_FAILED, BACKUP_STATUS_FAILED, BACKUP_STATUS_FAILED}; strings.Join(statuses, ",") != strings.Join(want, ",") {
+		t.Fatalf("Statuses %v, want %v", statuses, want)
+	}
+	if len(report.Failed()) != 3 || !strings.Contains(report.Results[3].Err.Error(), "panic") {
+		t.Errorf("Unexpected failures %+v", report.Failed())
+	}
+
+	first := report.Results[0].Version
+	if want := store.Root + "/hmi-a/20240501T080000Z-" + md5Hex("project v1") + ".hwdev"; first.Location != want {
+		t.Errorf("Stored at %s, want %s", first.Location, want)
+	}
+	if saved, _ := os.ReadFile(first.Location); !bytes.Equal(saved, []byte("project v1")) {
+		t.Errorf("Stored backup does not match")
+	}
+
+	// An unchanged project is skipped.
+	now = now.Add(time.Hour)
+	report = job.Run(ctx, targets[:1])
+	if report.Results[0].Status != BACKUP_STATUS_UNCHANGED || report.Results[0].Version.Location != first.Location {
+		t.Errorf("Unexpected result for an unchanged project %+v", report.Results[0])
+	}
+
+	// Two more changes push the first version out with Keep: 2.
+	for _, project := range []string{"project v2", "project v3"} {
+		hmi.SetProject([]byte(project))
+		now = now.Add(time.Hour)
+		report = job.Run(ctx, targets[:1])
+		if report.Results[0].Status != BACKUP_STATUS_SAVED {
+			t.Fatalf("Failed to back up %s: %v", project, report.Results[0].Err)
+		}
+	}
+
+	versions, err := store.List(ctx, "hmi-a")
+	if err != nil || len(versions) != 2 || versions[0].MD5 != md5Hex("project v2") || versions[1].MD5 != md5Hex("project v3") {
+		t.Fatalf("Versions after retention %+v (%v)", versions, err)
+	}
+	if len(report.Results[0].Pruned) != 1 || report.Results[0].Pruned[0].MD5 != md5Hex("project v1") {
+		t.Errorf("Unexpected pruned versions %+v", report.Results[0].Pruned)
+	}
+
+	var text bytes.Buffer
+	report.WriteText(&text)
+	if !strings.Contains(text.String(), "1 saved, 0 unchanged, 0 failed") {
+		t.Errorf("Unexpected report:\n%s", text.String())
+	}
+}
+
+func TestBucketStore(t *testing.T) {
+	ctx := context.Background()
+	bucket := storage.NewMemoryBucket()
+	store := &BucketStore{Bucket: bucket, Prefix: "backups"}
+
+	v := Version{HMI: "hmi-a", Time: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), MD5: md5Hex("project")}
+	file := filepath.Join(t.TempDir(), "project.hwdev")
+	os.WriteFile(file, []byte("project"), 0o644)
+
+	saved, err := store.Save(ctx, file, v)
+	if err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if want := "backups/hmi-a/" + v.Name(); saved.Location != want {
+		t.Errorf("Stored at %s, want %s", saved.Location, want)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("The uploaded file should be removed")
+	}
+
+	bucket.Put(ctx, "backups/hmi-a/notes.txt", strings.NewReader("ignored"), nil)
+	versions, err := store.List(ctx, "hmi-a")
+	if err != nil || len(versions) != 1 || versions[0].Location != saved.Location {
+		t.Fatalf("List() = %+v (%v)", versions, err)
+	}
+
+	if err := store.Delete(ctx, saved); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if versions, _ := store.List(ctx, "hmi-a"); len(versions) != 0 {
+		t.Errorf("Versions after delete %+v", versions)
+	}
+}
+
+func TestDirStoreNames(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "backups")
+	store := &DirStore{Root: root}
+
+	for _, hmi := range []string{"..", "../escape", "192.168.22.160:81", ""} {
+		v := Version{HMI: hmi, Time: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), MD5: md5Hex("project")}
+		file := filepath.Join(t.TempDir(), "project.hwdev")
+		os.WriteFile(file, []byte("project"), 0o644)
+
+		saved, err := store.Save(ctx, file, v)
+		if err != nil {
+			t.Fatalf("Failed to save %q: %v", hmi, err)
+		}
+		if dir := filepath.Dir(filepath.Dir(saved.Location)); dir != root {
+			t.Errorf("%q stored at %s, outside %s", hmi, saved.Location, root)
+		}
+		if versions, err := store.List(ctx, hmi); err != nil || len(versions) != 1 || versions[0].Location != saved.Location {
+			t.Errorf("List(%q) = %+v (%v)", hmi, versions, err)
+		}
+	}
+}
+
+func TestBackupJobSchedule(t *testing.T) {
+	job := &BackupJob{Store: &DirStore{Root: t.TempDir()}}
+	targets := func(context.Context) ([]BackupTarget, error) { return nil, nil }
+
+	if err := job.Schedule(context.Background(), 0, targets, nil); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("got %v, want ErrInvalidInterval", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := job.Schedule(ctx, time.Hour, targets, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestBucketStoreNames(t *testing.T) {
+	ctx := context.Background()
+	bucket := storage.NewMemoryBucket()
+	store := &BucketStore{Bucket: bucket, Prefix: "backups/hmi"}
+
+	for _, hmi := range []string{"..", "../other", ""} {
+		v := Version{HMI: hmi, Time: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), MD5: md5Hex("project")}
+		file := filepath.Join(t.TempDir(), "project.hwdev")
+		os.WriteFile(file, []byte("project"), 0o644)
+
+		saved, err := store.Save(ctx, file, v)
+		if err != nil {
+			t.Fatalf("Failed to save %q: %v", hmi, err)
+		}
+		if dir := path.Dir(path.Dir(saved.Location)); dir != store.Prefix {
+			t.Errorf("%q stored at %s, outside %s", hmi, saved.Location, store.Prefix)
+		}
+		if versions, err := store.List(ctx, hmi); err != nil || len(versions) != 1 || versions[0].Location != saved.Location {
+			t.Errorf("List(%q) = %+v (%v)", hmi, versions, err)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	var versions []Version
+	for day := 1; day <= 5; day++ {
+		versions = append(versions, Version{MD5: strconv.Itoa(day), Time: now.AddDate(0, 0, day-6)})
+	}
+
+	testCases := []struct {
+		name      string
+		retention Retention
+		expired   string
+	}{
+		{"Keep all", Retention{}, ""},
+		{"Keep 3", Retention{Keep: 3}, "12"},
+		{"Max age", Retention{MaxAge: 72 * time.Hour}, "12"},
+		{"Newest always kept", Retention{MaxAge: time.Hour}, "1234"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expired string
+			for _, v := range tc.retention.Expired(versions, now) {
+				expired += v.MD5
+			}
+			if expired != tc.expired {
+				t.Errorf("Expired() = %q, want %q", expired, tc.expired)
+			}
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v := Version{HMI: "hmi", Time: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), MD5: md5Hex("x")}
+	parsed, ok := ParseVersion("hmi", v.Name())
+	if !ok || !parsed.Time.Equal(v.Time) || parsed.MD5 != v.MD5 {
+		t.Errorf("ParseVersion(%s) = %+v, %v", v.Name(), parsed, ok)
+	}
+
+	for _, name := range []string{"notes.txt", "20240501T080000Z-short.hwdev", "yesterday-" + md5Hex("x") + ".hwdev"} {
+		if _, ok := ParseVersion("hmi", name); ok {
+			t.Errorf("ParseVersion(%s) should fail", name)
+		}
+	}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,227 @@
+// Package fleet manages many Haiwell HMIs at once: it finds them on the LAN,
+// keeps an inventory of what it found and drives fleet-wide jobs from it.
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"tests/backmanager"
+)
+
+const (
+	DEFAULT_PROBE_TIMEOUT     = 500 * time.Millisecond
+	DEFAULT_SCAN_CONCURRENCY  = 64
+	MAX_SCAN_HOSTS            = 1 << 16
+	DEFAULT_INVENTORY_DB_PATH = "./assets/inventory.db"
+)
+
+var ErrScanTooLarge = errors.New("fleet: scan range too large")
+
+// DefaultModelFields and DefaultFirmwareFields are the getHmiInfo fields
+// tried, in order, for a device's model and firmware version.
+var (
+	DefaultModelFields    = []string{"model", "hmiModel", "type"}
+	DefaultFirmwareFields = []string{"firmware", "version", "fwVersion", "sysVersion"}
+)
+
+// Device is an HMI that answered /update/getHmiInfo.
+type Device struct {
+	Host string
+	// UpdatePort and UonlinePort are the ports the device was found on,
+	// the backmanager defaults if zero.
+	UpdatePort        int
+	UonlinePort       int
+	Model             string
+	Firmware          string
+	LoadPwdState      int
+	UploadPrjPermit   int
+	DownloadPrjPermit int
+	// Info is the raw getHmiInfo response.
+	Info      json.RawMessage
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// Client returns a backmanager client for the device on its ports.
+func (d *Device) Client() *backmanager.Client {
+	client := backmanager.NewClient(d.Host)
+	if d.UpdatePort != 0 {
+		client.UpdatePort = d.UpdatePort
+	}
+	if d.UonlinePort != 0 {
+		client.UonlinePort = d.UonlinePort
+	}
+	return client
+}
+
+// Scanner probes every address of a range for an HMI update service.
+type Scanner struct {
+	// UpdatePort is the port probed, backmanager.DEFAULT_UPDATE_PORT if zero.
+	UpdatePort int
+	// UonlinePort is recorded for the devices found, not probed,
+	// backmanager.DEFAULT_UONLINE_PORT if zero.
+	UonlinePort int
+	// Timeout bounds each probe, DEFAULT_PROBE_TIMEOUT if zero.
+	Timeout time.Duration
+	// Concurrency bounds the probes in flight, DEFAULT_SCAN_CONCURRENCY if
+	// zero.
+	Concurrency int
+
+	ModelFields    []string
+	FirmwareFields []string
+
+	HTTPClient *http.Client
+}
+
+// Scan probes every host address in cidr, e.g. 192.168.22.0/24, and returns
+// the HMIs that answered, ordered by address. Addresses that do not answer
+// are skipped silently; only a cancelled ctx or a bad range fails the scan.
+func (s *Scanner) Scan(ctx context.Context, cidr string) ([]Device, error) {
+	hosts, err := Hosts(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_SCAN_CONCURRENCY
+	}
+
+	var (
+		mu      sync.Mutex
+		devices []Device
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, concurrency)
+	)
+	for _, host := range hosts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+
+			device, err := s.Probe(ctx, host.String())
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			devices = append(devices, *device)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(devices, func(a, b Device) int {
+		return netip.MustParseAddr(a.Host).Compare(netip.MustParseAddr(b.Host))
+	})
+	return devices, nil
+}
+
+// Probe asks a single host for its HMI info.
+func (s *Scanner) Probe(ctx context.Context, host string) (*Device, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_PROBE_TIMEOUT
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := backmanager.NewClient(host)
+	client.HTTPClient = s.HTTPClient
+	if s.UpdatePort != 0 {
+		client.UpdatePort = s.UpdatePort
+	}
+	if s.UonlinePort != 0 {
+		client.UonlinePort = s.UonlinePort
+	}
+
+	info, err := client.GetHmiInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(info.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Device{
+		Host:              host,
+		UpdatePort:        client.UpdatePort,
+		UonlinePort:       client.UonlinePort,
+		Model:             firstField(info, s.ModelFields, DefaultModelFields),
+		Firmware:          firstField(info, s.FirmwareFields, DefaultFirmwareFields),
+		LoadPwdState:      info.LoadPwdState,
+		UploadPrjPermit:   info.UploadPrjPermit,
+		DownloadPrjPermit: info.DownloadPrjPermit,
+		Info:              raw,
+		FirstSeen:         now,
+		LastSeen:          now,
+	}, nil
+}
+
+// Hosts lists the host addresses of cidr. For IPv4 ranges wider than /31
+// the network and broadcast addresses are left out.
+func Hosts(cidr string) ([]netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("fleet: %w", err)
+	}
+	prefix = prefix.Masked()
+
+	if bits := prefix.Addr().BitLen() - prefix.Bits(); bits > 16 {
+		return nil, fmt.Errorf("%w: %s has more than %d addresses", ErrScanTooLarge, cidr, MAX_SCAN_HOSTS)
+	}
+
+	var hosts []netip.Addr
+	for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr)
+	}
+
+	if prefix.Addr().Is4() && prefix.Bits() < 31 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+func firstField(info *backmanager.HmiInfo, fields, defaults []string) string {
+	if len(fields) == 0 {
+		fields = defaults
+	}
+
+	for _, field := range fields {
+		raw, ok := info.Fields[field]
+		if !ok {
+			continue
+		}
+
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err == nil {
+			return n.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tests/backmanager/backmanagertest"
+)
+
+func TestHosts(t *testing.T) {
+	testCases := []struct {
+		cidr  string
+		first string
+		last  string
+		count int
+	}{
+		{"192.168.22.0/24", "192.168.22.1", "192.168.22.254", 254},
+		{"192.168.22.23/32", "192.168.22.23", "192.168.22.23", 1},
+		{"10.0.0.0/31", "10.0.0.0", "10.0.0.1", 2},
+		{"192.168.22.77/30", "192.168.22.77", "192.168.22.78", 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cidr, func(t *testing.T) {
+			hosts, err := Hosts(tc.cidr)
+			if err != nil {
+				t.Fatalf("Hosts(%s) failed: %v", tc.cidr, err)
+			}
+			if len(hosts) != tc.count || hosts[0].String() != tc.first || hosts[len(hosts)-1].String() != tc.last {
+				t.Errorf("Hosts(%s) = %d hosts %v..%v", tc.cidr, len(hosts), hosts[0], hosts[len(hosts)-1])
+			}
+		})
+	}
+
+	if _, err := Hosts("10.0.0.0/8"); !errors.Is(err, ErrScanTooLarge) {
+		t.Errorf("got %v, want ErrScanTooLarge", err)
+	}
+	if _, err := Hosts("not a range"); err == nil {
+		t.Errorf("Expected an error for an invalid range")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	ctx := context.Background()
+	hmi := backmanagertest.NewServer()
+	defer hmi.Close()
+	hmi.SetInfo("model", "C7S-W")
+	hmi.SetInfo("version", "3.40.0.14")
+
+	// "?" and "#" would end the path part of an unescaped DSN.
+	path := filepath.Join(t.TempDir(), "inventory #1?.db")
+	inv, err := OpenInventory(ctx, path)
+	if err != nil {
+		t.Fatalf("Failed to open the inventory: %v", err)
+	}
+	defer inv.Close()
+
+	// 127.0.0.1 answers; 127.0.0.2 is loopback too but has no listener.
+	scanner := &Scanner{UpdatePort: hmi.Port(), UonlinePort: hmi.Port(), Timeout: time.Second}
+	found, err := inv.Discover(ctx, scanner, "127.0.0.0/30")
+	if err != nil {
+		t.Fatalf("Failed to discover: %v", err)
+	}
+	if len(found) != 1 || found[0].Host != "127.0.0.1" || found[0].Model != "C7S-W" || found[0].Firmware != "3.40.0.14" || found[0].UploadPrjPermit != 1 {
+		t.Fatalf("Unexpected devices %+v", found)
+	}
+
+	firstSeen := found[0].FirstSeen
+	later := found[0]
+	later.Firmware = "3.40.0.15"
+	later.FirstSeen = firstSeen.Add(time.Hour)
+	later.LastSeen = firstSeen.Add(time.Hour)
+	if err := inv.Record(ctx, later); err != nil {
+		t.Fatalf("Failed to record: %v", err)
+	}
+
+	d, err := inv.Device(ctx, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Failed to look up the device: %v", err)
+	}
+	if d.Firmware != "3.40.0.15" || d.FirstSeen.Unix() != firstSeen.Unix() || d.LastSeen.Unix() != later.LastSeen.Unix() {
+		t.Errorf("Unexpected device after refresh %+v", d)
+	}
+	if d.UpdatePort != hmi.Port() || d.UonlinePort != hmi.Port() {
+		t.Errorf("got ports %d/%d, want %d", d.UpdatePort, d.UonlinePort, hmi.Port())
+	}
+	if _, err := d.Client().GetFileCount(ctx, 1024); err != nil {
+		t.Errorf("Failed to reach the recorded device: %v", err)
+	}
+	var info map[string]any
+	if err := json.Unmarshal(d.Info, &info); err != nil || info["model"] != "C7S-W" {
+		t.Errorf("Unexpected raw info %s (%v)", d.Info, err)
+	}
+
+	devices, err := inv.Devices(ctx, later.LastSeen.Add(time.Second))
+	if err != nil || len(devices) != 0 {
+		t.Errorf("Devices(since) = %+v (%v), want none", devices, err)
+	}
+
+	if err := inv.Remove(ctx, "127.0.0.1"); err != nil {
+		t.Fatalf("Failed to remove the device: %v", err)
+	}
+	if _, err := inv.Device(ctx, "127.0.0.1"); !errors.Is(err, ErrUnknownDevice) {
+		t.Errorf("got %v, want ErrUnknownDevice", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Inventory not created at %s: %v", path, err)
+	}
+}
@@ -0,0 +1,177 @@
+package fleet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var ErrUnknownDevice = errors.New("fleet: unknown device")
+
+const inventorySchema = `
+CREATE TABLE IF NOT EXISTS hmi (
+	host                TEXT PRIMARY KEY,
+	update_port         INTEGER NOT NULL DEFAULT 0,
+	uonline_port        INTEGER NOT NULL DEFAULT 0,
+	model               TEXT NOT NULL DEFAULT '',
+	firmware            TEXT NOT NULL DEFAULT '',
+	load_pwd_state      INTEGER NOT NULL DEFAULT 0,
+	upload_prj_permit   INTEGER NOT NULL DEFAULT 0,
+	download_prj_permit INTEGER NOT NULL DEFAULT 0,
+	info                TEXT NOT NULL DEFAULT '{}',
+	first_seen          INTEGER NOT NULL,
+	last_seen           INTEGER NOT NULL
+)`
+
+// Inventory is a SQLite record of every HMI ever discovered. Timestamps are
+// stored as Unix seconds.
+type Inventory struct {
+	db *sql.DB
+}
+
+// OpenInventory opens or creates the inventory database at path.
+func OpenInventory(ctx context.Context, path string) (*Inventory, error) {
+	db, err := sql.Open("sqlite3", "file:"+url.PathEscape(path)+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.ExecContext(ctx, inventorySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("fleet: create inventory: %w", err)
+	}
+
+	return &Inventory{db: db}, nil
+}
+
+func (inv *Inventory) Close() error {
+	return inv.db.Close()
+}
+
+// Record inserts or refreshes devices. A device seen before keeps its
+// first-seen time; everything else is overwritten with the latest probe.
+func (inv *Inventory) Record(ctx context.Context, devices ...Device) error {
+	tx, err := inv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, d := range devices {
+		info := string(d.Info)
+		if info == "" {
+			info = "{}"
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO hmi (host, update_port, uonline_port, model, firmware, load_pwd_state, upload_prj_permit, download_prj_permit, info, first_seen, last_seen)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (host) DO UPDATE SET
+				update_port = excluded.update_port,
+				uonline_port = excluded.uonline_port,
+				model = excluded.model,
+				firmware = excluded.firmware,
+				load_pwd_state = excluded.load_pwd_state,
+				upload_prj_permit = excluded.upload_prj_permit,
+				download_prj_permit = excluded.download_prj_permit,
+				info = excluded.info,
+				last_seen = excluded.last_seen`,
+			d.Host, d.UpdatePort, d.UonlinePort, d.Model, d.Firmware, d.LoadPwdState, d.UploadPrjPermit, d.DownloadPrjPermit,
+			info, d.FirstSeen.Unix(), d.LastSeen.Unix())
+		if err != nil {
+			return fmt.Errorf("fleet: record %s: %w", d.Host, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Devices lists the inventory ordered by host. With a non-zero since, only
+// devices seen at or after it are returned.
+func (inv *Inventory) Devices(ctx context.Context, since time.Time) ([]Device, error) {
+	var after int64
+	if !since.IsZero() {
+		after = since.Unix()
+	}
+
+	rows, err := inv.db.QueryContext(ctx, `
+		SELECT host, update_port, uonline_port, model, firmware, load_pwd_state, upload_prj_permit, download_prj_permit, info, first_seen, last_seen
+		FROM hmi WHERE last_seen >= ? ORDER BY host`, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []Device
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *d)
+	}
+
+	return devices, rows.Err()
+}
+
+// Device looks up a single host, returning ErrUnknownDevice if it was never
+// recorded.
+func (inv *Inventory) Device(ctx context.Context, host string) (*Device, error) {
+	row := inv.db.QueryRowContext(ctx, `
+		SELECT host, update_port, uonline_port, model, firmware, load_pwd_state, upload_prj_permit, download_prj_permit, info, first_seen, last_seen
+		FROM hmi WHERE host = ?`, host)
+
+	d, err := scanDevice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDevice, host)
+	}
+	return d, err
+}
+
+func (inv *Inventory) Remove(ctx context.Context, host string) error {
+	_, err := inv.db.ExecContext(ctx, "DELETE FROM hmi WHERE host = ?", host)
+	return err
+}
+
+// Discover scans every range with scanner and records what it finds.
+func (inv *Inventory) Discover(ctx context.Context, scanner *Scanner, cidrs ...string) ([]Device, error) {
+	var found []Device
+	for _, cidr := range cidrs {
+		devices, err := scanner.Scan(ctx, cidr)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, devices...)
+	}
+
+	if err := inv.Record(ctx, found...); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDevice(row rowScanner) (*Device, error) {
+	var (
+		d                   Device
+		info                string
+		firstSeen, lastSeen int64
+	)
+	err := row.Scan(&d.Host, &d.UpdatePort, &d.UonlinePort, &d.Model, &d.Firmware, &d.LoadPwdState, &d.UploadPrjPermit, &d.DownloadPrjPermit, &info, &firstSeen, &lastSeen)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Info = []byte(info)
+	d.FirstSeen = time.Unix(firstSeen, 0)
+	d.LastSeen = time.Unix(lastSeen, 0)
+	return &d, nil
+}
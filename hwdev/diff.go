@@ -0,0 +1,276 @@
+package hwdev
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	CHANGE_ADDED    = "added"
+	CHANGE_REMOVED  = "removed"
+	CHANGE_MODIFIED = "modified"
+)
+
+// Report lists what changed between two projects, table by table. Tables
+// without changes are left out.
+type Report struct {
+	Old    string      `json:"old"`
+	New    string      `json:"new"`
+	Tables []TableDiff `json:"tables"`
+}
+
+// TableDiff is the change to one table. Change is set when the whole table
+// was added or removed; Rows then lists every row.
+type TableDiff struct {
+	Table          string      `json:"table"`
+	Change         string      `json:"change,omitempty"`
+	AddedColumns   []string    `json:"added_columns,omitempty"`
+	RemovedColumns []string    `json:"removed_columns,omitempty"`
+	Rows           []RowChange `json:"rows,omitempty"`
+}
+
+// RowChange is one added, removed or modified row. Rows are matched by
+// primary key, or by their full content in tables without one. Label is the
+// row's name column, when it has one.
+type RowChange struct {
+	Change string            `json:"change"`
+	Key    string            `json:"key"`
+	Label  string            `json:"label,omitempty"`
+	Old    map[string]string `json:"old,omitempty"`
+	New    map[string]string `json:"new,omitempty"`
+	Fields []string          `json:"fields,omitempty"`
+}
+
+func (r *Report) Empty() bool {
+	return len(r.Tables) == 0
+}
+
+// Diff compares every table of two projects.
+func Diff(ctx context.Context, old, new *Project) (*Report, error) {
+	oldTables, err := old.Tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newTables, err := new.Tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := slices.Concat(oldTables, newTables)
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	report := &Report{Old: old.Path, New: new.Path}
+	for _, name := range names {
+		var oldTable, newTable *Table
+		if slices.Contains(oldTables, name) {
+			if oldTable, err = old.Table(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+		if slices.Contains(newTables, name) {
+			if newTable, err = new.Table(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+
+		if diff := DiffTables(oldTable, newTable); diff != nil {
+			report.Tables = append(report.Tables, *diff)
+		}
+	}
+
+	return report, nil
+}
+
+// DiffTables compares two versions of a table, either of which may be nil
+// when the table exists on one side only. It returns nil when they match.
+func DiffTables(old, new *Table) *TableDiff {
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil:
+		return &TableDiff{Table: new.Name, Change: CHANGE_ADDED, Rows: rowChanges(CHANGE_ADDED, new)}
+	case new == nil:
+		return &TableDiff{Table: old.Name, Change: CHANGE_REMOVED, Rows: rowChanges(CHANGE_REMOVED, old)}
+	}
+
+	diff := &TableDiff{Table: new.Name}
+	for _, column := range new.Columns {
+		if !slices.Contains(old.Columns, column) {
+			diff.AddedColumns = append(diff.AddedColumns, column)
+		}
+	}
+	for _, column := range old.Columns {
+		if !slices.Contains(new.Columns, column) {
+			diff.RemovedColumns = append(diff.RemovedColumns, column)
+		}
+	}
+
+	// Match by the new primary key; if the key changed, fall back to content.
+	keyColumns := new.PrimaryKey
+	if !slices.Equal(old.PrimaryKey, new.PrimaryKey) {
+		keyColumns = nil
+	}
+
+	oldRows := indexRows(old, keyColumns)
+	newRows := indexRows(new, keyColumns)
+
+	for _, key := range sortedKeys(oldRows, newRows) {
+		o, inOld := oldRows[key]
+		n, inNew := newRows[key]
+
+		switch {
+		case !inOld:
+			diff.Rows = append(diff.Rows, RowChange{Change: CHANGE_ADDED, Key: key, Label: n["name"], New: n})
+		case !inNew:
+			diff.Rows = append(diff.Rows, RowChange{Change: CHANGE_REMOVED, Key: key, Label: o["name"], Old: o})
+		default:
+			if fields := changedFields(o, n); len(fields) > 0 {
+				diff.Rows = append(diff.Rows, RowChange{Change: CHANGE_MODIFIED, Key: key, Label: n["name"], Old: o, New: n, Fields: fields})
+			}
+		}
+	}
+
+	if len(diff.AddedColumns) == 0 && len(diff.RemovedColumns) == 0 && len(diff.Rows) == 0 {
+		return nil
+	}
+	return diff
+}
+
+func rowChanges(change string, table *Table) []RowChange {
+	var changes []RowChange
+	rows := indexRows(table, table.PrimaryKey)
+	for _, key := range sortedKeys(rows) {
+		c := RowChange{Change: change, Key: key, Label: rows[key]["name"]}
+		if change == CHANGE_ADDED {
+			c.New = rows[key]
+		} else {
+			c.Old = rows[key]
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// indexRows renders every row as column → text and keys it by keyColumns,
+// or by the whole row when there are none. Column names are lower-cased so
+// that the label lookup and comparisons ignore case.
+func indexRows(table *Table, keyColumns []string) map[string]map[string]string {
+	rows := make(map[string]map[string]string, len(table.Rows))
+	for _, values := range table.Rows {
+		row := make(map[string]string, len(values))
+		for i, column := range table.Columns {
+			row[strings.ToLower(column)] = FormatValue(values[i])
+		}
+
+		var parts []string
+		if len(keyColumns) > 0 {
+			for _, column := range keyColumns {
+				parts = append(parts, fmt.Sprintf("%s=%s", column, row[strings.ToLower(column)]))
+			}
+		} else {
+			for i, column := range table.Columns {
+				parts = append(parts, fmt.Sprintf("%s=%s", column, FormatValue(values[i])))
+			}
+		}
+
+		key := strings.Join(parts, ",")
+		// Duplicate rows in key-less tables stay distinguishable.
+		for n := 2; rows[key] != nil; n++ {
+			key = fmt.Sprintf("%s#%d", strings.Join(parts, ","), n)
+		}
+		rows[key] = row
+	}
+	return rows
+}
+
+func changedFields(old, new map[string]string) []string {
+	var fields []string
+	for column, value := range new {
+		if oldValue, ok := old[column]; ok && oldValue != value {
+			fields = append(fields, column)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+func sortedKeys(maps ...map[string]map[string]string) []string {
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report in a diff-like form, one line per change:
+//
+//	--- old.hwdev
+//	+++ new.hwdev
+//	table variable
+//	  + id=3 Level
+//	  ~ id=1 Temperature: address "40001" -> "40002"
+func (r *Report) WriteText(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", r.Old, r.New)
+
+	if r.Empty() {
+		sb.WriteString("no differences\n")
+	}
+
+	for _, table := range r.Tables {
+		switch table.Change {
+		case CHANGE_ADDED:
+			fmt.Fprintf(&sb, "table %s (added, %d rows)\n", table.Table, len(table.Rows))
+			continue
+		case CHANGE_REMOVED:
+			fmt.Fprintf(&sb, "table %s (removed, %d rows)\n", table.Table, len(table.Rows))
+			continue
+		}
+
+		fmt.Fprintf(&sb, "table %s\n", table.Table)
+		for _, column := range table.AddedColumns {
+			fmt.Fprintf(&sb, "  + column %s\n", column)
+		}
+		for _, column := range table.RemovedColumns {
+			fmt.Fprintf(&sb, "  - column %s\n", column)
+		}
+
+		for _, row := range table.Rows {
+			label := row.Key
+			if row.Label != "" && !strings.HasSuffix(row.Key, "="+row.Label) {
+				label += " " + row.Label
+			}
+
+			switch row.Change {
+			case CHANGE_ADDED:
+				fmt.Fprintf(&sb, "  + %s\n", label)
+			case CHANGE_REMOVED:
+				fmt.Fprintf(&sb, "  - %s\n", label)
+			case CHANGE_MODIFIED:
+				changes := make([]string, len(row.Fields))
+				for i, field := range row.Fields {
+					changes[i] = fmt.Sprintf("%s %q -> %q", field, row.Old[field], row.New[field])
+				}
+				fmt.Fprintf(&sb, "  ~ %s: %s\n", label, strings.Join(changes, ", "))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,121 @@
+package hwdev
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func openFixture(t *testing.T, statements ...string) *Project {
+	t.Helper()
+
+	p, err := Open(context.Background(), createFixture(t, statements...), "")
+	if err != nil {
+		t.Fatalf("Failed to open the fixture: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	old := openFixture(t, append(slices.Clone(fixtureSchema), fixtureRows...)...)
+	new := openFixture(t, append(slices.Clone(fixtureSchema),
+		`INSERT INTO haiwell VALUES ('version', '3.40.0.15'), ('model', 'C7S-W')`,
+		`INSERT INTO variable VALUES (1, 'Temperature', 'FLOAT', '40002', 'Tank temperature'), (3, 'Level', 'WORD', '40010', NULL)`,
+		`INSERT INTO screen VALUES (1, 0, 'Main'), (2, 1, 'Alarms')`,
+		`INSERT INTO alarm VALUES (1, 'High temperature', 'Temperature', '> 80', 2, 'Tank too hot')`,
+		`CREATE TABLE recipe (name TEXT, value TEXT)`,
+		`INSERT INTO recipe VALUES ('Default', '1')`,
+	)...)
+
+	report, err := Diff(ctx, old, new)
+	if err != nil {
+		t.Fatalf("Failed to diff the projects: %v", err)
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("Failed to write the text report: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"--- " + old.Path,
+		"+++ " + new.Path,
+		"table haiwell",
+		`  ~ name=version: value "3.40.0.14" -> "3.40.0.15"`,
+		"table recipe (added, 1 rows)",
+		"table variable",
+		`  ~ id=1 Temperature: address "40001" -> "40002"`,
+		"  - id=2 Pump",
+		"  + id=3 Level",
+		"",
+	}, "\n")
+	if text.String() != want {
+		t.Errorf("Text report:\n%s\nwant:\n%s", text.String(), want)
+	}
+
+	var data bytes.Buffer
+	if err := report.WriteJSON(&data); err != nil {
+		t.Fatalf("Failed to write the JSON report: %v", err)
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(data.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode the JSON report: %v", err)
+	}
+	variables := decoded.Tables[2]
+	if variables.Table != "variable" || len(variables.Rows) != 3 ||
+		variables.Rows[0].Change != CHANGE_MODIFIED || !slices.Equal(variables.Rows[0].Fields, []string{"address"}) ||
+		variables.Rows[0].Old["address"] != "40001" || variables.Rows[0].New["address"] != "40002" {
+		t.Errorf("Unexpected variable changes %+v", variables)
+	}
+}
+
+func TestDiffTables(t *testing.T) {
+	t.Run("Identical", func(t *testing.T) {
+		p := openFixture(t, append(slices.Clone(fixtureSchema), fixtureRows...)...)
+		report, err := Diff(context.Background(), p, p)
+		if err != nil || !report.Empty() {
+			t.Errorf("Diff with itself = %+v (%v)", report, err)
+		}
+	})
+
+	t.Run("Columns and key-less rows", func(t *testing.T) {
+		old := &Table{Name: "log", Columns: []string{"message"}, Rows: [][]any{{"a"}, {"a"}, {"b"}}}
+		new := &Table{Name: "log", Columns: []string{"message", "level"}, Rows: [][]any{{"a", nil}, {"c", int64(1)}}}
+
+		diff := DiffTables(old, new)
+		if diff == nil || !slices.Equal(diff.AddedColumns, []string{"level"}) {
+			t.Fatalf("Unexpected diff %+v", diff)
+		}
+
+		var changes []string
+		for _, row := range diff.Rows {
+			changes = append(changes, row.Change+" "+row.Key)
+		}
+		want := []string{
+			"removed message=a",
+			"added message=a,level=",
+			"removed message=a#2",
+			"removed message=b",
+			"added message=c,level=1",
+		}
+		slices.Sort(changes)
+		slices.Sort(want)
+		if !slices.Equal(changes, want) {
+			t.Errorf("Row changes %v, want %v", changes, want)
+		}
+	})
+
+	t.Run("Removed table", func(t *testing.T) {
+		old := &Table{Name: "trend", Columns: []string{"id"}, PrimaryKey: []string{"id"}, Rows: [][]any{{int64(1)}}}
+		diff := DiffTables(old, nil)
+		if diff == nil || diff.Change != CHANGE_REMOVED || len(diff.Rows) != 1 || diff.Rows[0].Key != "id=1" {
+			t.Errorf("Unexpected diff %+v", diff)
+		}
+	})
+}
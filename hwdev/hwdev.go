@@ -0,0 +1,239 @@
+// Package hwdev reads Haiwell .hwdev project files. A project is a SQLite
+// database encrypted with a SQLCipher-style key, so reading real projects
+// needs go-sqlite3 built against SQLCipher (-tags libsqlite3 with
+// libsqlcipher installed as libsqlite3); unencrypted projects open with the
+// stock driver.
+package hwdev
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrWrongPassword = errors.New("hwdev: wrong password or not a project file")
+	ErrNoSuchTable   = errors.New("hwdev: no such table")
+)
+
+// Project is an open .hwdev file. It is opened read-only.
+type Project struct {
+	Path   string
+	Schema Schema
+
+	db *sql.DB
+}
+
+// Open opens the project at path with password, the same key the vendor IDE
+// uses. A wrong password surfaces here as ErrWrongPassword rather than on
+// the first query.
+func Open(ctx context.Context, path, password string) (*Project, error) {
+	db := sql.OpenDB(&connector{
+		path:   path,
+		dsn:    "file:" + url.PathEscape(path) + "?mode=ro",
+		driver: &sqlite3.SQLiteDriver{ConnectHook: unlock(path, password)},
+	})
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Project{Path: path, Schema: DefaultSchema, db: db}, nil
+}
+
+// connector opens every connection of the pool through driver, so each
+// one runs its ConnectHook.
+type connector struct {
+	path   string
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+// Connect opens a connection. Before the ConnectHook the driver only runs
+// its busy_timeout, locking_mode and synchronous pragmas, which read no
+// table data, so a wrong key is normally reported by the hook once PRAGMA
+// key is applied. A NOTADB from those pragmas is mapped here as well.
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if notADB(err) {
+		return nil, fmt.Errorf("%w: %s", ErrWrongPassword, c.path)
+	}
+	return conn, err
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// unlock returns a ConnectHook that keys a new connection with PRAGMA key,
+// which applies to a single connection, and checks that the key opens the
+// file.
+func unlock(path, password string) func(*sqlite3.SQLiteConn) error {
+	return func(conn *sqlite3.SQLiteConn) error {
+		var err error
+		if password != "" {
+			_, err = conn.Exec(fmt.Sprintf("PRAGMA key = %s", quote(password)), nil)
+		}
+		if err == nil {
+			_, err = conn.Exec("SELECT count(*) FROM sqlite_master", nil)
+		}
+		if notADB(err) {
+			if password != "" && !hasCipher(conn) {
+				return fmt.Errorf("%w: %s (go-sqlite3 is not built against SQLCipher)", ErrWrongPassword, path)
+			}
+			return fmt.Errorf("%w: %s", ErrWrongPassword, path)
+		}
+		if err != nil {
+			return fmt.Errorf("hwdev: open %s: %w", path, err)
+		}
+		return nil
+	}
+}
+
+func notADB(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrNotADB
+}
+
+// hasCipher reports whether the driver is SQLCipher, which answers PRAGMA
+// cipher_version where stock SQLite ignores it.
+func hasCipher(conn *sqlite3.SQLiteConn) bool {
+	rows, err := conn.Query("PRAGMA cipher_version", nil)
+	if err != nil {
+		return false
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, len(rows.Columns()))
+	return rows.Next(dest) == nil
+}
+
+func (p *Project) Close() error {
+	return p.db.Close()
+}
+
+// DB exposes the underlying database for queries this package does not
+// cover.
+func (p *Project) DB() *sql.DB {
+	return p.db
+}
+
+// Tables lists the project's tables in name order.
+func (p *Project) Tables(ctx context.Context) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+
+	return tables, rows.Err()
+}
+
+// HasTable reports whether the project contains the named table.
+func (p *Project) HasTable(ctx context.Context, name string) (bool, error) {
+	var n int
+	err := p.db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	return n > 0, err
+}
+
+// Table is the full content of one table. Values keep the types the driver
+// returns: int64, float64, string, []byte or nil.
+type Table struct {
+	Name       string
+	Columns    []string
+	PrimaryKey []string
+	Rows       [][]any
+}
+
+// Table reads a whole table, ordered by primary key, or by rowid for tables
+// without one.
+func (p *Project) Table(ctx context.Context, name string) (*Table, error) {
+	ok, err := p.HasTable(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchTable, name)
+	}
+
+	table := &Table{Name: name}
+	if table.PrimaryKey, err = p.primaryKey(ctx, name); err != nil {
+		return nil, err
+	}
+
+	order := "rowid"
+	if len(table.PrimaryKey) > 0 {
+		quoted := make([]string, len(table.PrimaryKey))
+		for i, column := range table.PrimaryKey {
+			quoted[i] = quoteIdent(column)
+		}
+		order = strings.Join(quoted, ", ")
+	}
+
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s ORDER BY %s", quoteIdent(name), order))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if table.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		values := make([]any, len(table.Columns))
+		ptrs := make([]any, len(values))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		table.Rows = append(table.Rows, values)
+	}
+
+	return table, rows.Err()
+}
+
+func (p *Project) primaryKey(ctx context.Context, table string) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+
+	return columns, rows.Err()
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
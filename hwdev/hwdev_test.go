@@ -0,0 +1,134 @@
+package hwdev
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var fixtureSchema = []string{
+	`CREATE TABLE haiwell (name TEXT PRIMARY KEY, value TEXT)`,
+	`CREATE TABLE variable (id INTEGER PRIMARY KEY, name TEXT, type TEXT, address TEXT, description TEXT)`,
+	`CREATE TABLE screen (id INTEGER PRIMARY KEY, number INTEGER, name TEXT)`,
+	`CREATE TABLE alarm (id INTEGER PRIMARY KEY, name TEXT, variable TEXT, condition TEXT, level INTEGER, message TEXT)`,
+}
+
+var fixtureRows = []string{
+	`INSERT INTO haiwell VALUES ('version', '3.40.0.14'), ('model', 'C7S-W')`,
+	`INSERT INTO variable VALUES (1, 'Temperature', 'FLOAT', '40001', 'Tank temperature'), (2, 'Pump', 'BIT', '00001', NULL)`,
+	`INSERT INTO screen VALUES (1, 0, 'Main'), (2, 1, 'Alarms')`,
+	`INSERT INTO alarm VALUES (1, 'High temperature', 'Temperature', '> 80', 2, 'Tank too hot')`,
+}
+
+// createFixture writes an unencrypted project built from statements.
+func createFixture(t *testing.T, statements ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "project.hwdev")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to create the fixture: %v", err)
+	}
+	defer db.Close()
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to run %q: %v", statement, err)
+		}
+	}
+
+	return path
+}
+
+func TestProject(t *testing.T) {
+	ctx := context.Background()
+	path := createFixture(t, append(slices.Clone(fixtureSchema), fixtureRows...)...)
+
+	p, err := Open(ctx, path, "")
+	if err != nil {
+		t.Fatalf("Failed to open the project: %v", err)
+	}
+	defer p.Close()
+
+	tables, err := p.Tables(ctx)
+	if err != nil || !slices.Equal(tables, []string{"alarm", "haiwell", "screen", "variable"}) {
+		t.Fatalf("Tables() = %v (%v)", tables, err)
+	}
+
+	m, err := p.Metadata(ctx)
+	if err != nil || m.Version != "3.40.0.14" || m.Values["model"] != "C7S-W" {
+		t.Errorf("Metadata() = %+v (%v)", m, err)
+	}
+
+	variables, err := p.Variables(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read variables: %v", err)
+	}
+	want := []Variable{
+		{ID: 1, Name: "Temperature", DataType: "FLOAT", Address: "40001", Description: "Tank temperature"},
+		{ID: 2, Name: "Pump", DataType: "BIT", Address: "00001"},
+	}
+	if !slices.Equal(variables, want) {
+		t.Errorf("Variables() = %+v, want %+v", variables, want)
+	}
+
+	screens, err := p.Screens(ctx)
+	if err != nil || len(screens) != 2 || screens[1] != (Screen{ID: 2, Number: 1, Name: "Alarms"}) {
+		t.Errorf("Screens() = %+v (%v)", screens, err)
+	}
+
+	alarms, err := p.Alarms(ctx)
+	if err != nil || len(alarms) != 1 || alarms[0] != (Alarm{ID: 1, Name: "High temperature", Variable: "Temperature", Condition: "> 80", Level: 2, Message: "Tank too hot"}) {
+		t.Errorf("Alarms() = %+v (%v)", alarms, err)
+	}
+
+	if _, err := p.Table(ctx, "missing"); !errors.Is(err, ErrNoSuchTable) {
+		t.Errorf("got %v, want ErrNoSuchTable", err)
+	}
+}
+
+func TestOpenWrongPassword(t *testing.T) {
+	// Without the right key an encrypted project reads as random bytes.
+	data := make([]byte, 8192)
+	rand.Read(data)
+
+	path := filepath.Join(t.TempDir(), "encrypted.hwdev")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write the project: %v", err)
+	}
+
+	if _, err := Open(context.Background(), path, "wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("got %v, want ErrWrongPassword", err)
+	}
+}
+
+func TestOpenEscapesPath(t *testing.T) {
+	ctx := context.Background()
+	fixture := createFixture(t, fixtureSchema...)
+	path := filepath.Join(t.TempDir(), "line #2?mode=rw.hwdev")
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("Failed to read the fixture: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to copy the fixture: %v", err)
+	}
+
+	p, err := Open(ctx, path, "")
+	if err != nil {
+		t.Fatalf("Failed to open %q: %v", path, err)
+	}
+	defer p.Close()
+
+	if tables, err := p.Tables(ctx); err != nil || len(tables) != 4 {
+		t.Errorf("Tables() = %v (%v)", tables, err)
+	}
+	if _, err := p.DB().ExecContext(ctx, "DELETE FROM screen"); err == nil {
+		t.Errorf("Expected the project to open read-only")
+	}
+}
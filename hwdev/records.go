@@ -0,0 +1,206 @@
+package hwdev
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schema names the tables the typed accessors read. Columns are matched by
+// name, case-insensitively, against a few spellings each; a column missing
+// from a project leaves the field empty instead of failing.
+type Schema struct {
+	MetadataTable       string
+	MetadataKeyColumn   string
+	MetadataValueColumn string
+
+	VariableTable string
+	ScreenTable   string
+	AlarmTable    string
+}
+
+var DefaultSchema = Schema{
+	MetadataTable:       "haiwell",
+	MetadataKeyColumn:   "name",
+	MetadataValueColumn: "value",
+
+	VariableTable: "variable",
+	ScreenTable:   "screen",
+	AlarmTable:    "alarm",
+}
+
+const METADATA_VERSION_KEY = "version"
+
+// Metadata is the project-wide key/value table.
+type Metadata struct {
+	// Version is the IDE version that saved the project, e.g. 3.40.0.14.
+	Version string
+	Values  map[string]string
+}
+
+type Variable struct {
+	ID          int64
+	Name        string
+	DataType    string
+	Address     string
+	Description string
+}
+
+type Screen struct {
+	ID          int64
+	Number      int64
+	Name        string
+	Description string
+}
+
+type Alarm struct {
+	ID        int64
+	Name      string
+	Variable  string
+	Condition string
+	Level     int64
+	Message   string
+}
+
+func (p *Project) Metadata(ctx context.Context) (*Metadata, error) {
+	table, err := p.Table(ctx, p.Schema.MetadataTable)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{Values: make(map[string]string)}
+	for _, row := range newRowReaders(table) {
+		key := row.string(p.Schema.MetadataKeyColumn, "key")
+		m.Values[key] = row.string(p.Schema.MetadataValueColumn)
+	}
+	m.Version = m.Values[METADATA_VERSION_KEY]
+
+	return m, nil
+}
+
+func (p *Project) Variables(ctx context.Context) ([]Variable, error) {
+	table, err := p.Table(ctx, p.Schema.VariableTable)
+	if err != nil {
+		return nil, err
+	}
+
+	var variables []Variable
+	for _, row := range newRowReaders(table) {
+		variables = append(variables, Variable{
+			ID:          row.int("id"),
+			Name:        row.string("name"),
+			DataType:    row.string("type", "datatype", "data_type"),
+			Address:     row.string("address", "addr"),
+			Description: row.string("description", "comment", "remark"),
+		})
+	}
+
+	return variables, nil
+}
+
+func (p *Project) Screens(ctx context.Context) ([]Screen, error) {
+	table, err := p.Table(ctx, p.Schema.ScreenTable)
+	if err != nil {
+		return nil, err
+	}
+
+	var screens []Screen
+	for _, row := range newRowReaders(table) {
+		screens = append(screens, Screen{
+			ID:          row.int("id"),
+			Number:      row.int("number", "no", "screen_no"),
+			Name:        row.string("name"),
+			Description: row.string("description", "comment", "remark"),
+		})
+	}
+
+	return screens, nil
+}
+
+func (p *Project) Alarms(ctx context.Context) ([]Alarm, error) {
+	table, err := p.Table(ctx, p.Schema.AlarmTable)
+	if err != nil {
+		return nil, err
+	}
+
+	var alarms []Alarm
+	for _, row := range newRowReaders(table) {
+		alarms = append(alarms, Alarm{
+			ID:        row.int("id"),
+			Name:      row.string("name"),
+			Variable:  row.string("variable", "var", "tag"),
+			Condition: row.string("condition", "cond"),
+			Level:     row.int("level", "priority"),
+			Message:   row.string("message", "msg", "text"),
+		})
+	}
+
+	return alarms, nil
+}
+
+// rowReader reads one table row by column name.
+type rowReader struct {
+	index  map[string]int
+	values []any
+}
+
+func newRowReaders(table *Table) []rowReader {
+	index := make(map[string]int, len(table.Columns))
+	for i, column := range table.Columns {
+		index[strings.ToLower(column)] = i
+	}
+
+	readers := make([]rowReader, len(table.Rows))
+	for i, values := range table.Rows {
+		readers[i] = rowReader{index: index, values: values}
+	}
+	return readers
+}
+
+func (r rowReader) value(names ...string) any {
+	for _, name := range names {
+		if i, ok := r.index[strings.ToLower(name)]; ok {
+			return r.values[i]
+		}
+	}
+	return nil
+}
+
+func (r rowReader) string(names ...string) string {
+	return FormatValue(r.value(names...))
+}
+
+func (r rowReader) int(names ...string) int64 {
+	switch v := r.value(names...).(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n
+	case []byte:
+		n, _ := strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64)
+		return n
+	}
+	return 0
+}
+
+// FormatValue renders a column value the way the vendor IDE shows it: text
+// as-is, numbers in decimal and NULL as the empty string.
+func FormatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,35 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"tests/hwdev"
+)
+
+func TestHwdevProject(t *testing.T) {
+	const (
+		HAIWELL_PROJECT_FILEPATH = "./assets/3.40.0.14.hwdev"
+	)
+	password := os.Getenv("HAIWELL_PROJECT_ENCRYPT_PASSWORD")
+	ctx := context.Background()
+
+	p, err := hwdev.Open(ctx, HAIWELL_PROJECT_FILEPATH, password)
+	if err != nil {
+		t.Fatalf("Failed to open the project: %v", err)
+	}
+	defer p.Close()
+
+	tables, err := p.Tables(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list the tables: %v", err)
+	}
+	t.Logf("Tables: %v", tables)
+
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read the metadata: %v", err)
+	}
+	t.Logf("Version: %s", m.Version)
+}
@@ -0,0 +1,225 @@
+package mail
+
+import (
+	"cmp"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alibabacloud-go/dm-20151123/client"
+)
+
+const (
+	PROVIDER_DIRECTMAIL = "directmail"
+
+	// DirectMail address types: a random sender or the account address.
+	ADDRESS_TYPE_RANDOM  = 0
+	ADDRESS_TYPE_ACCOUNT = 1
+
+	CLICK_TRACE_OFF = "0"
+	CLICK_TRACE_ON  = "1"
+)
+
+// DirectMailClient is the part of the DirectMail SDK client DirectMail uses.
+type DirectMailClient interface {
+	SingleSendMail(req *client.SingleSendMailRequest) (*client.SingleSendMailResponse, error)
+	BatchSendMail(req *client.BatchSendMailRequest) (*client.BatchSendMailResponse, error)
+}
+
+// DirectMail sends through Aliyun DirectMail from AccountName, a sender
+// address configured in the console.
+type DirectMail struct {
+	Client      DirectMailClient
+	AccountName string
+	FromAlias   string
+	ClickTrace  bool
+}
+
+func (d *DirectMail) Send(ctx context.Context, msg *Message) (*Receipt, error) {
+	if err := checkRecipients(msg.To); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	req := &client.SingleSendMailRequest{
+		AccountName:    stringPtr(d.account(msg.From)),
+		AddressType:    int32Ptr(ADDRESS_TYPE_ACCOUNT),
+		ClickTrace:     stringPtr(d.clickTrace()),
+		ReplyToAddress: boolPtr(msg.ReplyTo != ""),
+		ToAddress:      stringPtr(strings.Join(msg.To, ",")),
+		Subject:        stringPtr(msg.Subject),
+		HtmlBody:       stringPtr(msg.HTML),
+		TextBody:       stringPtr(msg.Text),
+	}
+	if alias := cmp.Or(msg.FromAlias, d.FromAlias); alias != "" {
+		req.FromAlias = stringPtr(alias)
+	}
+	if msg.ReplyTo != "" {
+		req.ReplyAddress = stringPtr(msg.ReplyTo)
+	}
+	if msg.Tag != "" {
+		req.TagName = stringPtr(msg.Tag)
+	}
+
+	resp, err := d.Client.SingleSendMail(req)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &Receipt{Provider: PROVIDER_DIRECTMAIL}
+	if resp.Body != nil {
+		receipt.EnvID, receipt.RequestID = stringValue(resp.Body.EnvId), stringValue(resp.Body.RequestId)
+	}
+	return receipt, nil
+}
+
+func (d *DirectMail) BatchSend(ctx context.Context, batch *Batch) (*Receipt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	req := &client.BatchSendMailRequest{
+		AccountName:   stringPtr(d.account(batch.From)),
+		AddressType:   int32Ptr(ADDRESS_TYPE_ACCOUNT),
+		ClickTrace:    stringPtr(d.clickTrace()),
+		TemplateName:  stringPtr(batch.Template),
+		ReceiversName: stringPtr(batch.ReceiversList),
+	}
+	if batch.Tag != "" {
+		req.TagName = stringPtr(batch.Tag)
+	}
+
+	resp, err := d.Client.BatchSendMail(req)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &Receipt{Provider: PROVIDER_DIRECTMAIL}
+	if resp.Body != nil {
+		receipt.EnvID, receipt.RequestID = stringValue(resp.Body.EnvId), stringValue(resp.Body.RequestId)
+	}
+	return receipt, nil
+}
+
+func (d *DirectMail) account(from string) string {
+	return cmp.Or(from, d.AccountName)
+}
+
+func (d *DirectMail) clickTrace() string {
+	if d.ClickTrace {
+		return CLICK_TRACE_ON
+	}
+	return CLICK_TRACE_OFF
+}
+
+func stringPtr(s string) *string { return &s }
+func int32Ptr(i int32) *int32    { return &i }
+func boolPtr(b bool) *bool       { return &b }
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// DirectMail delivery statuses reported by SenderStatisticsDetailByParam.
+const (
+	DM_STATUS_SUCCESS         = 0
+	DM_STATUS_INVALID_ADDRESS = 2
+	DM_STATUS_SPAM            = 3
+	DM_STATUS_FAILED          = 4
+
+	DM_DATE_LAYOUT        = "2006-01-02"
+	DM_UPDATE_TIME_LAYOUT = "2006-01-02T15:04Z"
+	DM_REPORT_PAGE_SIZE   = 100
+)
+
+// directMailZone is the zone DirectMail reports dates and local times in.
+var directMailZone = time.FixedZone("CST", 8*60*60)
+
+var directMailStatuses = map[int32]string{
+	DM_STATUS_SUCCESS:         STATUS_DELIVERED,
+	DM_STATUS_INVALID_ADDRESS: STATUS_BOUNCED,
+	DM_STATUS_SPAM:            STATUS_SPAM,
+	DM_STATUS_FAILED:          STATUS_FAILED,
+}
+
+// DirectMailReportClient is the part of the DirectMail SDK client
+// DirectMailReports uses.
+type DirectMailReportClient interface {
+	SenderStatisticsDetailByParam(req *client.SenderStatisticsDetailByParamRequest) (*client.SenderStatisticsDetailByParamResponse, error)
+}
+
+// DirectMailReports is an EventSource reading the per-recipient delivery
+// details of AccountName. DirectMail reports carry no EnvId, so events
+// match the latest send to each address.
+type DirectMailReports struct {
+	Client      DirectMailReportClient
+	AccountName string
+}
+
+func (r *DirectMailReports) Events(ctx context.Context, since, until time.Time) ([]Event, error) {
+	// The API filters by whole days, so fetch every day the range touches
+	// and drop what falls outside it.
+	req := &client.SenderStatisticsDetailByParamRequest{
+		AccountName: stringPtr(r.AccountName),
+		StartTime:   stringPtr(since.In(directMailZone).Format(DM_DATE_LAYOUT)),
+		EndTime:     stringPtr(until.In(directMailZone).Format(DM_DATE_LAYOUT)),
+		Length:      int32Ptr(DM_REPORT_PAGE_SIZE),
+	}
+
+	var events []Event
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp, err := r.Client.SenderStatisticsDetailByParam(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Body == nil {
+			return events, nil
+		}
+
+		if resp.Body.Data != nil {
+			for _, detail := range resp.Body.Data.MailDetail {
+				e, ok := directMailEvent(detail)
+				if ok && !e.Time.Before(since) && e.Time.Before(until) {
+					events = append(events, e)
+				}
+			}
+		}
+
+		next := stringValue(resp.Body.NextStart)
+		if next == "" || next == stringValue(req.NextStart) {
+			return events, nil
+		}
+		req.NextStart = stringPtr(next)
+	}
+}
+
+func directMailEvent(detail *client.SenderStatisticsDetailByParamResponseBodyDataMailDetail) (Event, bool) {
+	if detail == nil || detail.Status == nil {
+		return Event{}, false
+	}
+	status, ok := directMailStatuses[*detail.Status]
+	if !ok {
+		return Event{}, false
+	}
+
+	e := Event{
+		Address: stringValue(detail.ToAddress),
+		Status:  status,
+		Detail:  stringValue(detail.Message),
+	}
+	if seconds, err := strconv.ParseInt(stringValue(detail.UtcLastUpdateTime), 10, 64); err == nil {
+		e.Time = time.Unix(seconds, 0)
+	} else if t, err := time.ParseInLocation(DM_UPDATE_TIME_LAYOUT, stringValue(detail.LastUpdateTime), directMailZone); err == nil {
+		e.Time = t
+	} else {
+		return Event{}, false
+	}
+	return e, e.Address != ""
+}
@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("mail: recipient rate limited")
+
+// RateLimit allows Count sends within any window of Per.
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+// RateLimiter limits sends per recipient address, case-insensitively,
+// against every limit in Limits.
+type RateLimiter struct {
+	Limits []RateLimit
+	Now    func() time.Time
+
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}
+
+func NewRateLimiter(limits ...RateLimit) *RateLimiter {
+	return &RateLimiter{Limits: limits}
+}
+
+// Allow records a send to every recipient, or to none of them when any
+// would exceed a limit.
+func (l *RateLimiter) Allow(recipients ...string) error {
+	now := time.Now
+	if l.Now != nil {
+		now = l.Now
+	}
+	t := now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sent == nil {
+		l.sent = map[string][]time.Time{}
+	}
+
+	var window time.Duration
+	for _, limit := range l.Limits {
+		window = max(window, limit.Per)
+	}
+
+	keys := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		keys[i] = normalizeAddress(recipient)
+		sent := l.prune(keys[i], t.Add(-window))
+		for _, limit := range l.Limits {
+			if count(sent, t.Add(-limit.Per)) >= limit.Count {
+				return fmt.Errorf("%w: %s: %d per %s", ErrRateLimited, recipient, limit.Count, limit.Per)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		l.sent[key] = append(l.sent[key], t)
+	}
+	return nil
+}
+
+// Refund takes back the latest send Allow recorded to every recipient, for
+// a message the provider did not accept.
+func (l *RateLimiter) Refund(recipients ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, recipient := range recipients {
+		key := normalizeAddress(recipient)
+		if sent := l.sent[key]; len(sent) > 1 {
+			l.sent[key] = sent[:len(sent)-1]
+		} else {
+			delete(l.sent, key)
+		}
+	}
+}
+
+// prune drops the sends to key before since.
+func (l *RateLimiter) prune(key string, since time.Time) []time.Time {
+	sent := l.sent[key]
+	i := 0
+	for i < len(sent) && !sent[i].After(since) {
+		i++
+	}
+	sent = sent[i:]
+	if len(sent) == 0 {
+		delete(l.sent, key)
+	} else {
+		l.sent[key] = sent
+	}
+	return sent
+}
+
+// count returns the number of sends after since.
+func count(sent []time.Time, since time.Time) int {
+	n := 0
+	for _, t := range sent {
+		if t.After(since) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,146 @@
+// Package mail sends templated transactional email through Aliyun
+// DirectMail, SMTP or an in-memory outbox.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+const (
+	// MAX_RECIPIENTS is the most addresses DirectMail accepts in one
+	// SingleSendMail call.
+	MAX_RECIPIENTS = 100
+)
+
+var (
+	ErrNoRecipients      = errors.New("mail: no recipients")
+	ErrTooManyRecipients = errors.New("mail: too many recipients")
+	ErrBatchUnsupported  = errors.New("mail: provider does not support batch sends")
+	ErrInvalidHeader     = errors.New("mail: line break in header")
+)
+
+// Message is a rendered email ready to hand to a Provider.
+type Message struct {
+	// From and FromAlias override the provider's sender when set.
+	From      string
+	FromAlias string
+	To        []string
+	ReplyTo   string
+	Subject   string
+	HTML      string
+	Text      string
+	// Tag groups sends in the provider's statistics.
+	Tag string
+}
+
+// Batch is a send of a template stored at the provider to a receiver list
+// stored at the provider, as DirectMail's BatchSendMail does.
+type Batch struct {
+	From          string
+	Template      string
+	ReceiversList string
+	Tag           string
+}
+
+// Receipt identifies an accepted send at the provider.
+type Receipt struct {
+	Provider  string
+	EnvID     string
+	RequestID string
+}
+
+// Provider delivers messages.
+type Provider interface {
+	Send(ctx context.Context, msg *Message) (*Receipt, error)
+}
+
+// BatchProvider is a Provider that can also send provider-side batches.
+type BatchProvider interface {
+	Provider
+	BatchSend(ctx context.Context, batch *Batch) (*Receipt, error)
+}
+
+func checkRecipients(to []string) error {
+	if len(to) == 0 {
+		return ErrNoRecipients
+	}
+	if len(to) > MAX_RECIPIENTS {
+		return fmt.Errorf("%w: %d > %d", ErrTooManyRecipients, len(to), MAX_RECIPIENTS)
+	}
+	return nil
+}
+
+// Outbox is a Provider that keeps messages in memory for tests. Sends fail
+// with Err when it is set.
+type Outbox struct {
+	Err error
+
+	mu       sync.Mutex
+	messages []Message
+	batches  []Batch
+	// sent numbers receipts, and survives Reset so they stay unique.
+	sent int
+}
+
+func (o *Outbox) Send(ctx context.Context, msg *Message) (*Receipt, error) {
+	if err := checkRecipients(msg.To); err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.Err != nil {
+		return nil, o.Err
+	}
+	stored := *msg
+	stored.To = slices.Clone(msg.To)
+	o.messages = append(o.messages, stored)
+	return o.receipt(), nil
+}
+
+func (o *Outbox) BatchSend(ctx context.Context, batch *Batch) (*Receipt, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.Err != nil {
+		return nil, o.Err
+	}
+	o.batches = append(o.batches, *batch)
+	return o.receipt(), nil
+}
+
+func (o *Outbox) receipt() *Receipt {
+	o.sent++
+	n := o.sent
+	return &Receipt{
+		Provider:  "outbox",
+		EnvID:     fmt.Sprintf("outbox-env-%d", n),
+		RequestID: fmt.Sprintf("outbox-request-%d", n),
+	}
+}
+
+// Messages returns the messages sent so far.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return slices.Clone(o.messages)
+}
+
+// Batches returns the batches sent so far.
+func (o *Outbox) Batches() []Batch {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return slices.Clone(o.batches)
+}
+
+// Reset forgets everything sent.
+func (o *Outbox) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages, o.batches = nil, nil
+}
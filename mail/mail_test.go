@@ -0,0 +1,227 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"tests/storage"
+)
+
+func testTemplates(t *testing.T) *Templates {
+	t.Helper()
+
+	templates, err := ParseFS(fstest.MapFS{
+		"welcome.html":       {Data: []byte(`{{define "subject"}}Welcome, {{.Name}} & co{{end}}<h1>Hello {{.Name}}</h1><p>Open <a href="{{.Link}}">your account</a>.</p>`)},
+		"welcome.txt":        {Data: []byte(`Hello {{.Name}}, open {{.Link}}`)},
+		"welcome.zh-CN.html": {Data: []byte(`{{define "subject"}}欢迎，{{.Name}}{{end}}<h1>你好 {{.Name}}</h1>`)},
+		"welcome.zh.html":    {Data: []byte(`{{define "subject"}}歡迎，{{.Name}}{{end}}<h1>你好 {{.Name}}</h1>`)},
+		"notes.md":           {Data: []byte(`ignored`)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse templates: %v", err)
+	}
+	return templates
+}
+
+func TestTemplates(t *testing.T) {
+	templates := testTemplates(t)
+	data := map[string]string{"Name": "<Ann>", "Link": "https://example.com/a?x=1&y=2"}
+
+	testCases := []struct {
+		name    string
+		locale  string
+		subject string
+		text    string
+	}{
+		{"Default", "", "Welcome, <Ann> & co", "Hello <Ann>, open https://example.com/a?x=1&y=2"},
+		{"Unknown locale", "fr-FR", "Welcome, <Ann> & co", "Hello <Ann>, open https://example.com/a?x=1&y=2"},
+		{"Exact locale", "zh_CN", "欢迎，<Ann>", "你好 <Ann>"},
+		{"Language fallback", "zh-TW", "歡迎，<Ann>", "你好 <Ann>"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := templates.Render("welcome", tc.locale, data)
+			if err != nil {
+				t.Fatalf("Failed to render: %v", err)
+			}
+			if content.Subject != tc.subject {
+				t.Errorf("Subject = %q, want %q", content.Subject, tc.subject)
+			}
+			if content.Text != tc.text {
+				t.Errorf("Text = %q, want %q", content.Text, tc.text)
+			}
+			if !strings.Contains(content.HTML, "&lt;Ann&gt;") {
+				t.Errorf("HTML is not escaped: %s", content.HTML)
+			}
+		})
+	}
+
+	templates.DefaultLocale = "zh-CN"
+	if content, _ := templates.Render("welcome", "fr", data); content.Subject != "欢迎，<Ann>" {
+		t.Errorf("Subject = %q, want the default locale", content.Subject)
+	}
+
+	if _, err := templates.Render("missing", "", data); !errors.Is(err, ErrNoTemplate) {
+		t.Errorf("got %v, want ErrNoTemplate", err)
+	}
+	if err := templates.AddHTML("nosubject", "", "<p>body</p>"); err == nil {
+		t.Errorf("Expected an error for a template without a subject")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	testCases := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"Blocks", "<h1>Title</h1><p>One<br>Two</p>", "Title\nOne\nTwo"},
+		{"Link", `<p>See <a href="https://a.cn/?x=1&amp;y=2">docs</a></p>`, "See docs (https://a.cn/?x=1&y=2)"},
+		{"Bare link", `<a href="https://a.cn">https://a.cn</a>`, "https://a.cn"},
+		{"Invisible", "<style>p{}</style><p>&lt;ok&gt;</p>", "<ok>"},
+		{"Whitespace", "<div>\n  a   b\n\n\n\n</div><div>c</div>", "a b\n\nc"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := HTMLToText(tc.html); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(RateLimit{Count: 2, Per: time.Minute}, RateLimit{Count: 3, Per: time.Hour})
+	limiter.Now = func() time.Time { return now }
+
+	for range 2 {
+		if err := limiter.Allow("a@example.com"); err != nil {
+			t.Fatalf("Failed to allow: %v", err)
+		}
+	}
+	if err := limiter.Allow("A@Example.com "); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got %v, want ErrRateLimited", err)
+	}
+
+	// A limited recipient blocks the whole send.
+	if err := limiter.Allow("b@example.com", "a@example.com"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got %v, want ErrRateLimited", err)
+	}
+	if err := limiter.Allow("b@example.com", "b@example.com"); err != nil {
+		t.Errorf("b@example.com was charged for a blocked send: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := limiter.Allow("a@example.com"); err != nil {
+		t.Errorf("Failed to allow after a minute: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if err := limiter.Allow("a@example.com"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got %v, want the hourly limit", err)
+	}
+	now = now.Add(time.Hour)
+	if err := limiter.Allow("a@example.com"); err != nil {
+		t.Errorf("Failed to allow after an hour: %v", err)
+	}
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	bucket := storage.NewMemoryBucket()
+	bucket.Put(ctx, "reports/2024-05.pdf", strings.NewReader("report"), nil)
+
+	outbox := &Outbox{}
+	service := &Service{
+		Provider:  outbox,
+		Templates: testTemplates(t),
+		From:      "noreply@mail.example.com",
+		FromAlias: "Example",
+		Bucket:    bucket,
+		Limiter:   NewRateLimiter(RateLimit{Count: 1, Per: time.Hour}),
+	}
+
+	// A send the provider fails does not use up the recipient's quota.
+	outbox.Err = errors.New("provider unavailable")
+	if _, err := service.Send(ctx, &Mail{Template: "welcome", To: []string{"ann@example.com"}}); !errors.Is(err, outbox.Err) {
+		t.Fatalf("got %v, want the provider's error", err)
+	}
+	outbox.Err = nil
+
+	receipt, err := service.Send(ctx, &Mail{
+		Template:    "welcome",
+		To:          []string{"ann@example.com"},
+		Data:        map[string]string{"Name": "Ann", "Link": "https://example.com"},
+		Attachments: []Attachment{{Key: "reports/2024-05.pdf"}, {Name: "Guide", URL: "https://example.com/guide.pdf"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if receipt.EnvID == "" {
+		t.Errorf("Expected a receipt, got %+v", receipt)
+	}
+
+	messages := outbox.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.From != "noreply@mail.example.com" || msg.Tag != "welcome" || msg.Subject != "Welcome, Ann & co" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	if !strings.Contains(msg.HTML, `<a href="mem://`) || !strings.Contains(msg.HTML, ">2024-05.pdf</a>") {
+		t.Errorf("HTML does not link the attachment: %s", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "\n\n2024-05.pdf: mem://") || !strings.HasSuffix(msg.Text, "\nGuide: https://example.com/guide.pdf") {
+		t.Errorf("Text does not list the attachments: %q", msg.Text)
+	}
+
+	_, err = service.Send(ctx, &Mail{Template: "welcome", To: []string{"ann@example.com"}})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got %v, want ErrRateLimited", err)
+	}
+	if _, err := service.Send(ctx, &Mail{Template: "welcome"}); !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("got %v, want ErrNoRecipients", err)
+	}
+
+	if _, err := service.BatchSend(ctx, &Batch{Template: "monthly", ReceiversList: "customers", Tag: "newsletter"}); err != nil {
+		t.Fatalf("Failed to batch send: %v", err)
+	}
+	if batches := outbox.Batches(); len(batches) != 1 || batches[0].From != "noreply@mail.example.com" {
+		t.Errorf("Unexpected batches %+v", batches)
+	}
+
+	service.Provider = &SMTP{}
+	if _, err := service.BatchSend(ctx, &Batch{}); !errors.Is(err, ErrBatchUnsupported) {
+		t.Errorf("got %v, want ErrBatchUnsupported", err)
+	}
+}
+
+func TestOutboxReceipts(t *testing.T) {
+	ctx := context.Background()
+	outbox := &Outbox{}
+	msg := &Message{From: "noreply@mail.example.com", To: []string{"ann@example.com"}}
+
+	first, err := outbox.Send(ctx, msg)
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	outbox.Reset()
+	second, err := outbox.Send(ctx, msg)
+	if err != nil {
+		t.Fatalf("Failed to send after reset: %v", err)
+	}
+
+	if first.EnvID == second.EnvID || first.RequestID == second.RequestID {
+		t.Errorf("got %+v after %+v, want receipts that differ across Reset", second, first)
+	}
+	if len(outbox.Messages()) != 1 {
+		t.Errorf("got %d messages, want 1 after Reset", len(outbox.Messages()))
+	}
+}
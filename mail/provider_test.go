@@ -0,0 +1,143 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/dm-20151123/client"
+)
+
+type fakeDirectMail struct {
+	single []*client.SingleSendMailRequest
+	batch  []*client.BatchSendMailRequest
+}
+
+func (f *fakeDirectMail) SingleSendMail(req *client.SingleSendMailRequest) (*client.SingleSendMailResponse, error) {
+	f.single = append(f.single, req)
+	return &client.SingleSendMailResponse{Body: &client.SingleSendMailResponseBody{EnvId: stringPtr("env-1"), RequestId: stringPtr("req-1")}}, nil
+}
+
+func (f *fakeDirectMail) BatchSendMail(req *client.BatchSendMailRequest) (*client.BatchSendMailResponse, error) {
+	f.batch = append(f.batch, req)
+	return &client.BatchSendMailResponse{Body: &client.BatchSendMailResponseBody{EnvId: stringPtr("env-2"), RequestId: stringPtr("req-2")}}, nil
+}
+
+func TestDirectMail(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeDirectMail{}
+	dm := &DirectMail{Client: fake, AccountName: "noreply@mail.example.com", FromAlias: "Example"}
+
+	receipt, err := dm.Send(ctx, &Message{
+		To:      []string{"a@example.com", "b@example.com"},
+		ReplyTo: "support@example.com",
+		Subject: "Hello",
+		HTML:    "<p>Hello</p>",
+		Text:    "Hello",
+		Tag:     "welcome",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if *receipt != (Receipt{Provider: PROVIDER_DIRECTMAIL, EnvID: "env-1", RequestID: "req-1"}) {
+		t.Errorf("Unexpected receipt %+v", receipt)
+	}
+
+	req := fake.single[0]
+	if *req.AccountName != "noreply@mail.example.com" || *req.ToAddress != "a@example.com,b@example.com" ||
+		*req.FromAlias != "Example" || !*req.ReplyToAddress || *req.ReplyAddress != "support@example.com" ||
+		*req.TextBody != "Hello" || *req.TagName != "welcome" || *req.ClickTrace != CLICK_TRACE_OFF {
+		t.Errorf("Unexpected request %+v", req)
+	}
+
+	if _, err := dm.BatchSend(ctx, &Batch{Template: "monthly", ReceiversList: "customers", Tag: "newsletter"}); err != nil {
+		t.Fatalf("Failed to batch send: %v", err)
+	}
+	if req := fake.batch[0]; *req.TemplateName != "monthly" || *req.ReceiversName != "customers" || *req.TagName != "newsletter" {
+		t.Errorf("Unexpected batch request %+v", req)
+	}
+
+	if _, err := dm.Send(ctx, &Message{To: make([]string, MAX_RECIPIENTS+1)}); !errors.Is(err, ErrTooManyRecipients) {
+		t.Errorf("got %v, want ErrTooManyRecipients", err)
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	var sent []byte
+	var recipients []string
+	s := &SMTP{
+		Addr:      "smtpdm.aliyun.com:80",
+		From:      "noreply@mail.example.com",
+		FromAlias: "示例",
+		SendMail: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			sent, recipients = msg, to
+			return nil
+		},
+		Now: func() time.Time { return time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC) },
+	}
+
+	receipt, err := s.Send(context.Background(), &Message{
+		To:      []string{"a@example.com", "b@example.com"},
+		Subject: "你好",
+		HTML:    `<p style="color: red">你好</p>`,
+		Text:    "你好",
+		Tag:     "welcome",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if len(recipients) != 2 {
+		t.Errorf("got recipients %v", recipients)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(sent)))
+	if err != nil {
+		t.Fatalf("Failed to parse the message: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	from, _ := mail.ParseAddress(msg.Header.Get("From"))
+	if subject != "你好" || from.Name != "示例" || msg.Header.Get("Message-Id") != receipt.RequestID ||
+		msg.Header.Get(HEADER_TAG) != "welcome" || msg.Header.Get("Date") != "Wed, 01 May 2024 08:00:00 +0000" {
+		t.Errorf("Unexpected headers %v", msg.Header)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %s", mediaType)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Type")+": "+string(body))
+	}
+	want := []string{"text/plain; charset=utf-8: 你好", `text/html; charset=utf-8: <p style="color: red">你好</p>`}
+	if strings.Join(parts, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got parts %q, want %q", parts, want)
+	}
+
+	for _, bad := range []*Message{
+		{To: []string{"a@example.com"}, ReplyTo: "a@example.com\r\nBcc: victim@example.com"},
+		{To: []string{"a@example.com"}, Tag: "welcome\nBcc: victim@example.com"},
+		{To: []string{"a@example.com\r\nBcc: victim@example.com"}},
+	} {
+		sent = nil
+		if _, err := s.Send(context.Background(), bad); !errors.Is(err, ErrInvalidHeader) || sent != nil {
+			t.Errorf("got %v, want ErrInvalidHeader without sending %+v", err, bad)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"tests/storage"
+)
+
+const (
+	DEFAULT_ATTACHMENT_EXPIRY = 7 * 24 * time.Hour
+)
+
+// Attachment is a file linked from the email rather than embedded in it.
+// Key names an object in the Service's Bucket and is signed into URL when
+// URL is empty.
+type Attachment struct {
+	Name string
+	Key  string
+	URL  string
+}
+
+// Mail is a templated email to send through a Service.
+type Mail struct {
+	Template string
+	Locale   string
+	To       []string
+	Data     any
+	Tag      string
+	// Attachments are listed as download links after the body.
+	Attachments []Attachment
+}
+
+// Service renders templates and sends them through Provider.
+type Service struct {
+	Provider  Provider
+	Templates *Templates
+	From      string
+	FromAlias string
+	ReplyTo   string
+	// Bucket holds attachments; AttachmentExpiry defaults to
+	// DEFAULT_ATTACHMENT_EXPIRY.
+	Bucket           storage.Bucket
+	AttachmentExpiry time.Duration
+	// Limiter, when set, is checked for every recipient before sending.
+	Limiter *RateLimiter
+}
+
+// Render builds the message for m without sending it.
+func (s *Service) Render(ctx context.Context, m *Mail) (*Message, error) {
+	if err := checkRecipients(m.To); err != nil {
+		return nil, err
+	}
+	content, err := s.Templates.Render(m.Template, m.Locale, m.Data)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := s.sign(ctx, m.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := m.Tag
+	if tag == "" {
+		tag = m.Template
+	}
+	return &Message{
+		From:      s.From,
+		FromAlias: s.FromAlias,
+		To:        m.To,
+		ReplyTo:   s.ReplyTo,
+		Subject:   content.Subject,
+		HTML:      content.HTML + attachmentsHTML(attachments),
+		Text:      content.Text + attachmentsText(attachments),
+		Tag:       tag,
+	}, nil
+}
+
+// Send renders m and sends it to all of its recipients in one message.
+func (s *Service) Send(ctx context.Context, m *Mail) (*Receipt, error) {
+	msg, err := s.Render(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if s.Limiter != nil {
+		if err := s.Limiter.Allow(msg.To...); err != nil {
+			return nil, err
+		}
+	}
+	receipt, err := s.Provider.Send(ctx, msg)
+	if err != nil && s.Limiter != nil {
+		s.Limiter.Refund(msg.To...)
+	}
+	return receipt, err
+}
+
+// BatchSend sends a provider-side template to a provider-side receiver
+// list. Rate limits do not apply, since the recipients are not known here.
+func (s *Service) BatchSend(ctx context.Context, batch *Batch) (*Receipt, error) {
+	provider, ok := s.Provider.(BatchProvider)
+	if !ok {
+		return nil, ErrBatchUnsupported
+	}
+	if batch.From == "" {
+		b := *batch
+		b.From = s.From
+		batch = &b
+	}
+	return provider.BatchSend(ctx, batch)
+}
+
+func (s *Service) sign(ctx context.Context, attachments []Attachment) ([]Attachment, error) {
+	expires := s.AttachmentExpiry
+	if expires == 0 {
+		expires = DEFAULT_ATTACHMENT_EXPIRY
+	}
+
+	signed := make([]Attachment, len(attachments))
+	for i, a := range attachments {
+		if a.URL == "" {
+			if s.Bucket == nil {
+				return nil, fmt.Errorf("mail: attachment %s needs a bucket", a.Key)
+			}
+			url, err := s.Bucket.SignURL(ctx, a.Key, storage.METHOD_GET, expires)
+			if err != nil {
+				return nil, fmt.Errorf("mail: sign attachment %s: %w", a.Key, err)
+			}
+			a.URL = url
+		}
+		if a.Name == "" {
+			a.Name = a.Key[strings.LastIndex(a.Key, "/")+1:]
+		}
+		signed[i] = a
+	}
+	return signed, nil
+}
+
+func attachmentsHTML(attachments []Attachment) string {
+	if len(attachments) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n<ul class=\"attachments\">\n")
+	for _, a := range attachments {
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(a.URL), html.EscapeString(a.Name))
+	}
+	b.WriteString("</ul>")
+	return b.String()
+}
+
+func attachmentsText(attachments []Attachment) string {
+	if len(attachments) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, a := range attachments {
+		fmt.Fprintf(&b, "\n%s: %s", a.Name, a.URL)
+	}
+	return b.String()
+}
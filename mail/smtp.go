@@ -0,0 +1,137 @@
+package mail
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	PROVIDER_SMTP = "smtp"
+
+	HEADER_TAG = "X-Mail-Tag"
+)
+
+// SMTP sends multipart/alternative messages through an SMTP relay, such as
+// DirectMail's smtpdm.aliyun.com:80.
+type SMTP struct {
+	Addr      string
+	Auth      smtp.Auth
+	From      string
+	FromAlias string
+	// SendMail defaults to smtp.SendMail.
+	SendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	Now      func() time.Time
+}
+
+func (s *SMTP) Send(ctx context.Context, msg *Message) (*Receipt, error) {
+	if err := checkRecipients(msg.To); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	from := cmp.Or(msg.From, s.From)
+	id := messageID(from)
+	data, err := s.build(from, id, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	send := s.SendMail
+	if send == nil {
+		send = smtp.SendMail
+	}
+	if err := send(s.Addr, s.Auth, from, msg.To, data); err != nil {
+		return nil, err
+	}
+	return &Receipt{Provider: PROVIDER_SMTP, RequestID: id}, nil
+}
+
+// build encodes msg as a MIME message with text and HTML alternatives.
+func (s *SMTP) build(from, id string, msg *Message) ([]byte, error) {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	alias := cmp.Or(msg.FromAlias, s.FromAlias)
+	headers := [][2]string{
+		{"From", (&mail.Address{Name: alias, Address: from}).String()},
+		{"To", strings.Join(msg.To, ", ")},
+		{"Reply-To", msg.ReplyTo},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", now().Format(time.RFC1123Z)},
+		{"Message-Id", id},
+		{HEADER_TAG, msg.Tag},
+		{"Mime-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + body.Boundary()},
+	}
+
+	var out bytes.Buffer
+	for _, h := range headers {
+		// A line break would let the caller's value start a header of its
+		// own.
+		if strings.ContainsAny(h[1], "\r\n") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidHeader, h[0])
+		}
+		if h[1] != "" {
+			fmt.Fprintf(&out, "%s: %s\r\n", h[0], h[1])
+		}
+	}
+	out.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
+
+func messageID(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
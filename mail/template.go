@@ -0,0 +1,210 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	// SUBJECT_TEMPLATE is the block every email template defines for its
+	// subject line.
+	SUBJECT_TEMPLATE = "subject"
+
+	HTML_EXT = ".html"
+	TEXT_EXT = ".txt"
+)
+
+var ErrNoTemplate = errors.New("mail: no such template")
+
+// Content is a rendered template.
+type Content struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Templates holds named email templates with per-locale variants. Each
+// variant has an HTML body that defines a "subject" block, and optionally
+// a plain-text body; without one the text is derived from the HTML.
+//
+// A variant for "zh-HK" falls back to "zh", then DefaultLocale, then the
+// variant without a locale.
+type Templates struct {
+	DefaultLocale string
+
+	html map[string]*htmltemplate.Template
+	text map[string]*texttemplate.Template
+}
+
+func NewTemplates() *Templates {
+	return &Templates{
+		html: map[string]*htmltemplate.Template{},
+		text: map[string]*texttemplate.Template{},
+	}
+}
+
+// ParseFS loads every template in fsys named <name>[.<locale>].html or
+// <name>[.<locale>].txt, such as welcome.html and welcome.zh-CN.txt.
+func ParseFS(fsys fs.FS) (*Templates, error) {
+	t := NewTemplates()
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := path.Ext(name)
+		if ext != HTML_EXT && ext != TEXT_EXT {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		base, locale, _ := strings.Cut(strings.TrimSuffix(path.Base(name), ext), ".")
+		if ext == HTML_EXT {
+			return t.AddHTML(base, locale, string(data))
+		}
+		return t.AddText(base, locale, string(data))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AddHTML parses the HTML body of name in locale, which may be empty.
+func (t *Templates) AddHTML(name, locale, body string) error {
+	tmpl, err := htmltemplate.New(name).Parse(body)
+	if err != nil {
+		return fmt.Errorf("mail: parse %s: %w", variant(name, locale), err)
+	}
+	if tmpl.Lookup(SUBJECT_TEMPLATE) == nil {
+		return fmt.Errorf("mail: %s defines no %q block", variant(name, locale), SUBJECT_TEMPLATE)
+	}
+	t.html[variant(name, normalizeLocale(locale))] = tmpl
+	return nil
+}
+
+// AddText parses the plain-text body of name in locale, which may be empty.
+func (t *Templates) AddText(name, locale, body string) error {
+	tmpl, err := texttemplate.New(name).Parse(body)
+	if err != nil {
+		return fmt.Errorf("mail: parse %s: %w", variant(name, locale), err)
+	}
+	t.text[variant(name, normalizeLocale(locale))] = tmpl
+	return nil
+}
+
+// Render executes the best variant of name for locale with data.
+func (t *Templates) Render(name, locale string, data any) (*Content, error) {
+	var key string
+	for _, candidate := range t.locales(locale) {
+		if _, ok := t.html[variant(name, candidate)]; ok {
+			key = variant(name, candidate)
+			break
+		}
+	}
+	if key == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoTemplate, variant(name, locale))
+	}
+	tmpl := t.html[key]
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, SUBJECT_TEMPLATE, data); err != nil {
+		return nil, fmt.Errorf("mail: render %s subject: %w", key, err)
+	}
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("mail: render %s: %w", key, err)
+	}
+	content := &Content{
+		Subject: strings.TrimSpace(html.UnescapeString(subject.String())),
+		HTML:    strings.TrimSpace(body.String()),
+	}
+
+	// The text variant must match the HTML variant's locale, so a generic
+	// text body never accompanies a localized HTML body.
+	if text, ok := t.text[key]; ok {
+		var buf bytes.Buffer
+		if err := text.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("mail: render %s text: %w", key, err)
+		}
+		content.Text = strings.TrimSpace(buf.String())
+	} else {
+		content.Text = HTMLToText(content.HTML)
+	}
+	return content, nil
+}
+
+// locales lists the variants to try for locale, most specific first.
+func (t *Templates) locales(locale string) []string {
+	var candidates []string
+	add := func(l string) {
+		if !slices.Contains(candidates, l) {
+			candidates = append(candidates, l)
+		}
+	}
+
+	for _, l := range []string{normalizeLocale(locale), normalizeLocale(t.DefaultLocale)} {
+		if l == "" {
+			continue
+		}
+		add(l)
+		if language, _, ok := strings.Cut(l, "-"); ok {
+			add(language)
+		}
+	}
+	add("")
+	return candidates
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+}
+
+func variant(name, locale string) string {
+	if locale == "" {
+		return name
+	}
+	return name + "." + locale
+}
+
+var (
+	blockEnd   = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|li|tr|table|ul|ol)>`)
+	link       = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"]*)"[^>]*>(.*?)</a>`)
+	invisible  = regexp.MustCompile(`(?is)<(head|style|script)[^>]*>.*?</(head|style|script)>`)
+	tag        = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText approximates the plain-text alternative of an HTML body,
+// keeping block breaks and link targets.
+func HTMLToText(body string) string {
+	body = invisible.ReplaceAllString(body, "")
+	body = link.ReplaceAllStringFunc(body, func(a string) string {
+		m := link.FindStringSubmatch(a)
+		href := html.UnescapeString(m[1])
+		text := strings.TrimSpace(tag.ReplaceAllString(m[2], ""))
+		if text == "" || text == href {
+			return href
+		}
+		return text + " (" + href + ")"
+	})
+	body = blockEnd.ReplaceAllString(body, "$0\n")
+	body = tag.ReplaceAllString(body, "")
+	body = html.UnescapeString(body)
+
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
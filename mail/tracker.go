@@ -0,0 +1,389 @@
+package mail
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	STATUS_SENT      = "sent"
+	STATUS_DELIVERED = "delivered"
+	// STATUS_BOUNCED is a hard bounce: the address does not exist.
+	STATUS_BOUNCED = "bounced"
+	// STATUS_FAILED is a soft failure such as a full mailbox or a
+	// greylisting timeout; the address stays deliverable.
+	STATUS_FAILED = "failed"
+	STATUS_SPAM   = "spam"
+
+	REASON_BOUNCE    = "bounce"
+	REASON_COMPLAINT = "complaint"
+	REASON_MANUAL    = "manual"
+)
+
+var ErrSuppressed = errors.New("mail: recipient suppressed")
+
+// suppressionReasons maps the statuses that suppress an address to why.
+var suppressionReasons = map[string]string{
+	STATUS_BOUNCED: REASON_BOUNCE,
+	STATUS_SPAM:    REASON_COMPLAINT,
+}
+
+// The schema sticks to types and statements that SQLite and MySQL share,
+// so the tracker can live next to either. Timestamps are Unix seconds.
+var trackerSchema = []string{`
+CREATE TABLE IF NOT EXISTS mail_send (
+	request_id VARCHAR(128) NOT NULL PRIMARY KEY,
+	env_id     VARCHAR(64) NOT NULL DEFAULT '',
+	provider   VARCHAR(32) NOT NULL DEFAULT '',
+	tag        VARCHAR(128) NOT NULL DEFAULT '',
+	subject    VARCHAR(255) NOT NULL DEFAULT '',
+	sent_at    BIGINT NOT NULL
+)`, `
+CREATE TABLE IF NOT EXISTS mail_recipient (
+	request_id VARCHAR(128) NOT NULL,
+	address    VARCHAR(255) NOT NULL,
+	status     VARCHAR(16) NOT NULL,
+	detail     VARCHAR(1024) NOT NULL DEFAULT '',
+	sent_at    BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	PRIMARY KEY (request_id, address)
+)`, `
+CREATE TABLE IF NOT EXISTS mail_suppression (
+	address    VARCHAR(255) NOT NULL PRIMARY KEY,
+	reason     VARCHAR(16) NOT NULL,
+	detail     VARCHAR(1024) NOT NULL DEFAULT '',
+	created_at BIGINT NOT NULL
+)`}
+
+// Delivery is the latest known state of a send to one recipient.
+type Delivery struct {
+	RequestID string
+	EnvID     string
+	Address   string
+	Status    string
+	Detail    string
+	SentAt    time.Time
+	UpdatedAt time.Time
+}
+
+// Event is a delivery report for one recipient. EnvID, when the report
+// carries it, pins the event to a send; otherwise it applies to the latest
+// send to Address before Time.
+type Event struct {
+	EnvID   string
+	Address string
+	Status  string
+	Detail  string
+	Time    time.Time
+}
+
+// Suppression blocks sends to an address.
+type Suppression struct {
+	Address   string
+	Reason    string
+	Detail    string
+	CreatedAt time.Time
+}
+
+// EventSource reports delivery events in [since, until).
+type EventSource interface {
+	Events(ctx context.Context, since, until time.Time) ([]Event, error)
+}
+
+// Tracker records sends and their delivery reports in SQL and keeps a
+// suppression list of addresses that hard-bounced or reported spam.
+type Tracker struct {
+	db  *sql.DB
+	Now func() time.Time
+}
+
+// OpenTracker opens or creates a SQLite tracker database at path.
+func OpenTracker(ctx context.Context, path string) (*Tracker, error) {
+	db, err := sql.Open("sqlite3", "file:"+url.PathEscape(path)+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := NewTracker(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewTracker creates the tracker tables in db if they do not exist.
+func NewTracker(ctx context.Context, db *sql.DB) (*Tracker, error) {
+	for _, stmt := range trackerSchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("mail: create tracker: %w", err)
+		}
+	}
+	return &Tracker{db: db}, nil
+}
+
+func (t *Tracker) Close() error {
+	return t.db.Close()
+}
+
+func (t *Tracker) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+// Record stores an accepted send of msg.
+func (t *Tracker) Record(ctx context.Context, msg *Message, receipt *Receipt) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sentAt := t.now().Unix()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO mail_send (request_id, env_id, provider, tag, subject, sent_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		receipt.RequestID, receipt.EnvID, receipt.Provider, msg.Tag, truncate(msg.Subject, 255), sentAt)
+	if err != nil {
+		return fmt.Errorf("mail: record %s: %w", receipt.RequestID, err)
+	}
+
+	for _, address := range msg.To {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO mail_recipient (request_id, address, status, sent_at, updated_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			receipt.RequestID, normalizeAddress(address), STATUS_SENT, sentAt, sentAt)
+		if err != nil {
+			return fmt.Errorf("mail: record %s to %s: %w", receipt.RequestID, address, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Deliveries lists the recipients of the send with requestID.
+func (t *Tracker) Deliveries(ctx context.Context, requestID string) ([]Delivery, error) {
+	rows, err := t.db.QueryContext(ctx, `
+		SELECT r.request_id, s.env_id, r.address, r.status, r.detail, r.sent_at, r.updated_at
+		FROM mail_recipient r JOIN mail_send s ON s.request_id = r.request_id
+		WHERE r.request_id = ? ORDER BY r.address`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var (
+			d                 Delivery
+			sentAt, updatedAt int64
+		)
+		if err := rows.Scan(&d.RequestID, &d.EnvID, &d.Address, &d.Status, &d.Detail, &sentAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		d.SentAt, d.UpdatedAt = time.Unix(sentAt, 0), time.Unix(updatedAt, 0)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Ingest applies delivery reports. Hard bounces and spam reports suppress
+// the address even when no recorded send matches them.
+func (t *Tracker) Ingest(ctx context.Context, events ...Event) error {
+	for _, e := range events {
+		address := normalizeAddress(e.Address)
+		if err := t.update(ctx, address, e); err != nil {
+			return fmt.Errorf("mail: ingest %s for %s: %w", e.Status, address, err)
+		}
+
+		if reason, ok := suppressionReasons[e.Status]; ok {
+			if err := t.suppress(ctx, address, reason, e.Detail, e.Time); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// update moves the matching recipient row to the event's status unless it
+// already holds a later report.
+func (t *Tracker) update(ctx context.Context, address string, e Event) error {
+	var (
+		requestID string
+		err       error
+	)
+	if e.EnvID != "" {
+		err = t.db.QueryRowContext(ctx, `
+			SELECT r.request_id FROM mail_recipient r JOIN mail_send s ON s.request_id = r.request_id
+			WHERE s.env_id = ? AND r.address = ?`, e.EnvID, address).Scan(&requestID)
+	} else {
+		err = t.db.QueryRowContext(ctx, `
+			SELECT request_id FROM mail_recipient
+			WHERE address = ? AND sent_at <= ? ORDER BY sent_at DESC LIMIT 1`, address, e.Time.Unix()).Scan(&requestID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = t.db.ExecContext(ctx, `
+		UPDATE mail_recipient SET status = ?, detail = ?, updated_at = ?
+		WHERE request_id = ? AND address = ? AND updated_at <= ?`,
+		e.Status, truncate(e.Detail, 1024), e.Time.Unix(), requestID, address, e.Time.Unix())
+	return err
+}
+
+// Poll ingests the events source reports since the given time, returning
+// the time to poll from next.
+func (t *Tracker) Poll(ctx context.Context, source EventSource, since time.Time) (time.Time, error) {
+	until := t.now()
+	events, err := source.Events(ctx, since, until)
+	if err != nil {
+		return since, err
+	}
+	if err := t.Ingest(ctx, events...); err != nil {
+		return since, err
+	}
+	return until, nil
+}
+
+// Suppress blocks future sends to address.
+func (t *Tracker) Suppress(ctx context.Context, address, reason, detail string) error {
+	return t.suppress(ctx, normalizeAddress(address), reason, detail, t.now())
+}
+
+func (t *Tracker) suppress(ctx context.Context, address, reason, detail string, at time.Time) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// An address stays suppressed for its first reason.
+	var n int
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM mail_suppression WHERE address = ?", address).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO mail_suppression (address, reason, detail, created_at) VALUES (?, ?, ?, ?)`,
+		address, reason, truncate(detail, 1024), at.Unix())
+	if err != nil {
+		return fmt.Errorf("mail: suppress %s: %w", address, err)
+	}
+	return tx.Commit()
+}
+
+// Unsuppress allows sends to address again.
+func (t *Tracker) Unsuppress(ctx context.Context, address string) error {
+	_, err := t.db.ExecContext(ctx, "DELETE FROM mail_suppression WHERE address = ?", normalizeAddress(address))
+	return err
+}
+
+// Suppressed returns the suppression of address, or nil if it may be
+// mailed.
+func (t *Tracker) Suppressed(ctx context.Context, address string) (*Suppression, error) {
+	var (
+		s         Suppression
+		createdAt int64
+	)
+	err := t.db.QueryRowContext(ctx, `
+		SELECT address, reason, detail, created_at FROM mail_suppression WHERE address = ?`,
+		normalizeAddress(address)).Scan(&s.Address, &s.Reason, &s.Detail, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.CreatedAt = time.Unix(createdAt, 0)
+	return &s, nil
+}
+
+// Wrap returns a provider that drops suppressed recipients before sending
+// through p and records every accepted send. A message whose recipients
+// are all suppressed fails with ErrSuppressed.
+func (t *Tracker) Wrap(p Provider) BatchProvider {
+	return &trackedProvider{tracker: t, provider: p}
+}
+
+type trackedProvider struct {
+	tracker  *Tracker
+	provider Provider
+}
+
+func (p *trackedProvider) Send(ctx context.Context, msg *Message) (*Receipt, error) {
+	var to, suppressed []string
+	for _, address := range msg.To {
+		s, err := p.tracker.Suppressed(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			suppressed = append(suppressed, address)
+		} else {
+			to = append(to, address)
+		}
+	}
+	if len(to) == 0 && len(suppressed) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSuppressed, strings.Join(suppressed, ", "))
+	}
+
+	if len(suppressed) > 0 {
+		filtered := *msg
+		filtered.To = to
+		msg = &filtered
+	}
+
+	receipt, err := p.provider.Send(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.tracker.Record(ctx, msg, receipt); err != nil {
+		return receipt, err
+	}
+	return receipt, nil
+}
+
+func (p *trackedProvider) BatchSend(ctx context.Context, batch *Batch) (*Receipt, error) {
+	provider, ok := p.provider.(BatchProvider)
+	if !ok {
+		return nil, ErrBatchUnsupported
+	}
+	receipt, err := provider.BatchSend(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	// The receiver list lives at the provider, so only the send is known.
+	if err := p.tracker.Record(ctx, &Message{Tag: batch.Tag, Subject: batch.Template}, receipt); err != nil {
+		return receipt, err
+	}
+	return receipt, nil
+}
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// Cut on a rune boundary.
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
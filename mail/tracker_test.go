@@ -0,0 +1,169 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/dm-20151123/client"
+)
+
+type fakeReports struct {
+	pages    [][]*client.SenderStatisticsDetailByParamResponseBodyDataMailDetail
+	requests []client.SenderStatisticsDetailByParamRequest
+}
+
+func (f *fakeReports) SenderStatisticsDetailByParam(req *client.SenderStatisticsDetailByParamRequest) (*client.SenderStatisticsDetailByParamResponse, error) {
+	f.requests = append(f.requests, *req)
+
+	page := len(f.requests) - 1
+	body := &client.SenderStatisticsDetailByParamResponseBody{
+		Data: &client.SenderStatisticsDetailByParamResponseBodyData{MailDetail: f.pages[page]},
+	}
+	if page+1 < len(f.pages) {
+		body.NextStart = stringPtr("page-" + strconv.Itoa(page+1))
+	}
+	return &client.SenderStatisticsDetailByParamResponse{Body: body}, nil
+}
+
+func mailDetail(address string, status int32, at time.Time, message string) *client.SenderStatisticsDetailByParamResponseBodyDataMailDetail {
+	return &client.SenderStatisticsDetailByParamResponseBodyDataMailDetail{
+		ToAddress:         stringPtr(address),
+		Status:            int32Ptr(status),
+		UtcLastUpdateTime: stringPtr(strconv.FormatInt(at.Unix(), 10)),
+		Message:           stringPtr(message),
+	}
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	// "?" and "#" would end the path part of an unescaped DSN.
+	path := filepath.Join(t.TempDir(), "mail #1?.db")
+	tracker, err := OpenTracker(ctx, path)
+	if err != nil {
+		t.Fatalf("Failed to open the tracker: %v", err)
+	}
+	defer tracker.Close()
+	tracker.Now = func() time.Time { return now }
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Tracker not created at %s: %v", path, err)
+	}
+
+	outbox := &Outbox{}
+	provider := tracker.Wrap(outbox)
+
+	receipt, err := provider.Send(ctx, &Message{To: []string{"Ann@Example.com", "bob@example.com"}, Subject: "Hello", Tag: "welcome"})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	err = tracker.Ingest(ctx,
+		Event{Address: "ann@example.com", Status: STATUS_DELIVERED, Time: now},
+		Event{EnvID: receipt.EnvID, Address: "bob@example.com", Status: STATUS_BOUNCED, Detail: "550 user unknown", Time: now},
+		// A stale report does not overwrite a newer one.
+		Event{Address: "ann@example.com", Status: STATUS_FAILED, Time: now.Add(-30 * time.Second)},
+		// Reports without a matching send still suppress.
+		Event{Address: "carol@example.com", Status: STATUS_SPAM, Time: now},
+	)
+	if err != nil {
+		t.Fatalf("Failed to ingest: %v", err)
+	}
+
+	deliveries, err := tracker.Deliveries(ctx, receipt.RequestID)
+	if err != nil {
+		t.Fatalf("Failed to list deliveries: %v", err)
+	}
+	if len(deliveries) != 2 || deliveries[0].Address != "ann@example.com" || deliveries[0].Status != STATUS_DELIVERED ||
+		deliveries[1].Status != STATUS_BOUNCED || deliveries[1].Detail != "550 user unknown" || deliveries[1].EnvID != receipt.EnvID {
+		t.Errorf("Unexpected deliveries %+v", deliveries)
+	}
+
+	testCases := []struct {
+		address string
+		reason  string
+	}{
+		{"ann@example.com", ""},
+		{"BOB@example.com", REASON_BOUNCE},
+		{"carol@example.com", REASON_COMPLAINT},
+	}
+	for _, tc := range testCases {
+		s, err := tracker.Suppressed(ctx, tc.address)
+		if err != nil {
+			t.Fatalf("Failed to check %s: %v", tc.address, err)
+		}
+		if (s == nil && tc.reason != "") || (s != nil && s.Reason != tc.reason) {
+			t.Errorf("Suppressed(%s) = %+v, want reason %q", tc.address, s, tc.reason)
+		}
+	}
+
+	// Suppressed recipients are dropped, and a send to nobody else fails.
+	outbox.Reset()
+	if _, err := provider.Send(ctx, &Message{To: []string{"bob@example.com", "ann@example.com"}}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if to := outbox.Messages()[0].To; len(to) != 1 || to[0] != "ann@example.com" {
+		t.Errorf("got recipients %v, want only ann@example.com", to)
+	}
+	if _, err := provider.Send(ctx, &Message{To: []string{"bob@example.com"}}); !errors.Is(err, ErrSuppressed) {
+		t.Errorf("got %v, want ErrSuppressed", err)
+	}
+
+	if err := tracker.Unsuppress(ctx, "bob@example.com"); err != nil {
+		t.Fatalf("Failed to unsuppress: %v", err)
+	}
+	if _, err := provider.Send(ctx, &Message{To: []string{"bob@example.com"}}); err != nil {
+		t.Errorf("Failed to send after unsuppressing: %v", err)
+	}
+}
+
+func TestTrackerPoll(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	tracker, err := OpenTracker(ctx, filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("Failed to open the tracker: %v", err)
+	}
+	defer tracker.Close()
+	tracker.Now = func() time.Time { return now }
+
+	receipt, err := tracker.Wrap(&Outbox{}).Send(ctx, &Message{To: []string{"ann@example.com"}})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	since := now
+	now = now.Add(time.Hour)
+	reports := &fakeReports{pages: [][]*client.SenderStatisticsDetailByParamResponseBodyDataMailDetail{
+		{mailDetail("ann@example.com", DM_STATUS_INVALID_ADDRESS, since.Add(time.Minute), "mailbox not found")},
+		{
+			mailDetail("old@example.com", DM_STATUS_INVALID_ADDRESS, since.Add(-time.Minute), "before since"),
+			mailDetail("new@example.com", 99, since.Add(time.Minute), "unknown status"),
+		},
+	}}
+	source := &DirectMailReports{Client: reports, AccountName: "noreply@mail.example.com"}
+
+	next, err := tracker.Poll(ctx, source, since)
+	if err != nil || !next.Equal(now) {
+		t.Fatalf("Poll() = %v, %v", next, err)
+	}
+	if len(reports.requests) != 2 || *reports.requests[0].StartTime != "2024-05-01" || stringValue(reports.requests[1].NextStart) != "page-1" {
+		t.Errorf("Unexpected requests %+v", reports.requests)
+	}
+
+	if deliveries, _ := tracker.Deliveries(ctx, receipt.RequestID); deliveries[0].Status != STATUS_BOUNCED {
+		t.Errorf("Unexpected deliveries %+v", deliveries)
+	}
+	for address, want := range map[string]bool{"ann@example.com": true, "old@example.com": false, "new@example.com": false} {
+		if s, _ := tracker.Suppressed(ctx, address); (s != nil) != want {
+			t.Errorf("Suppressed(%s) = %+v, want %v", address, s, want)
+		}
+	}
+}
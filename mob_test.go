@@ -1,48 +1,41 @@
 package tests
 
 import (
-	"encoding/json"
-	"io"
-	"net/http"
-	"net/url"
+	"context"
 	"os"
-	"strings"
 	"testing"
+
+	"tests/phone"
+	"tests/sms"
 )
 
 func TestMobSendSms(t *testing.T) {
-	const (
-		SMS_VERIFY_URL = "https://webapi.sms.mob.com/sms/verify"
-		SMS_SEND_URL   = "https://webapi.sms.mob.com/sms/sendmsg"
-
-		SMS_SEND_PHONE        = ""
-		SMS_SEND_COUNTRY_CODE = "86"
-	)
-
-	appKey := os.Getenv("MOB_APP_KEY")
-
-	var (
-		resultMap map[string]any
-	)
-
-	resp, err := http.Post(SMS_SEND_URL, "text/html", strings.NewReader(url.Values{
-		"phone":  {SMS_SEND_PHONE},
-		"appkey": {appKey},
-		"zone":   {SMS_SEND_COUNTRY_CODE},
-	}.Encode()))
+	mob := &sms.Mob{AppKey: os.Getenv("MOB_APP_KEY")}
+	number, err := phone.Parse(os.Getenv("MOB_PHONE"), phone.CN)
 	if err != nil {
-		t.Fatalf("Failed to send http request: %s\n", err.Error())
+		t.Fatalf("Failed to parse phone: %v", err)
 	}
-	defer resp.Body.Close()
 
-	buff, err := io.ReadAll(resp.Body)
+	zone, national := number.Mob()
+	if err := mob.SendCode(context.Background(), zone, national); err != nil {
+		t.Fatalf("Failed to send code: %v", err)
+	}
+
+	t.Logf("Code sent to %s\n", number)
+}
+
+func TestMobVerifySms(t *testing.T) {
+	mob := &sms.Mob{AppKey: os.Getenv("MOB_APP_KEY")}
+	number, err := phone.Parse(os.Getenv("MOB_PHONE"), phone.CN)
 	if err != nil {
-		t.Fatalf("Failed to read http response: %s\n", err.Error())
+		t.Fatalf("Failed to parse phone: %v", err)
 	}
+	code := os.Getenv("MOB_CODE")
 
-	if err := json.Unmarshal(buff, &resultMap); err != nil {
-		t.Fatalf("Failed to unmarshal json: %s\n", err.Error())
+	zone, national := number.Mob()
+	if err := mob.VerifyCode(context.Background(), zone, national, code); err != nil {
+		t.Fatalf("Failed to verify code: %v", err)
 	}
 
-	t.Logf("Http response: %#v\n", resultMap)
+	t.Logf("Code verified for %s\n", number)
 }
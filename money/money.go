@@ -0,0 +1,215 @@
+// Package money converts amounts between the representations the payment
+// providers expect: yuan strings for Alipay and ABC, int64 fen for WeChat
+// Pay, and float64 prices for Alipay goods details. All arithmetic is done
+// on shopspring/decimal, never on floats.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrNegative         = errors.New("money: negative amount")
+	ErrPrecision        = errors.New("money: precision finer than the currency minor unit")
+	ErrOverflow         = errors.New("money: amount out of range")
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+	ErrUnknownCurrency  = errors.New("money: unknown currency")
+)
+
+// Currency is an ISO 4217 currency. Numeric is the three-digit code ABC
+// expects in CurrencyCode, Exponent the number of minor-unit digits.
+type Currency struct {
+	Code     string
+	Numeric  string
+	Exponent int32
+}
+
+var (
+	CNY = Currency{Code: "CNY", Numeric: "156", Exponent: 2}
+	HKD = Currency{Code: "HKD", Numeric: "344", Exponent: 2}
+	TWD = Currency{Code: "TWD", Numeric: "901", Exponent: 2}
+	USD = Currency{Code: "USD", Numeric: "840", Exponent: 2}
+	EUR = Currency{Code: "EUR", Numeric: "978", Exponent: 2}
+	JPY = Currency{Code: "JPY", Numeric: "392", Exponent: 0}
+)
+
+var currencies = []Currency{CNY, HKD, TWD, USD, EUR, JPY}
+
+// LookupCurrency finds a currency by its alphabetic or numeric code.
+func LookupCurrency(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, c := range currencies {
+		if c.Code == code || c.Numeric == code {
+			return c, nil
+		}
+	}
+	return Currency{}, fmt.Errorf("%w %q", ErrUnknownCurrency, code)
+}
+
+// Amount is a non-negative amount of money with at most the currency's
+// minor-unit precision.
+type Amount struct {
+	value    decimal.Decimal
+	currency Currency
+}
+
+// New validates value against the currency's minor unit.
+func New(value decimal.Decimal, currency Currency) (Amount, error) {
+	if value.IsNegative() {
+		return Amount{}, fmt.Errorf("%w: %s", ErrNegative, value)
+	}
+	if !value.Shift(currency.Exponent).IsInteger() {
+		return Amount{}, fmt.Errorf("%w: %s %s", ErrPrecision, value, currency.Code)
+	}
+	if !value.Shift(currency.Exponent).LessThanOrEqual(decimal.NewFromInt(1<<63 - 1)) {
+		return Amount{}, fmt.Errorf("%w: %s", ErrOverflow, value)
+	}
+
+	return Amount{value: value, currency: currency}, nil
+}
+
+// Parse parses a major-unit string such as Alipay's "0.01".
+func Parse(s string, currency Currency) (Amount, error) {
+	value, err := decimal.NewFromString(strings.TrimSpace(s))
+	if err != nil {
+		return Amount{}, fmt.Errorf("money: parse %q: %w", s, err)
+	}
+	return New(value, currency)
+}
+
+// ParseYuan parses a CNY yuan string.
+func ParseYuan(s string) (Amount, error) {
+	return Parse(s, CNY)
+}
+
+// FromMinor builds an amount from minor units, e.g. fen for CNY.
+func FromMinor(minor int64, currency Currency) (Amount, error) {
+	return New(decimal.New(minor, -currency.Exponent), currency)
+}
+
+// FromFen builds a CNY amount from WeChat Pay's int64 fen.
+func FromFen(fen int64) (Amount, error) {
+	return FromMinor(fen, CNY)
+}
+
+// FromFloat converts a float price such as alipay.GoodsDetail.Price. The
+// float is read through its shortest decimal representation, so 0.01 stays
+// 0.01, and values that need more digits than the minor unit are rejected
+// instead of being rounded.
+func FromFloat(f float64, currency Currency) (Amount, error) {
+	return Parse(strconv.FormatFloat(f, 'f', -1, 64), currency)
+}
+
+// MustParseYuan is like ParseYuan but panics on error. It is meant for
+// constants in tests and fixtures.
+func MustParseYuan(s string) Amount {
+	a, err := ParseYuan(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) Currency() Currency {
+	return a.currency
+}
+
+func (a Amount) Decimal() decimal.Decimal {
+	return a.value
+}
+
+func (a Amount) IsZero() bool {
+	return a.value.IsZero()
+}
+
+// Minor returns the amount in minor units.
+func (a Amount) Minor() int64 {
+	return a.value.Shift(a.currency.Exponent).IntPart()
+}
+
+// String formats the amount in major units with exactly the currency's
+// minor-unit digits, e.g. "0.01".
+func (a Amount) String() string {
+	return a.value.StringFixed(a.currency.Exponent)
+}
+
+// Alipay formats the amount for Alipay's total_amount, e.g. "0.01".
+func (a Amount) Alipay() string {
+	return a.String()
+}
+
+// AlipayPrice returns the float64 alipay.GoodsDetail.Price expects. Every
+// amount with two decimals round-trips through float64 and back.
+func (a Amount) AlipayPrice() float64 {
+	f, _ := a.value.Float64()
+	return f
+}
+
+// WechatPay returns the int64 fen WeChat Pay expects in amount.total.
+func (a Amount) WechatPay() int64 {
+	return a.Minor()
+}
+
+// ABC formats the amount for ABC's OrderAmount, e.g. "0.01".
+func (a Amount) ABC() string {
+	return a.String()
+}
+
+// ABCCurrencyCode returns the numeric code ABC expects in CurrencyCode.
+func (a Amount) ABCCurrencyCode() string {
+	return a.currency.Numeric
+}
+
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a.currency != b.currency {
+		return Amount{}, fmt.Errorf("%w: %s + %s", ErrCurrencyMismatch, a.currency.Code, b.currency.Code)
+	}
+	return New(a.value.Add(b.value), a.currency)
+}
+
+// Sub returns a - b, failing with ErrNegative when b is larger.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if a.currency != b.currency {
+		return Amount{}, fmt.Errorf("%w: %s - %s", ErrCurrencyMismatch, a.currency.Code, b.currency.Code)
+	}
+	return New(a.value.Sub(b.value), a.currency)
+}
+
+// Mul multiplies the amount by a quantity.
+func (a Amount) Mul(quantity int64) (Amount, error) {
+	return New(a.value.Mul(decimal.NewFromInt(quantity)), a.currency)
+}
+
+func (a Amount) Cmp(b Amount) int {
+	return a.value.Cmp(b.value)
+}
+
+func (a Amount) Equal(b Amount) bool {
+	return a.currency == b.currency && a.value.Equal(b.value)
+}
+
+// MarshalText encodes the amount as its major-unit string.
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText decodes a major-unit string. A zero-value Amount decodes as CNY.
+func (a *Amount) UnmarshalText(text []byte) error {
+	currency := a.currency
+	if currency.Code == "" {
+		currency = CNY
+	}
+
+	parsed, err := Parse(string(text), currency)
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+	return nil
+}
@@ -0,0 +1,166 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseYuan(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		fen     int64
+		yuan    string
+		wantErr error
+	}{
+		{"One fen", "0.01", 1, "0.01", nil},
+		{"Whole yuan", "12", 1200, "12.00", nil},
+		{"Trailing zeros", "1.100", 110, "1.10", nil},
+		{"Zero", "0", 0, "0.00", nil},
+		{"Sub-fen precision", "0.001", 0, "", ErrPrecision},
+		{"Negative", "-0.01", 0, "", ErrNegative},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := ParseYuan(tc.input)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("ParseYuan(%q) error = %v, want %v", tc.input, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseYuan(%q) failed: %v", tc.input, err)
+			}
+			if a.WechatPay() != tc.fen || a.Alipay() != tc.yuan || a.ABC() != tc.yuan {
+				t.Errorf("ParseYuan(%q) = fen %d yuan %s, want fen %d yuan %s", tc.input, a.WechatPay(), a.Alipay(), tc.fen, tc.yuan)
+			}
+		})
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   float64
+		fen     int64
+		wantErr error
+	}{
+		{"Alipay goods price", 0.01, 1, nil},
+		{"Inexact binary float", 1.1, 110, nil},
+		{"Sub-fen", 12.3456, 0, ErrPrecision},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := FromFloat(tc.input, CNY)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("FromFloat(%v) error = %v, want %v", tc.input, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromFloat(%v) failed: %v", tc.input, err)
+			}
+			if a.Minor() != tc.fen || a.AlipayPrice() != tc.input {
+				t.Errorf("FromFloat(%v) = %d fen, price %v", tc.input, a.Minor(), a.AlipayPrice())
+			}
+		})
+	}
+
+	a, b := 0.1, 0.2
+	if _, err := FromFloat(a+b, CNY); !errors.Is(err, ErrPrecision) {
+		t.Errorf("FromFloat(0.1+0.2) error = %v, want ErrPrecision", err)
+	}
+}
+
+func TestFenRoundTrip(t *testing.T) {
+	for fen := int64(0); fen < 100000; fen++ {
+		a, err := FromFen(fen)
+		if err != nil {
+			t.Fatalf("FromFen(%d) failed: %v", fen, err)
+		}
+
+		b, err := ParseYuan(a.Alipay())
+		if err != nil || b.WechatPay() != fen {
+			t.Fatalf("round trip of %d fen through %q gave %d (%v)", fen, a.Alipay(), b.WechatPay(), err)
+		}
+
+		c, err := FromFloat(a.AlipayPrice(), CNY)
+		if err != nil || c.WechatPay() != fen {
+			t.Fatalf("float round trip of %d fen gave %d (%v)", fen, c.WechatPay(), err)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	price := MustParseYuan("0.10")
+
+	total, err := price.Mul(3)
+	if err != nil || total.String() != "0.30" {
+		t.Fatalf("0.10 * 3 = %v (%v), want 0.30", total, err)
+	}
+
+	sum, err := total.Add(MustParseYuan("0.01"))
+	if err != nil || sum.WechatPay() != 31 {
+		t.Fatalf("0.30 + 0.01 = %v (%v), want 0.31", sum, err)
+	}
+
+	if _, err := price.Sub(total); !errors.Is(err, ErrNegative) {
+		t.Errorf("0.10 - 0.30 error = %v, want ErrNegative", err)
+	}
+
+	usd, _ := New(decimal.RequireFromString("1"), USD)
+	if _, err := price.Add(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("CNY + USD error = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	c, err := LookupCurrency("156")
+	if err != nil || c != CNY {
+		t.Fatalf("LookupCurrency(156) = %v (%v), want CNY", c, err)
+	}
+	if MustParseYuan("1").ABCCurrencyCode() != "156" {
+		t.Errorf("ABC currency code is not 156")
+	}
+
+	yen, err := Parse("100", JPY)
+	if err != nil || yen.Minor() != 100 || yen.String() != "100" {
+		t.Errorf("Parse(100, JPY) = %v minor %d (%v)", yen, yen.Minor(), err)
+	}
+	if _, err := Parse("1.5", JPY); !errors.Is(err, ErrPrecision) {
+		t.Errorf("Parse(1.5, JPY) error = %v, want ErrPrecision", err)
+	}
+
+	if _, err := LookupCurrency("XXX"); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("LookupCurrency(XXX) error = %v, want ErrUnknownCurrency", err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var order struct {
+		Total Amount `json:"total"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"total":"12.30"}`), &order); err != nil {
+		t.Fatalf("Failed to unmarshal amount: %v", err)
+	}
+	if order.Total.WechatPay() != 1230 {
+		t.Errorf("got %d fen, want 1230", order.Total.WechatPay())
+	}
+
+	data, _ := json.Marshal(order)
+	if string(data) != `{"total":"12.30"}` {
+		t.Errorf("got %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"total":"12.301"}`), &order); !errors.Is(err, ErrPrecision) {
+		t.Errorf("got %v, want ErrPrecision", err)
+	}
+}
@@ -0,0 +1,282 @@
+// Package phone normalizes mobile numbers typed by users into a country
+// calling code ("zone") and a national number, validates them against the
+// numbering rules of the regions we send to, and formats them the way each
+// SMS provider expects: Mob takes the zone and number apart, Aliyun wants
+// mainland numbers bare and others prefixed with the zone, and E.164 is
+// used everywhere else. Only mobile numbers are accepted; a text message to
+// a landline is money thrown away.
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrInvalid       = errors.New("phone: invalid number")
+	ErrUnknownRegion = errors.New("phone: unknown region")
+)
+
+// Region holds the mobile numbering rules of a country or territory. The
+// national number of a mobile is between MinLength and MaxLength digits
+// long, after Trunk (the prefix dialled before it within the region, such
+// as Taiwan's "0"), and starts with one of Prefixes.
+type Region struct {
+	Code      string
+	Zone      string
+	Trunk     string
+	MinLength int
+	MaxLength int
+	Prefixes  []string
+}
+
+var (
+	CN = Region{Code: "CN", Zone: "86", Trunk: "0", MinLength: 11, MaxLength: 11, Prefixes: []string{"13", "14", "15", "16", "17", "18", "19"}}
+	HK = Region{Code: "HK", Zone: "852", MinLength: 8, MaxLength: 8, Prefixes: []string{"4", "5", "6", "7", "9"}}
+	MO = Region{Code: "MO", Zone: "853", MinLength: 8, MaxLength: 8, Prefixes: []string{"6"}}
+	TW = Region{Code: "TW", Zone: "886", Trunk: "0", MinLength: 9, MaxLength: 9, Prefixes: []string{"9"}}
+	// US covers the whole North American Numbering Plan, Canada included.
+	US = Region{Code: "US", Zone: "1", Trunk: "1", MinLength: 10, MaxLength: 10, Prefixes: []string{"2", "3", "4", "5", "6", "7", "8", "9"}}
+	GB = Region{Code: "GB", Zone: "44", Trunk: "0", MinLength: 10, MaxLength: 10, Prefixes: []string{"7"}}
+	JP = Region{Code: "JP", Zone: "81", Trunk: "0", MinLength: 10, MaxLength: 10, Prefixes: []string{"70", "80", "90"}}
+	KR = Region{Code: "KR", Zone: "82", Trunk: "0", MinLength: 9, MaxLength: 10, Prefixes: []string{"10", "11", "16", "17", "18", "19"}}
+	SG = Region{Code: "SG", Zone: "65", MinLength: 8, MaxLength: 8, Prefixes: []string{"8", "9"}}
+	MY = Region{Code: "MY", Zone: "60", Trunk: "0", MinLength: 9, MaxLength: 10, Prefixes: []string{"1"}}
+	TH = Region{Code: "TH", Zone: "66", Trunk: "0", MinLength: 9, MaxLength: 9, Prefixes: []string{"6", "8", "9"}}
+	VN = Region{Code: "VN", Zone: "84", Trunk: "0", MinLength: 9, MaxLength: 9, Prefixes: []string{"3", "5", "7", "8", "9"}}
+	PH = Region{Code: "PH", Zone: "63", Trunk: "0", MinLength: 10, MaxLength: 10, Prefixes: []string{"9"}}
+	ID = Region{Code: "ID", Zone: "62", Trunk: "0", MinLength: 9, MaxLength: 12, Prefixes: []string{"8"}}
+	IN = Region{Code: "IN", Zone: "91", Trunk: "0", MinLength: 10, MaxLength: 10, Prefixes: []string{"6", "7", "8", "9"}}
+	AE = Region{Code: "AE", Zone: "971", Trunk: "0", MinLength: 9, MaxLength: 9, Prefixes: []string{"5"}}
+	AU = Region{Code: "AU", Zone: "61", Trunk: "0", MinLength: 9, MaxLength: 9, Prefixes: []string{"4"}}
+	NZ = Region{Code: "NZ", Zone: "64", Trunk: "0", MinLength: 8, MaxLength: 10, Prefixes: []string{"2"}}
+	DE = Region{Code: "DE", Zone: "49", Trunk: "0", MinLength: 10, MaxLength: 11, Prefixes: []string{"15", "16", "17"}}
+	FR = Region{Code: "FR", Zone: "33", Trunk: "0", MinLength: 9, MaxLength: 9, Prefixes: []string{"6", "7"}}
+	IT = Region{Code: "IT", Zone: "39", MinLength: 9, MaxLength: 10, Prefixes: []string{"3"}}
+	ES = Region{Code: "ES", Zone: "34", MinLength: 9, MaxLength: 9, Prefixes: []string{"6", "7"}}
+	NL = Region{Code: "NL", Zone: "31", Trunk: "0", MinLength: 9, MaxLength: 9, Prefixes: []string{"6"}}
+	RU = Region{Code: "RU", Zone: "7", Trunk: "8", MinLength: 10, MaxLength: 10, Prefixes: []string{"9"}}
+)
+
+var regions = []Region{CN, HK, MO, TW, US, GB, JP, KR, SG, MY, TH, VN, PH, ID, IN, AE, AU, NZ, DE, FR, IT, ES, NL, RU}
+
+// LookupRegion finds a region by its ISO 3166 code or its zone, with or
+// without a leading "+".
+func LookupRegion(code string) (Region, error) {
+	code = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(code)), "+")
+	for _, r := range regions {
+		if r.Code == code || r.Zone == code {
+			return r, nil
+		}
+	}
+	return Region{}, fmt.Errorf("%w %q", ErrUnknownRegion, code)
+}
+
+// lookupZone finds a region by its zone only, with or without a leading
+// "+".
+func lookupZone(zone string) (Region, error) {
+	zone = strings.TrimPrefix(strings.TrimSpace(zone), "+")
+	for _, r := range regions {
+		if r.Zone == zone {
+			return r, nil
+		}
+	}
+	return Region{}, fmt.Errorf("%w %q", ErrUnknownRegion, zone)
+}
+
+// valid reports whether national is a mobile number of the region.
+func (r Region) valid(national string) bool {
+	if len(national) < r.MinLength || len(national) > r.MaxLength {
+		return false
+	}
+	for _, prefix := range r.Prefixes {
+		if strings.HasPrefix(national, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Number is a validated mobile number.
+type Number struct {
+	region   Region
+	national string
+}
+
+// New validates a zone and national number that are already apart and
+// normalized, such as the countryCode and purePhoneNumber WeChat returns
+// for a user's phone, or the zone and phone stored by the sms package. Zone
+// is a calling code; ISO codes such as "CN" are rejected, use LookupRegion
+// and Parse for those.
+func New(zone, national string) (Number, error) {
+	region, err := lookupZone(zone)
+	if err != nil {
+		return Number{}, err
+	}
+	if !region.valid(national) || !allDigits(national) {
+		return Number{}, fmt.Errorf("%w: +%s %s", ErrInvalid, zone, national)
+	}
+	return Number{region: region, national: national}, nil
+}
+
+// Parse parses a number as users type it: with or without "+" or "00" and
+// the zone, with spaces, dashes, dots or brackets between the digits, with
+// the trunk prefix (the leading 0 of "0912 345 678"), and in full-width
+// characters. Numbers without a zone are taken to be in region.
+func Parse(s string, region Region) (Number, error) {
+	digits, international, err := clean(s)
+	if err != nil {
+		return Number{}, err
+	}
+
+	if international {
+		for _, r := range regions {
+			if national, ok := strings.CutPrefix(digits, r.Zone); ok {
+				if n, ok := r.national(national); ok {
+					return n, nil
+				}
+			}
+		}
+		return Number{}, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+
+	if n, ok := region.national(digits); ok {
+		return n, nil
+	}
+	// Users leave out the "+" more often than they add a trunk prefix, so
+	// "8613800138000" is +86 138 0013 8000.
+	if national, ok := strings.CutPrefix(digits, region.Zone); ok {
+		if n, ok := region.national(national); ok {
+			return n, nil
+		}
+	}
+	return Number{}, fmt.Errorf("%w: %q in %s", ErrInvalid, s, region.Code)
+}
+
+// national makes a Number of digits dialled within the region, with or
+// without the trunk prefix. The "(0)" in "+44 (0)7911 123456" is a trunk
+// prefix too.
+func (r Region) national(digits string) (Number, bool) {
+	if r.valid(digits) {
+		return Number{region: r, national: digits}, true
+	}
+	if national, ok := strings.CutPrefix(digits, r.Trunk); ok && r.Trunk != "" && r.valid(national) {
+		return Number{region: r, national: national}, true
+	}
+	return Number{}, false
+}
+
+// clean maps full-width characters to ASCII and drops separators. It
+// reports whether the number is written internationally, with "+" or "00".
+func clean(s string) (string, bool, error) {
+	var b strings.Builder
+	international := false
+	for i, c := range strings.TrimSpace(s) {
+		// Full-width forms mirror ASCII at a fixed offset.
+		if c >= '！' && c <= '～' {
+			c -= '！' - '!'
+		}
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == '+' && i == 0:
+			international = true
+		case unicode.IsSpace(c) || strings.ContainsRune("-.()", c) || unicode.Is(unicode.Pd, c):
+		default:
+			return "", false, fmt.Errorf("%w: %q", ErrInvalid, s)
+		}
+	}
+
+	digits := b.String()
+	if !international {
+		if rest, ok := strings.CutPrefix(digits, "00"); ok {
+			digits, international = rest, true
+		}
+	}
+	if digits == "" {
+		return "", false, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	return digits, international, nil
+}
+
+func allDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants
+// and tests.
+func MustParse(s string, region Region) Number {
+	n, err := Parse(s, region)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func (n Number) Region() Region {
+	return n.region
+}
+
+// Zone returns the country calling code without "+", e.g. "86".
+func (n Number) Zone() string {
+	return n.region.Zone
+}
+
+// National returns the national number without trunk prefix, e.g.
+// "13800138000".
+func (n Number) National() string {
+	return n.national
+}
+
+func (n Number) IsZero() bool {
+	return n.national == ""
+}
+
+// E164 formats the number as "+8613800138000".
+func (n Number) E164() string {
+	if n.IsZero() {
+		return ""
+	}
+	return "+" + n.region.Zone + n.national
+}
+
+func (n Number) String() string {
+	return n.E164()
+}
+
+// Mob returns the zone and phone Mob takes as separate fields.
+func (n Number) Mob() (zone, phone string) {
+	return n.region.Zone, n.national
+}
+
+// Aliyun formats the number for Aliyun SMS PhoneNumbers: mainland numbers
+// bare, others with their zone and no "+", e.g. "85261234567".
+func (n Number) Aliyun() string {
+	if n.region.Code == CN.Code {
+		return n.national
+	}
+	return n.region.Zone + n.national
+}
+
+// MarshalText encodes the number in E.164.
+func (n Number) MarshalText() ([]byte, error) {
+	return []byte(n.E164()), nil
+}
+
+// UnmarshalText decodes an E.164 number. Numbers without a zone are taken
+// to be mainland Chinese.
+func (n *Number) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text), CN)
+	if err != nil {
+		return err
+	}
+	*n = parsed
+	return nil
+}
@@ -0,0 +1,134 @@
+package phone
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		region  Region
+		e164    string
+		wantErr error
+	}{
+		{"Mainland", "13800138000", CN, "+8613800138000", nil},
+		{"Mainland with spaces", " 138 0013 8000 ", CN, "+8613800138000", nil},
+		{"Mainland with dashes", "138-0013-8000", CN, "+8613800138000", nil},
+		{"Mainland with zone", "+86 138 0013 8000", HK, "+8613800138000", nil},
+		{"Mainland with 00", "0086 13800138000", CN, "+8613800138000", nil},
+		{"Mainland without plus", "8613800138000", CN, "+8613800138000", nil},
+		{"Mainland with leading 0", "013800138000", CN, "+8613800138000", nil},
+		{"Full-width", "１３８００１３８０００", CN, "+8613800138000", nil},
+		{"Full-width plus", "＋８６　１３８　００１３　８０００", CN, "+8613800138000", nil},
+		{"Hong Kong", "+852 6123 4567", CN, "+85261234567", nil},
+		{"Hong Kong in region", "6123 4567", HK, "+85261234567", nil},
+		{"Macau", "+853 6612 3456", CN, "+85366123456", nil},
+		{"Taiwan with trunk", "0912-345-678", TW, "+886912345678", nil},
+		{"Taiwan with zone", "+886 912 345 678", CN, "+886912345678", nil},
+		{"United States", "+1 (212) 555-0100", CN, "+12125550100", nil},
+		{"United Kingdom with (0)", "+44 (0)7911 123456", CN, "+447911123456", nil},
+		{"Japan", "090-1234-5678", JP, "+819012345678", nil},
+		{"Korea", "010-1234-5678", KR, "+821012345678", nil},
+		{"Singapore", "+65 9123 4567", CN, "+6591234567", nil},
+		{"Mainland landline", "010 6552 9988", CN, "", ErrInvalid},
+		{"Mainland too short", "1380013800", CN, "", ErrInvalid},
+		{"Mainland too long", "138001380001", CN, "", ErrInvalid},
+		{"Hong Kong landline", "+852 2123 4567", CN, "", ErrInvalid},
+		{"Unknown zone", "+999 1234 5678", CN, "", ErrInvalid},
+		{"Letters", "138OO138OOO", CN, "", ErrInvalid},
+		{"Plus in the middle", "86+13800138000", CN, "", ErrInvalid},
+		{"Empty", " ", CN, "", ErrInvalid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := Parse(tc.input, tc.region)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tc.input, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tc.input, err)
+			}
+			if n.E164() != tc.e164 {
+				t.Errorf("Parse(%q) = %s, want %s", tc.input, n, tc.e164)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name     string
+		zone     string
+		national string
+		wantErr  error
+	}{
+		{"Mainland", "86", "13800138000", nil},
+		{"Zone with plus", "+852", "61234567", nil},
+		{"Trunk prefix", "886", "0912345678", ErrInvalid},
+		{"Separators", "86", "138-0013-8000", ErrInvalid},
+		{"Unknown zone", "999", "12345678", ErrUnknownRegion},
+		{"ISO code", "cn", "13800138000", ErrUnknownRegion},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.zone, tc.national)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("New(%q, %q) error = %v, want %v", tc.zone, tc.national, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormats(t *testing.T) {
+	mainland := MustParse("13800138000", CN)
+	hongKong := MustParse("+852 6123 4567", CN)
+
+	if zone, phone := mainland.Mob(); zone != "86" || phone != "13800138000" {
+		t.Errorf("Mob() = %s %s, want 86 13800138000", zone, phone)
+	}
+	if zone, phone := hongKong.Mob(); zone != "852" || phone != "61234567" {
+		t.Errorf("Mob() = %s %s, want 852 61234567", zone, phone)
+	}
+	if got := mainland.Aliyun(); got != "13800138000" {
+		t.Errorf("Aliyun() = %s, want 13800138000", got)
+	}
+	if got := hongKong.Aliyun(); got != "85261234567" {
+		t.Errorf("Aliyun() = %s, want 85261234567", got)
+	}
+	if hongKong.Region().Code != "HK" {
+		t.Errorf("Region() = %s, want HK", hongKong.Region().Code)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type user struct {
+		Phone Number `json:"phone"`
+	}
+
+	data, err := json.Marshal(user{Phone: MustParse("0912 345 678", TW)})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if string(data) != `{"phone":"+886912345678"}` {
+		t.Errorf("got %s, want E.164", data)
+	}
+
+	var u user
+	if err := json.Unmarshal([]byte(`{"phone":"13800138000"}`), &u); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if u.Phone.E164() != "+8613800138000" {
+		t.Errorf("got %s, want +8613800138000", u.Phone)
+	}
+	if err := json.Unmarshal([]byte(`{"phone":"12345"}`), &u); !errors.Is(err, ErrInvalid) {
+		t.Errorf("got %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,511 @@
+package redismigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	DEFAULT_BATCH_SIZE = 500
+	DEFAULT_SCAN_COUNT = 100
+)
+
+// Write is one member written to the destination.
+type Write struct {
+	Type  string
+	Key   string
+	Field string
+	Value string
+	Score float64
+}
+
+// String formats the write as the Redis command that performs it.
+func (w Write) String() string {
+	switch w.Type {
+	case TYPE_HASH:
+		return fmt.Sprintf("HSET %q %q %q", w.Key, w.Field, w.Value)
+	case TYPE_SET:
+		return fmt.Sprintf("SADD %q %q", w.Key, w.Value)
+	case TYPE_ZSET:
+		return fmt.Sprintf("ZADD %q %s %q", w.Key, formatScore(w.Score), w.Value)
+	case TYPE_LIST:
+		return fmt.Sprintf("RPUSH %q %q", w.Key, w.Value)
+	default:
+		return fmt.Sprintf("SET %q %q", w.Key, w.Value)
+	}
+}
+
+// Mismatch is a write the destination does not reflect. Got is what the
+// destination holds instead, empty when nothing.
+type Mismatch struct {
+	Write Write
+	Got   string
+}
+
+// Report counts what a migration read and wrote.
+type Report struct {
+	Spec   string
+	DryRun bool
+	Keys   int
+	Items  int
+	// Writes counts the writes made, or planned in a dry run.
+	Writes     int
+	Verified   int
+	Mismatches []Mismatch
+}
+
+// OK reports whether verification found nothing missing.
+func (r *Report) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+// WriteText writes a summary and the first mismatches.
+func (r *Report) WriteText(w io.Writer) error {
+	const MAX_MISMATCHES = 20
+
+	var sb strings.Builder
+	mode := "migrated"
+	if r.DryRun {
+		mode = "planned"
+	}
+	fmt.Fprintf(&sb, "%s: %d keys, %d items, %d writes %s, %d verified, %d missing\n",
+		r.Spec, r.Keys, r.Items, r.Writes, mode, r.Verified, len(r.Mismatches))
+	for i, m := range r.Mismatches {
+		if i == MAX_MISMATCHES {
+			fmt.Fprintf(&sb, "  ... %d more\n", len(r.Mismatches)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "  missing %s (got %q)\n", m.Write, m.Got)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Migrator runs specs against Redis. BatchSize is the number of commands
+// per pipeline. With DryRun nothing is written and the writes are logged
+// to Log instead; verification then shows what the migration would add.
+type Migrator struct {
+	Redis      redis.Cmdable
+	BatchSize  int
+	ScanCount  int64
+	DryRun     bool
+	SkipVerify bool
+	Log        io.Writer
+}
+
+func (m *Migrator) batchSize() int {
+	if m.BatchSize > 0 {
+		return m.BatchSize
+	}
+	return DEFAULT_BATCH_SIZE
+}
+
+// Migrate reads the spec's sources, writes their members to the
+// destination and verifies them.
+func (m *Migrator) Migrate(ctx context.Context, spec *Spec) (*Report, error) {
+	report := &Report{Spec: spec.Name, DryRun: m.DryRun}
+	writes, err := m.plan(ctx, spec, report)
+	if err != nil {
+		return report, err
+	}
+
+	if m.DryRun {
+		report.Writes = len(writes)
+		if m.Log != nil {
+			for _, w := range writes {
+				fmt.Fprintln(m.Log, w)
+			}
+		}
+	} else {
+		for batch := range slices.Chunk(writes, m.batchSize()) {
+			pipe := m.Redis.Pipeline()
+			for _, w := range batch {
+				write(ctx, pipe, w)
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return report, fmt.Errorf("redismigrate: %s: write batch after %d writes: %w", spec.Name, report.Writes, err)
+			}
+			report.Writes += len(batch)
+		}
+	}
+
+	if m.SkipVerify {
+		return report, nil
+	}
+	return report, m.verify(ctx, writes, report)
+}
+
+// Verify checks that the destination holds every member of the spec's
+// sources, without writing.
+func (m *Migrator) Verify(ctx context.Context, spec *Spec) (*Report, error) {
+	report := &Report{Spec: spec.Name, DryRun: true}
+	writes, err := m.plan(ctx, spec, report)
+	if err != nil {
+		return report, err
+	}
+	return report, m.verify(ctx, writes, report)
+}
+
+// plan scans and reads the sources and renders their writes. Sources are
+// scanned completely before anything is written, so a destination that
+// matches a source pattern is not read back.
+func (m *Migrator) plan(ctx context.Context, spec *Spec, report *Report) ([]Write, error) {
+	if !spec.compiled() {
+		if err := spec.Compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	keys, err := m.scan(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	report.Keys = len(keys)
+
+	var writes []Write
+	for batch := range slices.Chunk(keys, m.batchSize()) {
+		pipe := m.Redis.Pipeline()
+		cmds := make([]redis.Cmder, len(batch))
+		for i, key := range batch {
+			cmds[i] = read(ctx, pipe, spec.SourceType, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("redismigrate: %s: read batch: %w", spec.Name, err)
+		}
+
+		for i, key := range batch {
+			items, err := members(cmds[i])
+			if err != nil {
+				return nil, fmt.Errorf("redismigrate: %s: read %s: %w", spec.Name, key, err)
+			}
+			match := spec.match(key)
+			for _, item := range items {
+				item.Key, item.Match = key, match
+				w, err := spec.render(item)
+				if err != nil {
+					return nil, fmt.Errorf("redismigrate: %s: %s: %w", spec.Name, key, err)
+				}
+				writes = append(writes, w)
+			}
+			report.Items += len(items)
+		}
+	}
+	return writes, nil
+}
+
+// scan returns the keys of the source type matching any source pattern,
+// once each. It filters with TYPE rather than SCAN's TYPE option, which
+// needs Redis 6.
+func (m *Migrator) scan(ctx context.Context, spec *Spec) ([]string, error) {
+	count := m.ScanCount
+	if count == 0 {
+		count = DEFAULT_SCAN_COUNT
+	}
+
+	seen := map[string]bool{}
+	var keys []string
+	for _, pattern := range spec.Sources {
+		var cursor uint64
+		for {
+			batch, next, err := m.Redis.Scan(ctx, cursor, pattern, count).Result()
+			if err != nil {
+				return nil, fmt.Errorf("redismigrate: %s: scan %s: %w", spec.Name, pattern, err)
+			}
+			types, err := m.types(ctx, batch)
+			if err != nil {
+				return nil, fmt.Errorf("redismigrate: %s: scan %s: %w", spec.Name, pattern, err)
+			}
+			for i, key := range batch {
+				if types[i] == spec.SourceType && !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+	}
+	return keys, nil
+}
+
+// types returns the type of every key in one round trip, "none" for keys
+// that vanished since the scan.
+func (m *Migrator) types(ctx context.Context, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := m.Redis.Pipeline()
+	cmds := make([]*redis.StatusCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Type(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	types := make([]string, len(keys))
+	for i, cmd := range cmds {
+		types[i] = cmd.Val()
+	}
+	return types, nil
+}
+
+func read(ctx context.Context, pipe redis.Pipeliner, typ, key string) redis.Cmder {
+	switch typ {
+	case TYPE_LIST:
+		return pipe.LRange(ctx, key, 0, -1)
+	case TYPE_SET:
+		return pipe.SMembers(ctx, key)
+	case TYPE_ZSET:
+		return pipe.ZRangeWithScores(ctx, key, 0, -1)
+	case TYPE_HASH:
+		return pipe.HGetAll(ctx, key)
+	default:
+		return pipe.Get(ctx, key)
+	}
+}
+
+// members returns the members a read command got, hash fields in order. A
+// key that vanished since the scan has none.
+func members(cmd redis.Cmder) ([]Item, error) {
+	var items []Item
+	switch cmd := cmd.(type) {
+	case *redis.StringSliceCmd:
+		values, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			items = append(items, Item{Index: i, Value: v})
+		}
+	case *redis.ZSliceCmd:
+		zs, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, z := range zs {
+			items = append(items, Item{Index: i, Value: fmt.Sprint(z.Member), Score: z.Score})
+		}
+	case *redis.StringStringMapCmd:
+		fields, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range slices.Sorted(maps.Keys(fields)) {
+			items = append(items, Item{Field: field, Value: fields[field]})
+		}
+	case *redis.StringCmd:
+		v, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, Item{Value: v})
+	}
+	return items, nil
+}
+
+func (s *Spec) render(item Item) (Write, error) {
+	w := Write{Type: s.DestinationType}
+	var err error
+	if w.Key, err = execute(s.destination, item); err != nil {
+		return w, err
+	}
+	if w.Value, err = execute(s.value, item); err != nil {
+		return w, err
+	}
+	if w.Field, err = execute(s.field, item); err != nil {
+		return w, err
+	}
+	score, err := execute(s.score, item)
+	if err != nil {
+		return w, err
+	}
+
+	if w.Key == "" {
+		return w, errors.New("empty destination key")
+	}
+	if w.Type == TYPE_HASH && w.Field == "" {
+		return w, fmt.Errorf("empty field for %q", item.Value)
+	}
+	if w.Type == TYPE_ZSET {
+		if w.Score, err = strconv.ParseFloat(score, 64); err != nil {
+			return w, fmt.Errorf("score of %q: %w", item.Value, err)
+		}
+	}
+	return w, nil
+}
+
+func execute(t *template.Template, item Item) (string, error) {
+	var sb strings.Builder
+	if err := t.Execute(&sb, item); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func write(ctx context.Context, pipe redis.Pipeliner, w Write) {
+	switch w.Type {
+	case TYPE_HASH:
+		pipe.HSet(ctx, w.Key, w.Field, w.Value)
+	case TYPE_SET:
+		pipe.SAdd(ctx, w.Key, w.Value)
+	case TYPE_ZSET:
+		pipe.ZAdd(ctx, w.Key, &redis.Z{Score: w.Score, Member: w.Value})
+	case TYPE_LIST:
+		pipe.RPush(ctx, w.Key, w.Value)
+	default:
+		pipe.Set(ctx, w.Key, w.Value, 0)
+	}
+}
+
+// verify checks the destination against the writes. Later writes to the
+// same hash field, string or sorted-set member win, as they do in Redis;
+// list members must all be present, as many times as written.
+func (m *Migrator) verify(ctx context.Context, writes []Write, report *Report) error {
+	expected := make([]Write, 0, len(writes))
+	last := map[string]int{}
+	lists := map[string]map[string]int{}
+	for _, w := range writes {
+		if w.Type == TYPE_LIST {
+			if lists[w.Key] == nil {
+				lists[w.Key] = map[string]int{}
+				expected = append(expected, Write{Type: TYPE_LIST, Key: w.Key})
+			}
+			lists[w.Key][w.Value]++
+			continue
+		}
+
+		id := w.Key + "\x00" + w.Field
+		if w.Type == TYPE_SET || w.Type == TYPE_ZSET {
+			id = w.Key + "\x00" + w.Value
+		}
+		if i, ok := last[id]; ok {
+			expected[i] = w
+			continue
+		}
+		last[id] = len(expected)
+		expected = append(expected, w)
+	}
+
+	for batch := range slices.Chunk(expected, m.batchSize()) {
+		pipe := m.Redis.Pipeline()
+		cmds := make([]redis.Cmder, len(batch))
+		for i, w := range batch {
+			cmds[i] = check(ctx, pipe, w)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("redismigrate: %s: verify batch: %w", report.Spec, err)
+		}
+
+		for i, w := range batch {
+			if w.Type == TYPE_LIST {
+				if err := verifyList(cmds[i], w, lists[w.Key], report); err != nil {
+					return err
+				}
+				continue
+			}
+
+			got, err := holds(cmds[i], w)
+			if err != nil {
+				return fmt.Errorf("redismigrate: %s: verify %s: %w", report.Spec, w.Key, err)
+			}
+			if got == nil {
+				report.Verified++
+			} else {
+				report.Mismatches = append(report.Mismatches, *got)
+			}
+		}
+	}
+	return nil
+}
+
+func check(ctx context.Context, pipe redis.Pipeliner, w Write) redis.Cmder {
+	switch w.Type {
+	case TYPE_HASH:
+		return pipe.HGet(ctx, w.Key, w.Field)
+	case TYPE_SET:
+		return pipe.SIsMember(ctx, w.Key, w.Value)
+	case TYPE_ZSET:
+		return pipe.ZScore(ctx, w.Key, w.Value)
+	case TYPE_LIST:
+		return pipe.LRange(ctx, w.Key, 0, -1)
+	default:
+		return pipe.Get(ctx, w.Key)
+	}
+}
+
+// holds returns a Mismatch unless cmd shows the destination holding w.
+func holds(cmd redis.Cmder, w Write) (*Mismatch, error) {
+	switch cmd := cmd.(type) {
+	case *redis.StringCmd:
+		got, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			return &Mismatch{Write: w}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if got != w.Value {
+			return &Mismatch{Write: w, Got: got}, nil
+		}
+	case *redis.BoolCmd:
+		ok, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return &Mismatch{Write: w}, nil
+		}
+	case *redis.FloatCmd:
+		score, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			return &Mismatch{Write: w}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if score != w.Score {
+			return &Mismatch{Write: w, Got: formatScore(score)}, nil
+		}
+	}
+	return nil, nil
+}
+
+func verifyList(cmd redis.Cmder, w Write, want map[string]int, report *Report) error {
+	values, err := cmd.(*redis.StringSliceCmd).Result()
+	if err != nil {
+		return fmt.Errorf("redismigrate: %s: verify %s: %w", report.Spec, w.Key, err)
+	}
+	got := map[string]int{}
+	for _, v := range values {
+		got[v]++
+	}
+	for _, value := range slices.Sorted(maps.Keys(want)) {
+		for i := range want[value] {
+			if i < got[value] {
+				report.Verified++
+			} else {
+				report.Mismatches = append(report.Mismatches, Mismatch{Write: Write{Type: TYPE_LIST, Key: w.Key, Value: value}})
+			}
+		}
+	}
+	return nil
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
@@ -0,0 +1,256 @@
+package redismigrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newRedis returns a client for an in-memory Redis that stops with the
+// test.
+func newRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	db := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestGlobRegexp(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pattern string
+		key     string
+		match   []string
+	}{
+		{"Star", "jobs:*:paused", "jobs:a1:paused", []string{"a1"}},
+		{"Two stars", "jobs:*:history:*", "jobs:a:history:b:c", []string{"a", "b:c"}},
+		{"Question mark", "user:?", "user:7", []string{"7"}},
+		{"Class", "user:[ab]x", "user:bx", []string{"b"}},
+		{"Escaped star", `user:\*`, "user:*", []string{}},
+		{"Regexp metacharacters", "a.b+c", "a.b+c", []string{}},
+		{"No match", "jobs:*:paused", "jobs:a1:processing", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			re, err := globRegexp(tc.pattern)
+			if err != nil {
+				t.Fatalf("Failed to compile %q: %v", tc.pattern, err)
+			}
+			m := re.FindStringSubmatch(tc.key)
+			if tc.match == nil {
+				if m != nil {
+					t.Errorf("got %q, want no match", m)
+				}
+				return
+			}
+			if m == nil || strings.Join(m[1:], ",") != strings.Join(tc.match, ",") {
+				t.Errorf("got %q, want %q", m, tc.match)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	testCases := []struct {
+		name string
+		spec Spec
+	}{
+		{"No sources", Spec{Destination: "d", SourceType: TYPE_LIST, DestinationType: TYPE_SET}},
+		{"Unknown type", Spec{Sources: []string{"s"}, Destination: "d", SourceType: "stream", DestinationType: TYPE_SET}},
+		{"Hash without field", Spec{Sources: []string{"s"}, Destination: "d", SourceType: TYPE_LIST, DestinationType: TYPE_HASH}},
+		{"Zset without score", Spec{Sources: []string{"s"}, Destination: "d", SourceType: TYPE_SET, DestinationType: TYPE_ZSET}},
+		{"Bad template", Spec{Sources: []string{"s"}, Destination: "{{.Key", SourceType: TYPE_SET, DestinationType: TYPE_SET}},
+		{"Bad pattern", Spec{Sources: []string{"s[a"}, Destination: "d", SourceType: TYPE_SET, DestinationType: TYPE_SET}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.spec.Compile(); !errors.Is(err, ErrInvalidSpec) {
+				t.Errorf("got %v, want ErrInvalidSpec", err)
+			}
+		})
+	}
+}
+
+func TestMigrateListToHash(t *testing.T) {
+	ctx := context.Background()
+	db := newRedis(t)
+
+	db.RPush(ctx, "jobs:servers:history:a:processing", "job1", "job2")
+	db.RPush(ctx, "jobs:servers:history:b:paused", "job3")
+	db.RPush(ctx, "jobs:servers:history:c:done", "job4")
+	// Matches the pattern but is not a list.
+	db.Set(ctx, "jobs:servers:history:d:paused", "job5", 0)
+
+	specs, err := Load(strings.NewReader(`[{
+		"name": "active history",
+		"sources": ["jobs:servers:history:*:processing", "jobs:servers:history:*:paused"],
+		"source_type": "list",
+		"destination": "jobs:servers:history:temp:active",
+		"destination_type": "hash",
+		"field": "{{.Value}}",
+		"value": "history"
+	}]`))
+	if err != nil {
+		t.Fatalf("Failed to load specs: %v", err)
+	}
+
+	var log strings.Builder
+	dryRun := &Migrator{Redis: db, BatchSize: 2, DryRun: true, Log: &log}
+	report, err := dryRun.Migrate(ctx, specs[0])
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if report.Keys != 2 || report.Items != 3 || report.Writes != 3 || len(report.Mismatches) != 3 {
+		t.Errorf("got %+v, want 2 keys, 3 items, 3 planned writes and 3 missing", report)
+	}
+	var summary strings.Builder
+	report.WriteText(&summary)
+	if !strings.Contains(summary.String(), "3 writes planned") {
+		t.Errorf("got summary %q, want 3 writes planned", summary.String())
+	}
+	if n, _ := db.Exists(ctx, "jobs:servers:history:temp:active").Result(); n != 0 {
+		t.Errorf("Dry run wrote the destination")
+	}
+	if !strings.Contains(log.String(), `HSET "jobs:servers:history:temp:active" "job3" "history"`) {
+		t.Errorf("got log %q, want the planned HSET", log.String())
+	}
+
+	m := &Migrator{Redis: db, BatchSize: 2}
+	report, err = m.Migrate(ctx, specs[0])
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if report.Writes != 3 || report.Verified != 3 || !report.OK() {
+		t.Errorf("got %+v, want 3 writes verified", report)
+	}
+	got, err := db.HGetAll(ctx, "jobs:servers:history:temp:active").Result()
+	if err != nil {
+		t.Fatalf("Failed to read the destination: %v", err)
+	}
+	if len(got) != 3 || got["job1"] != "history" || got["job3"] != "history" {
+		t.Errorf("got %v, want job1-3 set to history", got)
+	}
+
+	// Verification catches changes made after the migration.
+	db.HSet(ctx, "jobs:servers:history:temp:active", "job2", "current")
+	report, err = m.Verify(ctx, specs[0])
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Write.Field != "job2" || report.Mismatches[0].Got != "current" {
+		t.Errorf("got %+v, want job2 mismatched", report.Mismatches)
+	}
+	var text strings.Builder
+	report.WriteText(&text)
+	if !strings.Contains(text.String(), `1 missing`) {
+		t.Errorf("got %q, want the mismatch counted", text.String())
+	}
+}
+
+func TestMigrateTypes(t *testing.T) {
+	ctx := context.Background()
+	db := newRedis(t)
+
+	db.HSet(ctx, "user:1", "name", "ann", "city", "oslo")
+	db.HSet(ctx, "user:2", "name", "bob")
+	db.SAdd(ctx, "tags:go", "fast", "typed")
+	db.Set(ctx, "token:abc", "1", 0)
+
+	testCases := []struct {
+		name  string
+		spec  Spec
+		check func(t *testing.T)
+	}{
+		{
+			name: "Hash to hash per source key",
+			spec: Spec{Sources: []string{"user:*"}, SourceType: TYPE_HASH, Destination: "profile:{{index .Match 0}}", DestinationType: TYPE_HASH},
+			check: func(t *testing.T) {
+				if got := db.HGet(ctx, "profile:1", "city").Val(); got != "oslo" {
+					t.Errorf("got %q, want oslo", got)
+				}
+			},
+		},
+		{
+			name: "Hash fields to set",
+			spec: Spec{Sources: []string{"user:*"}, SourceType: TYPE_HASH, Destination: "names", DestinationType: TYPE_SET, Value: "{{if eq .Field \"name\"}}{{.Value}}{{else}}-{{end}}"},
+			check: func(t *testing.T) {
+				if !db.SIsMember(ctx, "names", "bob").Val() || !db.SIsMember(ctx, "names", "ann").Val() {
+					t.Errorf("got %v, want ann and bob", db.SMembers(ctx, "names").Val())
+				}
+			},
+		},
+		{
+			name: "Set to zset",
+			spec: Spec{Sources: []string{"tags:*"}, SourceType: TYPE_SET, Destination: "tag-rank", DestinationType: TYPE_ZSET, Value: "{{index .Match 0}}:{{.Value}}", Score: "1.5"},
+			check: func(t *testing.T) {
+				if got := db.ZScore(ctx, "tag-rank", "go:typed").Val(); got != 1.5 {
+					t.Errorf("got %v, want 1.5", got)
+				}
+			},
+		},
+		{
+			name: "Zset to list",
+			spec: Spec{Sources: []string{"tag-rank"}, SourceType: TYPE_ZSET, Destination: "tag-list", DestinationType: TYPE_LIST, Value: "{{.Value}}={{.Score}}"},
+			check: func(t *testing.T) {
+				if got := db.LRange(ctx, "tag-list", 0, -1).Val(); len(got) != 2 || got[0] != "go:fast=1.5" {
+					t.Errorf("got %v, want the members with scores", got)
+				}
+			},
+		},
+		{
+			name: "String to string",
+			spec: Spec{Sources: []string{"token:*"}, SourceType: TYPE_STRING, Destination: "session:{{index .Match 0}}", DestinationType: TYPE_STRING},
+			check: func(t *testing.T) {
+				if got := db.Get(ctx, "session:abc").Val(); got != "1" {
+					t.Errorf("got %q, want 1", got)
+				}
+			},
+		},
+	}
+
+	m := &Migrator{Redis: db, BatchSize: 1}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := m.Migrate(ctx, &tc.spec)
+			if err != nil {
+				t.Fatalf("Failed to migrate: %v", err)
+			}
+			if !report.OK() || report.Verified == 0 {
+				t.Errorf("got %+v, want everything verified", report)
+			}
+			tc.check(t)
+		})
+	}
+}
+
+func TestMigrateListVerification(t *testing.T) {
+	ctx := context.Background()
+	db := newRedis(t)
+
+	db.RPush(ctx, "queue:a", "x", "x", "y")
+
+	spec := &Spec{Sources: []string{"queue:*"}, SourceType: TYPE_LIST, Destination: "queues", DestinationType: TYPE_LIST}
+	m := &Migrator{Redis: db}
+	if _, err := m.Migrate(ctx, spec); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	// Lose one of the two x.
+	db.Del(ctx, "queues")
+	db.RPush(ctx, "queues", "y", "x")
+	report, err := m.Verify(ctx, spec)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if report.Verified != 2 || len(report.Mismatches) != 1 || report.Mismatches[0].Write.Value != "x" {
+		t.Errorf("got %+v, want one x missing", report)
+	}
+}
@@ -0,0 +1,188 @@
+// Package redismigrate copies the members of Redis keys into other keys as
+// a declarative Spec describes: which keys to read, as what type, and how
+// to render the destination key, field and value of each member. It runs
+// in pipelined batches, can plan without writing, and verifies that the
+// destination holds what the spec says it should.
+package redismigrate
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	TYPE_STRING = "string"
+	TYPE_LIST   = "list"
+	TYPE_SET    = "set"
+	TYPE_ZSET   = "zset"
+	TYPE_HASH   = "hash"
+)
+
+var ErrInvalidSpec = errors.New("redismigrate: invalid spec")
+
+// Spec describes one migration. Every key matching one of Sources (SCAN
+// patterns) and holding SourceType is read member by member, and each
+// member is written to a key of DestinationType.
+//
+// Destination, Field, Value and Score are text/template templates executed
+// with the member's Item. Field is needed for hash destinations, Score for
+// sorted-set destinations; Value defaults to the member's value, and for
+// hash and sorted-set sources Field and Score default to the member's.
+//
+// Lists are appended to, so running a spec with a list destination twice
+// duplicates its members.
+type Spec struct {
+	Name            string   `json:"name"`
+	Sources         []string `json:"sources"`
+	SourceType      string   `json:"source_type"`
+	Destination     string   `json:"destination"`
+	DestinationType string   `json:"destination_type"`
+	Field           string   `json:"field,omitempty"`
+	Value           string   `json:"value,omitempty"`
+	Score           string   `json:"score,omitempty"`
+
+	sources     []*regexp.Regexp
+	destination *template.Template
+	field       *template.Template
+	value       *template.Template
+	score       *template.Template
+}
+
+// Item is a member of a source key, as the templates see it. Match holds
+// what the wildcards of the source pattern matched in Key, so the
+// destination of "jobs:*:paused" can be "jobs:{{index .Match 0}}:active".
+type Item struct {
+	Key   string
+	Match []string
+	Index int
+	Field string
+	Value string
+	Score float64
+}
+
+// Load reads a JSON array of specs and compiles them.
+func Load(r io.Reader) ([]*Spec, error) {
+	var specs []*Spec
+	if err := json.NewDecoder(r).Decode(&specs); err != nil {
+		return nil, fmt.Errorf("redismigrate: decode specs: %w", err)
+	}
+	for _, spec := range specs {
+		if err := spec.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return specs, nil
+}
+
+func validType(typ string) bool {
+	switch typ {
+	case TYPE_STRING, TYPE_LIST, TYPE_SET, TYPE_ZSET, TYPE_HASH:
+		return true
+	}
+	return false
+}
+
+// Compile checks the spec and parses its patterns and templates. Migrator
+// compiles specs that were not compiled yet.
+func (s *Spec) Compile() error {
+	if len(s.Sources) == 0 || s.Destination == "" {
+		return fmt.Errorf("%w %q: sources and destination are required", ErrInvalidSpec, s.Name)
+	}
+	if !validType(s.SourceType) || !validType(s.DestinationType) {
+		return fmt.Errorf("%w %q: types %q -> %q", ErrInvalidSpec, s.Name, s.SourceType, s.DestinationType)
+	}
+
+	field, value, score := s.Field, cmp.Or(s.Value, "{{.Value}}"), s.Score
+	if s.SourceType == TYPE_HASH {
+		field = cmp.Or(field, "{{.Field}}")
+	}
+	if s.SourceType == TYPE_ZSET {
+		score = cmp.Or(score, "{{.Score}}")
+	}
+	if s.DestinationType == TYPE_HASH && field == "" {
+		return fmt.Errorf("%w %q: a hash destination needs a field", ErrInvalidSpec, s.Name)
+	}
+	if s.DestinationType == TYPE_ZSET && score == "" {
+		return fmt.Errorf("%w %q: a zset destination needs a score", ErrInvalidSpec, s.Name)
+	}
+
+	s.sources = nil
+	for _, pattern := range s.Sources {
+		re, err := globRegexp(pattern)
+		if err != nil {
+			return fmt.Errorf("%w %q: source %q: %w", ErrInvalidSpec, s.Name, pattern, err)
+		}
+		s.sources = append(s.sources, re)
+	}
+
+	var err error
+	for _, t := range []struct {
+		dst  **template.Template
+		name string
+		text string
+	}{
+		{&s.destination, "destination", s.Destination},
+		{&s.field, "field", field},
+		{&s.value, "value", value},
+		{&s.score, "score", score},
+	} {
+		*t.dst, err = template.New(t.name).Option("missingkey=error").Parse(t.text)
+		if err != nil {
+			return fmt.Errorf("%w %q: %w", ErrInvalidSpec, s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Spec) compiled() bool {
+	return s.destination != nil
+}
+
+// match returns what the wildcards of the first matching source pattern
+// matched in key.
+func (s *Spec) match(key string) []string {
+	for _, re := range s.sources {
+		if m := re.FindStringSubmatch(key); m != nil {
+			return m[1:]
+		}
+	}
+	return nil
+}
+
+// globRegexp translates a SCAN pattern into a regexp with a group per
+// wildcard.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			sb.WriteString("(.*)")
+		case '?':
+			sb.WriteString("(.)")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated [")
+			}
+			class := pattern[i+1 : i+1+end]
+			sb.WriteString("([" + strings.ReplaceAll(class, `\`, `\\`) + "])")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,140 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tests/credentials"
+)
+
+// brokenCodes fails every Save.
+type brokenCodes struct {
+	CodeStore
+}
+
+func (brokenCodes) Save(ctx context.Context, zone, phone, code string) error {
+	return errors.New("code store unavailable")
+}
+
+// newFakeAliyun answers SendSms like dysmsapi, checking the signature, and
+// rejects numbers starting with "170".
+func newFakeAliyun(t *testing.T, codes CodeStore) (*Aliyun, *[]url.Values) {
+	t.Helper()
+
+	const secret = "test-secret"
+	var requests []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form := r.PostForm
+		requests = append(requests, form)
+
+		unsigned := url.Values{}
+		for key, value := range form {
+			if key != "Signature" {
+				unsigned[key] = value
+			}
+		}
+
+		result := map[string]string{"Code": ALIYUN_CODE_OK, "BizId": "biz-1", "RequestId": "req-1"}
+		switch {
+		case form.Get("Signature") != credentials.SignRPC(http.MethodPost, unsigned, secret):
+			result = map[string]string{"Code": "SignatureDoesNotMatch", "Message": "bad signature", "RequestId": "req-1"}
+		case strings.HasPrefix(form.Get("PhoneNumbers"), "170"):
+			result = map[string]string{"Code": "isv.MOBILE_NUMBER_ILLEGAL", "Message": "illegal number", "RequestId": "req-1"}
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(server.Close)
+
+	return &Aliyun{
+		Credentials:  &credentials.Static{Credentials: credentials.Credentials{AccessKeyID: "test-key", AccessKeySecret: secret}},
+		SignName:     "Test",
+		Templates:    map[string]string{"shipped": "SMS_100"},
+		CodeTemplate: "SMS_200",
+		Codes:        codes,
+		Endpoint:     server.URL,
+		Now:          func() time.Time { return time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC) },
+	}, &requests
+}
+
+func TestAliyun(t *testing.T) {
+	ctx := context.Background()
+	_, db := newRedis(t)
+	aliyun, requests := newFakeAliyun(t, &RedisCodes{Redis: db})
+
+	receipt, err := aliyun.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped", Params: map[string]string{"order": "42"}})
+	if err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if receipt.Provider != PROVIDER_ALIYUN || receipt.ID != "biz-1" {
+		t.Errorf("got %+v, want the BizId from aliyun", receipt)
+	}
+	form := (*requests)[0]
+	if form.Get("PhoneNumbers") != "13800138000" || form.Get("TemplateCode") != "SMS_100" || form.Get("TemplateParam") != `{"order":"42"}` {
+		t.Errorf("Unexpected form %v", form)
+	}
+	if form.Get("Timestamp") != "2024-05-01T08:00:00Z" || form.Get("SignName") != "Test" {
+		t.Errorf("Unexpected form %v", form)
+	}
+
+	if _, err := aliyun.Notify(ctx, &Notification{Zone: "852", Phone: "61234567", Template: "shipped"}); err != nil {
+		t.Fatalf("Failed to notify abroad: %v", err)
+	}
+	if got := (*requests)[1].Get("PhoneNumbers"); got != "85261234567" {
+		t.Errorf("PhoneNumbers = %s, want 85261234567", got)
+	}
+
+	if _, err := aliyun.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "unknown"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want ErrUnsupported", err)
+	}
+
+	var aliyunErr *AliyunError
+	if err := aliyun.SendCode(ctx, "86", "17012345678"); !errors.Is(err, ErrInvalidPhone) || !errors.As(err, &aliyunErr) {
+		t.Errorf("got %v, want an AliyunError for a rejected phone", err)
+	}
+	sent := len(*requests)
+	if err := aliyun.SendCode(ctx, "86", "0138"); !errors.Is(err, ErrInvalidPhone) || len(*requests) != sent {
+		t.Errorf("got %v after %d requests, want ErrInvalidPhone without a request", err, len(*requests)-sent)
+	}
+
+	if err := aliyun.SendCode(ctx, "86", "13800138000"); err != nil {
+		t.Fatalf("Failed to send a code: %v", err)
+	}
+	var params map[string]string
+	if err := json.Unmarshal([]byte((*requests)[len(*requests)-1].Get("TemplateParam")), &params); err != nil {
+		t.Fatalf("Failed to decode TemplateParam: %v", err)
+	}
+	code := params[DEFAULT_CODE_PARAM]
+	if len(code) != DEFAULT_CODE_LENGTH {
+		t.Fatalf("got code %q, want %d digits", code, DEFAULT_CODE_LENGTH)
+	}
+
+	if err := aliyun.VerifyCode(ctx, "86", "13800138000", "wrong"); !errors.Is(err, ErrWrongCode) {
+		t.Errorf("got %v, want ErrWrongCode", err)
+	}
+	if err := aliyun.VerifyCode(ctx, "86", "13800138000", code); err != nil {
+		t.Errorf("Failed to verify the code: %v", err)
+	}
+	if err := aliyun.VerifyCode(ctx, "86", "13800138000", code); !errors.Is(err, ErrWrongCode) {
+		t.Errorf("got %v, want ErrWrongCode for a used code", err)
+	}
+
+	// A code that cannot be saved is not sent.
+	aliyun.Codes = brokenCodes{}
+	sent = len(*requests)
+	if err := aliyun.SendCode(ctx, "86", "13800138000"); err == nil || len(*requests) != sent {
+		t.Errorf("got %v after %d requests, want the store's error without a request", err, len(*requests)-sent)
+	}
+
+	aliyun.Credentials = &credentials.Static{Credentials: credentials.Credentials{AccessKeyID: "test-key", AccessKeySecret: "other"}}
+	if _, err := aliyun.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"}); !errors.As(err, &aliyunErr) || aliyunErr.Code != "SignatureDoesNotMatch" {
+		t.Errorf("got %v, want a signature error", err)
+	}
+}
@@ -0,0 +1,126 @@
+package sms
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	PROVIDER_FAKE = "fake"
+)
+
+// Fake is a Provider that delivers nothing and remembers what it sent, for
+// tests and local development. It fails with Err when set and takes Delay
+// to answer, honouring the context meanwhile.
+type Fake struct {
+	ProviderName string
+	Err          error
+	Delay        time.Duration
+
+	mu            sync.Mutex
+	codes         map[string]string
+	notifications []Notification
+	sent          int
+}
+
+func (f *Fake) Name() string {
+	return cmp.Or(f.ProviderName, PROVIDER_FAKE)
+}
+
+func (f *Fake) wait(ctx context.Context) error {
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Err
+}
+
+func (f *Fake) SendCode(ctx context.Context, zone, phone string) error {
+	if err := checkNumber(zone, phone); err != nil {
+		return err
+	}
+	if err := f.wait(ctx); err != nil {
+		return err
+	}
+	code, err := GenerateCode()
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.codes == nil {
+		f.codes = map[string]string{}
+	}
+	f.codes[zone+":"+phone] = code
+	f.sent++
+	return nil
+}
+
+func (f *Fake) VerifyCode(ctx context.Context, zone, phone, code string) error {
+	if err := checkNumber(zone, phone); err != nil {
+		return err
+	}
+	if err := f.wait(ctx); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := zone + ":" + phone
+	if stored, ok := f.codes[key]; !ok || code == "" || stored != code {
+		return ErrWrongCode
+	}
+	delete(f.codes, key)
+	return nil
+}
+
+func (f *Fake) Notify(ctx context.Context, n *Notification) (*Receipt, error) {
+	if err := checkNumber(n.Zone, n.Phone); err != nil {
+		return nil, err
+	}
+	if err := f.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := *n
+	stored.Params = maps.Clone(n.Params)
+	f.notifications = append(f.notifications, stored)
+	f.sent++
+	return &Receipt{Provider: f.Name(), ID: fmt.Sprintf("%s-%d", f.Name(), f.sent)}, nil
+}
+
+// Code returns the code last sent to the phone and not yet verified.
+func (f *Fake) Code(zone, phone string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	code, ok := f.codes[zone+":"+phone]
+	return code, ok
+}
+
+// Notifications returns the notifications sent so far.
+func (f *Fake) Notifications() []Notification {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.notifications)
+}
+
+// Sent returns the number of codes and notifications sent.
+func (f *Fake) Sent() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sent
+}
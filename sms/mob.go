@@ -0,0 +1,173 @@
+package sms
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	PROVIDER_MOB = "mob"
+
+	MOB_SEND_URL   = "https://webapi.sms.mob.com/sms/sendmsg"
+	MOB_VERIFY_URL = "https://webapi.sms.mob.com/sms/verify"
+)
+
+// MobStatus is the status code in a Mob web API response.
+type MobStatus int
+
+const (
+	MOB_STATUS_OK                MobStatus = 200
+	MOB_STATUS_APPKEY_EMPTY      MobStatus = 405
+	MOB_STATUS_APPKEY_INVALID    MobStatus = 406
+	MOB_STATUS_NUMBER_EMPTY      MobStatus = 456
+	MOB_STATUS_NUMBER_INVALID    MobStatus = 457
+	MOB_STATUS_CODE_EMPTY        MobStatus = 466
+	MOB_STATUS_VERIFY_TOO_OFTEN  MobStatus = 467
+	MOB_STATUS_CODE_WRONG        MobStatus = 468
+	MOB_STATUS_SERVER_VERIFY_OFF MobStatus = 474
+	MOB_STATUS_APP_INVALID       MobStatus = 475
+	MOB_STATUS_PHONE_DAILY_LIMIT MobStatus = 477
+	MOB_STATUS_PHONE_APP_LIMIT   MobStatus = 478
+	MOB_STATUS_SERVER_ERROR      MobStatus = 500
+)
+
+var mobStatusText = map[MobStatus]string{
+	MOB_STATUS_OK:                "ok",
+	MOB_STATUS_APPKEY_EMPTY:      "appkey is empty",
+	MOB_STATUS_APPKEY_INVALID:    "appkey is invalid",
+	MOB_STATUS_NUMBER_EMPTY:      "zone or phone is empty",
+	MOB_STATUS_NUMBER_INVALID:    "phone number is invalid",
+	MOB_STATUS_CODE_EMPTY:        "code is empty",
+	MOB_STATUS_VERIFY_TOO_OFTEN:  "verified too often",
+	MOB_STATUS_CODE_WRONG:        "code is wrong or expired",
+	MOB_STATUS_SERVER_VERIFY_OFF: "server-side verification is not enabled",
+	MOB_STATUS_APP_INVALID:       "app is misconfigured",
+	MOB_STATUS_PHONE_DAILY_LIMIT: "phone exceeded its daily limit",
+	MOB_STATUS_PHONE_APP_LIMIT:   "phone exceeded the app's limit",
+	MOB_STATUS_SERVER_ERROR:      "server error",
+}
+
+func (s MobStatus) String() string {
+	if text, ok := mobStatusText[s]; ok {
+		return text
+	}
+	return fmt.Sprintf("status %d", int(s))
+}
+
+// mobStatusErrors maps the statuses callers handle to the package errors.
+var mobStatusErrors = map[MobStatus]error{
+	MOB_STATUS_NUMBER_EMPTY:      ErrInvalidPhone,
+	MOB_STATUS_NUMBER_INVALID:    ErrInvalidPhone,
+	MOB_STATUS_CODE_EMPTY:        ErrWrongCode,
+	MOB_STATUS_CODE_WRONG:        ErrWrongCode,
+	MOB_STATUS_VERIFY_TOO_OFTEN:  ErrTooManyAttempts,
+	MOB_STATUS_PHONE_DAILY_LIMIT: ErrThrottled,
+	MOB_STATUS_PHONE_APP_LIMIT:   ErrThrottled,
+}
+
+// MobError is a non-200 status from Mob. It unwraps to ErrInvalidPhone,
+// ErrWrongCode, ErrTooManyAttempts or ErrThrottled where one applies.
+type MobError struct {
+	Status  MobStatus
+	Message string
+}
+
+func (e *MobError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("sms: mob %d %s: %s", int(e.Status), e.Status, e.Message)
+	}
+	return fmt.Sprintf("sms: mob %d %s", int(e.Status), e.Status)
+}
+
+func (e *MobError) Unwrap() error {
+	return mobStatusErrors[e.Status]
+}
+
+// Mob sends and verifies codes through the Mob SMS web API. Mob generates
+// the code and checks it, so nothing is stored here.
+type Mob struct {
+	AppKey string
+	// SendURL and VerifyURL default to MOB_SEND_URL and MOB_VERIFY_URL.
+	SendURL    string
+	VerifyURL  string
+	HTTPClient *http.Client
+}
+
+func (m *Mob) Name() string {
+	return PROVIDER_MOB
+}
+
+// Notify is unsupported: Mob's web API only sends verification codes.
+func (m *Mob) Notify(ctx context.Context, n *Notification) (*Receipt, error) {
+	return nil, fmt.Errorf("%w: mob sends codes only", ErrUnsupported)
+}
+
+func (m *Mob) SendCode(ctx context.Context, zone, phone string) error {
+	if err := checkNumber(zone, phone); err != nil {
+		return err
+	}
+	return m.post(ctx, cmp.Or(m.SendURL, MOB_SEND_URL), url.Values{
+		"appkey": {m.AppKey},
+		"zone":   {zone},
+		"phone":  {phone},
+	})
+}
+
+func (m *Mob) VerifyCode(ctx context.Context, zone, phone, code string) error {
+	if err := checkNumber(zone, phone); err != nil {
+		return err
+	}
+	if code == "" {
+		return ErrWrongCode
+	}
+	return m.post(ctx, cmp.Or(m.VerifyURL, MOB_VERIFY_URL), url.Values{
+		"appkey": {m.AppKey},
+		"zone":   {zone},
+		"phone":  {phone},
+		"code":   {code},
+	})
+}
+
+func (m *Mob) post(ctx context.Context, endpoint string, form url.Values) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := m.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sms: mob http %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		Status MobStatus `json:"status"`
+		Error  string    `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("sms: decode mob response %q: %w", body, err)
+	}
+	if result.Status != MOB_STATUS_OK {
+		return &MobError{Status: result.Status, Message: result.Error}
+	}
+	return nil
+}
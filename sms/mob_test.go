@@ -0,0 +1,95 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newFakeMob answers like Mob: code "1234" verifies and numbers starting
+// with "170" are rejected, as Mob does for some virtual carriers.
+func newFakeMob(t *testing.T) (*Mob, *[]url.Values) {
+	t.Helper()
+
+	var requests []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		r.ParseForm()
+		requests = append(requests, r.PostForm)
+
+		result := map[string]any{"status": MOB_STATUS_OK}
+		switch {
+		case r.PostForm.Get("appkey") != "test-app":
+			result = map[string]any{"status": MOB_STATUS_APPKEY_INVALID, "error": "appkey invalid"}
+		case strings.HasPrefix(r.PostForm.Get("phone"), "170"):
+			result = map[string]any{"status": MOB_STATUS_NUMBER_INVALID}
+		case r.URL.Path == "/sms/verify" && r.PostForm.Get("code") != "1234":
+			result = map[string]any{"status": MOB_STATUS_CODE_WRONG}
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(server.Close)
+
+	return &Mob{
+		AppKey:    "test-app",
+		SendURL:   server.URL + "/sms/sendmsg",
+		VerifyURL: server.URL + "/sms/verify",
+	}, &requests
+}
+
+func TestMob(t *testing.T) {
+	ctx := context.Background()
+	mob, requests := newFakeMob(t)
+
+	if err := mob.SendCode(ctx, "86", "13800138000"); err != nil {
+		t.Fatalf("Failed to send a code: %v", err)
+	}
+	if got := (*requests)[0]; got.Get("zone") != "86" || got.Get("phone") != "13800138000" || got.Get("appkey") != "test-app" {
+		t.Errorf("Unexpected form %v", got)
+	}
+
+	testCases := []struct {
+		name   string
+		phone  string
+		code   string
+		err    error
+		status MobStatus
+	}{
+		{"Right code", "13800138000", "1234", nil, MOB_STATUS_OK},
+		{"Wrong code", "13800138000", "9999", ErrWrongCode, MOB_STATUS_CODE_WRONG},
+		{"Rejected phone", "17012345678", "1234", ErrInvalidPhone, MOB_STATUS_NUMBER_INVALID},
+		{"Malformed phone", "0138", "1234", ErrInvalidPhone, 0},
+		{"Letters", "1380013800a", "1234", ErrInvalidPhone, 0},
+		{"Empty code", "13800138000", "", ErrWrongCode, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := mob.VerifyCode(ctx, "86", tc.phone, tc.code)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+			var mobErr *MobError
+			if errors.As(err, &mobErr) != (tc.status != MOB_STATUS_OK && tc.status != 0) {
+				t.Errorf("got %v, want a MobError only for a Mob status", err)
+			}
+			if mobErr != nil && mobErr.Status != tc.status {
+				t.Errorf("Status = %d, want %d", mobErr.Status, tc.status)
+			}
+		})
+	}
+
+	mob.AppKey = "wrong"
+	var mobErr *MobError
+	if err := mob.SendCode(ctx, "86", "13800138000"); !errors.As(err, &mobErr) || mobErr.Status != MOB_STATUS_APPKEY_INVALID || mobErr.Message != "appkey invalid" {
+		t.Errorf("got %v, want an invalid appkey", err)
+	}
+}
@@ -0,0 +1,101 @@
+package sms
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	DEFAULT_CODE_LENGTH = 6
+)
+
+var ErrUnsupported = errors.New("sms: not supported by provider")
+
+// Notification is a templated message. Template is the app's name for it;
+// each provider maps it to its own template.
+type Notification struct {
+	Zone     string
+	Phone    string
+	Template string
+	Params   map[string]string
+}
+
+// Receipt identifies an accepted message at the provider.
+type Receipt struct {
+	Provider string
+	ID       string
+}
+
+// Provider is an SMS vendor that can send verification codes and
+// templated notifications. Vendors without templates return
+// ErrUnsupported from Notify.
+type Provider interface {
+	CodeService
+	Name() string
+	Notify(ctx context.Context, n *Notification) (*Receipt, error)
+}
+
+// CodeStore keeps the codes of providers that only deliver messages, so
+// the code can be checked later.
+type CodeStore interface {
+	Save(ctx context.Context, zone, phone, code string) error
+	// Check consumes the code if it matches, and fails with ErrWrongCode
+	// otherwise.
+	Check(ctx context.Context, zone, phone, code string) error
+}
+
+// RedisCodes is a CodeStore in Redis. Codes expire after TTL, which
+// defaults to DEFAULT_CODE_TTL.
+type RedisCodes struct {
+	Redis  redis.Cmdable
+	Prefix string
+	TTL    time.Duration
+}
+
+func (c *RedisCodes) key(zone, phone string) string {
+	return cmp.Or(c.Prefix, DEFAULT_KEY_PREFIX) + "code:" + zone + ":" + phone
+}
+
+func (c *RedisCodes) Save(ctx context.Context, zone, phone, code string) error {
+	ttl := c.TTL
+	if ttl == 0 {
+		ttl = DEFAULT_CODE_TTL
+	}
+	return c.Redis.Set(ctx, c.key(zone, phone), code, ttl).Err()
+}
+
+func (c *RedisCodes) Check(ctx context.Context, zone, phone, code string) error {
+	key := c.key(zone, phone)
+	stored, err := c.Redis.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("%w: no code sent or it expired", ErrWrongCode)
+	}
+	if err != nil {
+		return err
+	}
+	if code == "" || subtle.ConstantTimeCompare([]byte(stored), []byte(code)) != 1 {
+		return ErrWrongCode
+	}
+	return c.Redis.Del(ctx, key).Err()
+}
+
+// GenerateCode returns a random numeric code of DEFAULT_CODE_LENGTH digits.
+func GenerateCode() (string, error) {
+	limit := big.NewInt(1)
+	for range DEFAULT_CODE_LENGTH {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", DEFAULT_CODE_LENGTH, n), nil
+}
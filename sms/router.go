@@ -0,0 +1,249 @@
+package sms
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	DEFAULT_ROUTE_TIMEOUT = 5 * time.Second
+	DEFAULT_ROUTE_BACKOFF = 30 * time.Second
+)
+
+var ErrNoProvider = errors.New("sms: no provider available")
+
+// Route is a provider and its share of the traffic.
+type Route struct {
+	Provider Provider
+	Weight   int
+}
+
+// Router spreads sends across Routes by weight and fails over to the
+// other routes when a provider errors or takes longer than Timeout. A
+// provider that failed is skipped for Backoff while any other can be
+// tried. Errors that are the user's, such as ErrInvalidPhone, are returned
+// without failing over.
+//
+// A code must be verified by the provider that sent it, so the Router
+// remembers the sender of each phone's code for CodeTTL, in Redis when
+// set and in memory otherwise.
+type Router struct {
+	Routes  []Route
+	Timeout time.Duration
+	Backoff time.Duration
+	Redis   redis.Cmdable
+	Prefix  string
+	CodeTTL time.Duration
+	Now     func() time.Time
+	// Intn picks the route; it defaults to math/rand.
+	Intn func(n int) int
+
+	mu      sync.Mutex
+	down    map[string]time.Time
+	senders map[string]sender
+}
+
+type sender struct {
+	provider string
+	expires  time.Time
+}
+
+func (r *Router) Name() string {
+	return "router"
+}
+
+func (r *Router) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// order returns the routes in the order to try them: a weighted shuffle of
+// the healthy routes, then the ones backing off.
+func (r *Router) order() []Route {
+	intn := r.Intn
+	if intn == nil {
+		intn = rand.IntN
+	}
+
+	r.mu.Lock()
+	var healthy, down []Route
+	for _, route := range r.Routes {
+		if route.Weight <= 0 {
+			continue
+		}
+		if until, ok := r.down[route.Provider.Name()]; ok && r.now().Before(until) {
+			down = append(down, route)
+		} else {
+			healthy = append(healthy, route)
+		}
+	}
+	r.mu.Unlock()
+
+	var ordered []Route
+	for len(healthy) > 0 {
+		total := 0
+		for _, route := range healthy {
+			total += route.Weight
+		}
+		pick := intn(total)
+		for i, route := range healthy {
+			if pick < route.Weight {
+				ordered = append(ordered, route)
+				healthy = append(healthy[:i:i], healthy[i+1:]...)
+				break
+			}
+			pick -= route.Weight
+		}
+	}
+	return append(ordered, down...)
+}
+
+// final reports whether err should reach the caller without failing over.
+func final(err error) bool {
+	return errors.Is(err, ErrInvalidPhone) || errors.Is(err, ErrWrongCode) || errors.Is(err, ErrTooManyAttempts)
+}
+
+// blameless reports whether err says nothing about the provider's health.
+func blameless(err error) bool {
+	return errors.Is(err, ErrUnsupported) || errors.Is(err, ErrThrottled)
+}
+
+// try calls fn on each route in order until one succeeds.
+func (r *Router) try(ctx context.Context, fn func(ctx context.Context, p Provider) error) (Provider, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DEFAULT_ROUTE_TIMEOUT
+	}
+	backoff := r.Backoff
+	if backoff == 0 {
+		backoff = DEFAULT_ROUTE_BACKOFF
+	}
+
+	var errs []error
+	for _, route := range r.order() {
+		attempt, cancel := context.WithTimeout(ctx, timeout)
+		err := fn(attempt, route.Provider)
+		cancel()
+		if err == nil {
+			return route.Provider, nil
+		}
+		if final(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", route.Provider.Name(), err))
+		if !blameless(err) {
+			r.mu.Lock()
+			if r.down == nil {
+				r.down = map[string]time.Time{}
+			}
+			r.down[route.Provider.Name()] = r.now().Add(backoff)
+			r.mu.Unlock()
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrNoProvider
+	}
+	return nil, fmt.Errorf("%w: %w", ErrNoProvider, errors.Join(errs...))
+}
+
+func (r *Router) SendCode(ctx context.Context, zone, phone string) error {
+	if err := checkNumber(zone, phone); err != nil {
+		return err
+	}
+	p, err := r.try(ctx, func(ctx context.Context, p Provider) error {
+		return p.SendCode(ctx, zone, phone)
+	})
+	if err != nil {
+		return err
+	}
+	return r.remember(ctx, zone, phone, p.Name())
+}
+
+// VerifyCode asks the provider that sent the phone's code. There is no
+// failover: another provider cannot know the code.
+func (r *Router) VerifyCode(ctx context.Context, zone, phone, code string) error {
+	if err := checkNumber(zone, phone); err != nil {
+		return err
+	}
+	name, err := r.sender(ctx, zone, phone)
+	if err != nil {
+		return err
+	}
+	for _, route := range r.Routes {
+		if route.Provider.Name() == name {
+			return route.Provider.VerifyCode(ctx, zone, phone, code)
+		}
+	}
+	return fmt.Errorf("%w: no code sent or it expired", ErrWrongCode)
+}
+
+func (r *Router) Notify(ctx context.Context, n *Notification) (*Receipt, error) {
+	if err := checkNumber(n.Zone, n.Phone); err != nil {
+		return nil, err
+	}
+	var receipt *Receipt
+	_, err := r.try(ctx, func(ctx context.Context, p Provider) error {
+		var err error
+		receipt, err = p.Notify(ctx, n)
+		return err
+	})
+	return receipt, err
+}
+
+func (r *Router) senderKey(zone, phone string) string {
+	return cmp.Or(r.Prefix, DEFAULT_KEY_PREFIX) + "sender:" + zone + ":" + phone
+}
+
+func (r *Router) remember(ctx context.Context, zone, phone, name string) error {
+	ttl := r.CodeTTL
+	if ttl == 0 {
+		ttl = DEFAULT_CODE_TTL
+	}
+	if r.Redis != nil {
+		return r.Redis.Set(ctx, r.senderKey(zone, phone), name, ttl).Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.senders == nil {
+		r.senders = map[string]sender{}
+	}
+	now := r.now()
+	for key, s := range r.senders {
+		if !now.Before(s.expires) {
+			delete(r.senders, key)
+		}
+	}
+	r.senders[r.senderKey(zone, phone)] = sender{provider: name, expires: now.Add(ttl)}
+	return nil
+}
+
+// sender returns the provider that sent the phone's code, or "" if none
+// did within CodeTTL.
+func (r *Router) sender(ctx context.Context, zone, phone string) (string, error) {
+	if r.Redis != nil {
+		name, err := r.Redis.Get(ctx, r.senderKey(zone, phone)).Result()
+		if errors.Is(err, redis.Nil) {
+			return "", nil
+		}
+		return name, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.senders[r.senderKey(zone, phone)]
+	if !ok || !r.now().Before(s.expires) {
+		return "", nil
+	}
+	return s.provider, nil
+}
@@ -0,0 +1,138 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRouterWeights(t *testing.T) {
+	ctx := context.Background()
+	primary := &Fake{ProviderName: "primary"}
+	secondary := &Fake{ProviderName: "secondary"}
+	// Intn always picks the lowest slot, so the first route with weight wins.
+	router := &Router{
+		Routes: []Route{{primary, 0}, {secondary, 3}, {&Fake{ProviderName: "spare"}, 1}},
+		Intn:   func(n int) int { return 0 },
+	}
+
+	for range 3 {
+		if _, err := router.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"}); err != nil {
+			t.Fatalf("Failed to notify: %v", err)
+		}
+	}
+	if primary.Sent() != 0 || secondary.Sent() != 3 {
+		t.Errorf("got %d and %d sent, want 0 and 3", primary.Sent(), secondary.Sent())
+	}
+
+	// The last slot belongs to the last route.
+	router.Intn = func(n int) int { return n - 1 }
+	receipt, err := router.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"})
+	if err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if receipt.Provider != "spare" {
+		t.Errorf("got %s, want spare", receipt.Provider)
+	}
+}
+
+func TestRouterFailover(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	primary := &Fake{ProviderName: "primary", Err: errors.New("primary unavailable")}
+	secondary := &Fake{ProviderName: "secondary"}
+	router := &Router{
+		Routes:  []Route{{primary, 10}, {secondary, 1}},
+		Timeout: 50 * time.Millisecond,
+		Backoff: time.Minute,
+		Now:     func() time.Time { return now },
+		Intn:    func(n int) int { return 0 },
+	}
+
+	receipt, err := router.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"})
+	if err != nil {
+		t.Fatalf("Failed to fail over: %v", err)
+	}
+	if receipt.Provider != "secondary" {
+		t.Errorf("got %s, want secondary", receipt.Provider)
+	}
+
+	// The failed primary is tried last while it backs off.
+	primary.Err = nil
+	if receipt, _ := router.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"}); receipt.Provider != "secondary" {
+		t.Errorf("got %s, want secondary during the backoff", receipt.Provider)
+	}
+	now = now.Add(time.Minute)
+	if receipt, _ := router.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"}); receipt.Provider != "primary" {
+		t.Errorf("got %s, want primary after the backoff", receipt.Provider)
+	}
+
+	// A slow provider times out and the next one answers.
+	primary.Delay = time.Second
+	start := time.Now()
+	if receipt, err := router.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"}); err != nil || receipt.Provider != "secondary" {
+		t.Errorf("got %v, %v, want secondary after a timeout", receipt, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Failover took %s, want about the timeout", elapsed)
+	}
+	primary.Delay = 0
+
+	// User errors do not fail over.
+	if _, err := router.Notify(ctx, &Notification{Zone: "86", Phone: "138-0013", Template: "shipped"}); !errors.Is(err, ErrInvalidPhone) {
+		t.Errorf("got %v, want ErrInvalidPhone", err)
+	}
+
+	secondary.Err = errors.New("secondary unavailable")
+	primary.Err = errors.New("primary unavailable")
+	if _, err := router.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"}); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("got %v, want ErrNoProvider", err)
+	}
+}
+
+func TestRouterCodes(t *testing.T) {
+	ctx := context.Background()
+	_, db := newRedis(t)
+
+	mob, _ := newFakeMob(t)
+	fake := &Fake{}
+	// Mob cannot send notifications, so they go to the fake even though
+	// Mob comes first, without counting against Mob.
+	router := &Router{
+		Routes: []Route{{mob, 1}, {fake, 1}},
+		Redis:  db,
+		Intn:   func(n int) int { return 0 },
+	}
+
+	if _, err := router.Notify(ctx, &Notification{Zone: "86", Phone: "13800138000", Template: "shipped"}); err != nil {
+		t.Fatalf("Failed to notify: %v", err)
+	}
+	if len(fake.Notifications()) != 1 {
+		t.Errorf("got %d notifications, want 1", len(fake.Notifications()))
+	}
+
+	if err := router.SendCode(ctx, "86", "13800138000"); err != nil {
+		t.Fatalf("Failed to send a code: %v", err)
+	}
+	if err := router.VerifyCode(ctx, "86", "13800138000", "1234"); err != nil {
+		t.Errorf("Failed to verify the code with mob: %v", err)
+	}
+
+	// Codes sent by the fake are verified by the fake.
+	router.Intn = func(n int) int { return n - 1 }
+	if err := router.SendCode(ctx, "86", "13900139000"); err != nil {
+		t.Fatalf("Failed to send a code: %v", err)
+	}
+	code, _ := fake.Code("86", "13900139000")
+	if err := router.VerifyCode(ctx, "86", "13900139000", "1234"); !errors.Is(err, ErrWrongCode) {
+		t.Errorf("got %v, want ErrWrongCode", err)
+	}
+	if err := router.VerifyCode(ctx, "86", "13900139000", code); err != nil {
+		t.Errorf("Failed to verify the code with the fake: %v", err)
+	}
+
+	if err := router.VerifyCode(ctx, "86", "13700137000", "1234"); !errors.Is(err, ErrWrongCode) {
+		t.Errorf("got %v, want ErrWrongCode for a phone with no code", err)
+	}
+}
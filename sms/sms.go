@@ -0,0 +1,69 @@
+// Package sms sends verification codes and notifications by text message.
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tests/phone"
+)
+
+var (
+	ErrInvalidPhone    = errors.New("sms: invalid phone number")
+	ErrWrongCode       = errors.New("sms: wrong verification code")
+	ErrCooldown        = errors.New("sms: code requested too recently")
+	ErrThrottled       = errors.New("sms: too many codes requested")
+	ErrTooManyAttempts = errors.New("sms: too many verification attempts")
+)
+
+// CooldownError reports how long to wait before requesting another code.
+type CooldownError struct {
+	Remaining time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%v: retry in %s", ErrCooldown, e.Remaining.Round(time.Second))
+}
+
+func (e *CooldownError) Unwrap() error {
+	return ErrCooldown
+}
+
+// CodeService sends verification codes and checks them, as Mob does on its
+// side.
+type CodeService interface {
+	SendCode(ctx context.Context, zone, phone string) error
+	VerifyCode(ctx context.Context, zone, phone, code string) error
+}
+
+type clientIPKey struct{}
+
+// WithClientIP attaches the IP address of the user requesting a code, so
+// the Verifier can throttle per IP.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the IP address attached by WithClientIP.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// checkNumber rejects numbers that are not mobiles of a region we send
+// to, before any provider charges for them. Numbers must already be
+// normalized; phone.Parse normalizes user input.
+func checkNumber(zone, national string) error {
+	_, err := number(zone, national)
+	return err
+}
+
+func number(zone, national string) (phone.Number, error) {
+	n, err := phone.New(zone, national)
+	if err != nil {
+		return phone.Number{}, fmt.Errorf("%w: %w", ErrInvalidPhone, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,190 @@
+package sms
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	DEFAULT_KEY_PREFIX   = "sms:"
+	DEFAULT_COOLDOWN     = time.Minute
+	DEFAULT_CODE_TTL     = 10 * time.Minute
+	DEFAULT_MAX_ATTEMPTS = 5
+)
+
+var (
+	DEFAULT_PHONE_LIMIT = Limit{Count: 10, Per: 24 * time.Hour}
+	DEFAULT_IP_LIMIT    = Limit{Count: 20, Per: time.Hour}
+)
+
+// refundScript decrements a counter only while it exists. A plain DECR on a
+// counter whose window just expired would recreate it at -1 without a TTL.
+var refundScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0`)
+
+// Limit allows Count codes per fixed window of Per.
+type Limit struct {
+	Count int
+	Per   time.Duration
+}
+
+// Verifier sends and checks login codes through Service, keeping its
+// throttling state in Redis so every instance of the app shares it:
+//
+//   - a phone may request a code once per Cooldown;
+//   - a phone may request PhoneLimit codes, and an IP (see WithClientIP)
+//     IPLimit codes;
+//   - a phone may try MaxAttempts codes per CodeTTL.
+//
+// Zero fields take the DEFAULT_ values.
+type Verifier struct {
+	Service     CodeService
+	Redis       redis.Cmdable
+	Prefix      string
+	Cooldown    time.Duration
+	PhoneLimit  Limit
+	IPLimit     Limit
+	CodeTTL     time.Duration
+	MaxAttempts int
+}
+
+func (v *Verifier) key(parts ...string) string {
+	return cmp.Or(v.Prefix, DEFAULT_KEY_PREFIX) + strings.Join(parts, ":")
+}
+
+// SendCode sends a new code to the phone unless it is cooling down or over
+// a limit. A send the service rejects is not charged against the limits.
+func (v *Verifier) SendCode(ctx context.Context, zone, phone string) error {
+	if err := checkNumber(zone, phone); err != nil {
+		return err
+	}
+
+	cooldownKey := v.key("cooldown", zone, phone)
+	cooldown := v.Cooldown
+	if cooldown == 0 {
+		cooldown = DEFAULT_COOLDOWN
+	}
+	ok, err := v.Redis.SetNX(ctx, cooldownKey, 1, cooldown).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		remaining, err := v.Redis.PTTL(ctx, cooldownKey).Result()
+		if err != nil {
+			return err
+		}
+		return &CooldownError{Remaining: max(remaining, 0)}
+	}
+
+	type counter struct {
+		key   string
+		limit Limit
+	}
+	counters := []counter{{v.key("phone", zone, phone), orLimit(v.PhoneLimit, DEFAULT_PHONE_LIMIT)}}
+	if ip := ClientIP(ctx); ip != "" {
+		counters = append(counters, counter{v.key("ip", ip), orLimit(v.IPLimit, DEFAULT_IP_LIMIT)})
+	}
+
+	var charged []string
+	refund := func() {
+		for _, key := range charged {
+			v.refund(ctx, key)
+		}
+		v.Redis.Del(ctx, cooldownKey)
+	}
+
+	for _, c := range counters {
+		n, err := v.incr(ctx, c.key, c.limit.Per)
+		if err != nil {
+			refund()
+			return err
+		}
+		charged = append(charged, c.key)
+		if n > int64(c.limit.Count) {
+			refund()
+			return fmt.Errorf("%w: %d per %s", ErrThrottled, c.limit.Count, c.limit.Per)
+		}
+	}
+
+	if err := v.Service.SendCode(ctx, zone, phone); err != nil {
+		refund()
+		return err
+	}
+
+	// A new code gets a fresh set of attempts.
+	return v.Redis.Del(ctx, v.key("attempts", zone, phone)).Err()
+}
+
+// VerifyCode checks code, failing with ErrTooManyAttempts once the phone
+// used up its attempts and ErrWrongCode when the code does not match.
+func (v *Verifier) VerifyCode(ctx context.Context, zone, phone, code string) error {
+	if err := checkNumber(zone, phone); err != nil {
+		return err
+	}
+
+	ttl := v.CodeTTL
+	if ttl == 0 {
+		ttl = DEFAULT_CODE_TTL
+	}
+	maxAttempts := v.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+
+	attemptsKey := v.key("attempts", zone, phone)
+	n, err := v.incr(ctx, attemptsKey, ttl)
+	if err != nil {
+		return err
+	}
+	if n > int64(maxAttempts) {
+		return fmt.Errorf("%w: %d per code", ErrTooManyAttempts, maxAttempts)
+	}
+
+	if err := v.Service.VerifyCode(ctx, zone, phone, code); err != nil {
+		if !errors.Is(err, ErrWrongCode) && !errors.Is(err, ErrTooManyAttempts) {
+			// Only the user's mistakes use up attempts.
+			v.refund(ctx, attemptsKey)
+		}
+		return err
+	}
+	return v.Redis.Del(ctx, attemptsKey).Err()
+}
+
+// incr counts at key in a fixed window of per that starts with the first
+// count. The window is created with its expiry in the same transaction as
+// the count, so a failure in between cannot leave a counter that never
+// expires.
+func (v *Verifier) incr(ctx context.Context, key string, per time.Duration) (int64, error) {
+	var n *redis.IntCmd
+	_, err := v.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetNX(ctx, key, 0, per)
+		n = pipe.Incr(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n.Val(), nil
+}
+
+// refund takes back a count made by incr, unless its window has expired
+// since.
+func (v *Verifier) refund(ctx context.Context, key string) {
+	refundScript.Run(ctx, v.Redis, []string{key})
+}
+
+func orLimit(limit, fallback Limit) Limit {
+	if limit.Count == 0 {
+		return fallback
+	}
+	return limit
+}
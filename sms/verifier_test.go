@@ -0,0 +1,137 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newRedis starts an in-memory Redis that stops with the test.
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	db := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { db.Close() })
+	return server, db
+}
+
+// flakyService wraps a CodeService and fails sends while err is set. Slow,
+// if set, runs before every send.
+type flakyService struct {
+	CodeService
+	sends int
+	err   error
+	slow  func()
+}
+
+func (f *flakyService) SendCode(ctx context.Context, zone, phone string) error {
+	if f.slow != nil {
+		f.slow()
+	}
+	if f.err != nil {
+		return f.err
+	}
+	f.sends++
+	return f.CodeService.SendCode(ctx, zone, phone)
+}
+
+func TestVerifier(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	server, db := newRedis(t)
+
+	mob, _ := newFakeMob(t)
+	service := &flakyService{CodeService: mob}
+	v := &Verifier{
+		Service:     service,
+		Redis:       db,
+		Cooldown:    time.Minute,
+		PhoneLimit:  Limit{Count: 2, Per: 24 * time.Hour},
+		IPLimit:     Limit{Count: 3, Per: time.Hour},
+		MaxAttempts: 2,
+	}
+
+	if err := v.SendCode(ctx, "86", "13800138000"); err != nil {
+		t.Fatalf("Failed to send a code: %v", err)
+	}
+	if ttl := db.PTTL(ctx, DEFAULT_KEY_PREFIX+"ip:203.0.113.7").Val(); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("IP counter expires in %s, want within an hour", ttl)
+	}
+
+	var cooldown *CooldownError
+	if err := v.SendCode(ctx, "86", "13800138000"); !errors.As(err, &cooldown) || !errors.Is(err, ErrCooldown) {
+		t.Fatalf("got %v, want a cooldown", err)
+	}
+	if cooldown.Remaining <= 0 || cooldown.Remaining > time.Minute {
+		t.Errorf("Remaining = %s, want within a minute", cooldown.Remaining)
+	}
+
+	// A failed send is not charged and does not start a cooldown.
+	service.err = errors.New("mob unavailable")
+	server.FastForward(time.Minute)
+	if err := v.SendCode(ctx, "86", "13800138000"); err == nil {
+		t.Fatalf("Expected the service's error")
+	}
+	service.err = nil
+	if err := v.SendCode(ctx, "86", "13800138000"); err != nil {
+		t.Fatalf("Failed to send after a failed send: %v", err)
+	}
+
+	server.FastForward(time.Minute)
+	if err := v.SendCode(ctx, "86", "13800138000"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("got %v, want the phone limit", err)
+	}
+
+	// The third code from this IP is allowed, the fourth is not.
+	if err := v.SendCode(ctx, "86", "13900139000"); err != nil {
+		t.Errorf("Failed to send to another phone: %v", err)
+	}
+	if err := v.SendCode(ctx, "86", "13700137000"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("got %v, want the IP limit", err)
+	}
+	if err := v.SendCode(context.Background(), "86", "13700137000"); err != nil {
+		t.Errorf("Failed to send without an IP: %v", err)
+	}
+	if service.sends != 4 {
+		t.Errorf("sent %d codes, want 4", service.sends)
+	}
+
+	// Attempts run out after MaxAttempts wrong codes, even for the right one.
+	if err := v.VerifyCode(ctx, "86", "13800138000", "1111"); !errors.Is(err, ErrWrongCode) {
+		t.Errorf("got %v, want ErrWrongCode", err)
+	}
+	if err := v.VerifyCode(ctx, "86", "13800138000", "1234"); err != nil {
+		t.Errorf("Failed to verify: %v", err)
+	}
+	for range 2 {
+		v.VerifyCode(ctx, "86", "13900139000", "1111")
+	}
+	if err := v.VerifyCode(ctx, "86", "13900139000", "1234"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("got %v, want ErrTooManyAttempts", err)
+	}
+
+	if err := v.SendCode(ctx, "86", ""); !errors.Is(err, ErrInvalidPhone) {
+		t.Errorf("got %v, want ErrInvalidPhone", err)
+	}
+}
+
+func TestVerifierRefundAfterExpiry(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	server, db := newRedis(t)
+
+	mob, _ := newFakeMob(t)
+	// The send fails only after every window has expired.
+	service := &flakyService{CodeService: mob, err: errors.New("mob unavailable"), slow: func() { server.FastForward(48 * time.Hour) }}
+	v := &Verifier{Service: service, Redis: db}
+
+	if err := v.SendCode(ctx, "86", "13800138000"); err == nil {
+		t.Fatalf("Expected the service's error")
+	}
+	for _, key := range server.Keys() {
+		t.Errorf("Refund left %s behind with TTL %s", key, server.TTL(key))
+	}
+}
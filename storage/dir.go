@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DirBucket is a Bucket backed by a local directory, with each key stored
+// as a file under Root. It does not record content types; Stat guesses
+// them from the key's extension.
+type DirBucket struct {
+	Root string
+}
+
+func (b *DirBucket) path(key string) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(b.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes through a temporary file so readers never see a partial
+// object.
+func (b *DirBucket) Put(ctx context.Context, key string, r io.Reader, opts *PutOptions) error {
+	name, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(name), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, readerWithContext(ctx, r)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func (b *DirBucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, dirError(err)
+	}
+	return f, nil
+}
+
+func (b *DirBucket) Delete(ctx context.Context, key string) error {
+	name, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (b *DirBucket) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(b.Root, func(name string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == b.Root {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(b.Root, name)
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			// Skip directories that cannot hold a matching key.
+			if name != b.Root && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.HasPrefix(key, prefix) || strings.HasPrefix(d.Name(), ".put-") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, fileInfo(key, info))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(objects, func(a, b ObjectInfo) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+func (b *DirBucket) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	name, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, dirError(err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, dirError(fs.ErrNotExist)
+	}
+
+	object := fileInfo(key, info)
+	return &object, nil
+}
+
+// SignURL returns a file:// URL; local files carry no expiry.
+func (b *DirBucket) SignURL(ctx context.Context, key, method string, expires time.Duration) (string, error) {
+	if err := checkMethod(method); err != nil {
+		return "", err
+	}
+	name, err := b.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+func fileInfo(key string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  contentType(key, nil),
+		LastModified: info.ModTime(),
+	}
+}
+
+func dirError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrNotExist, err)
+	}
+	return err
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// readerWithContext stops a copy from r once ctx is done.
+func readerWithContext(ctx context.Context, r io.Reader) io.Reader {
+	return contextReader{ctx: ctx, r: r}
+}
@@ -0,0 +1,428 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+const (
+	DEFAULT_PART_SIZE          = 8 << 20
+	MIN_PART_SIZE              = 100 << 10
+	MAX_PARTS                  = 10000
+	DEFAULT_UPLOAD_CONCURRENCY = 3
+)
+
+var (
+	ErrPartSize = errors.New("storage: part size too small")
+	ErrChecksum = errors.New("storage: checksum mismatch")
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// MultipartOptions tunes UploadFile. A nil *MultipartOptions uses the
+// defaults without resuming.
+type MultipartOptions struct {
+	// PartSize defaults to DEFAULT_PART_SIZE and grows as needed to stay
+	// within MAX_PARTS.
+	PartSize    int64
+	Concurrency int
+	// Checkpoint is a file recording the finished parts, so an upload
+	// interrupted by a crash resumes instead of starting over. It is
+	// removed once the upload completes. Empty disables resuming, and
+	// failed uploads are aborted instead.
+	Checkpoint  string
+	ContentType string
+	Progress    func(MultipartProgress)
+}
+
+type MultipartProgress struct {
+	Parts      int
+	TotalParts int
+	Bytes      int64
+	TotalBytes int64
+}
+
+// FileUploader is implemented by buckets that upload large files in
+// parts. PutFile uses it for files larger than DEFAULT_PART_SIZE.
+type FileUploader interface {
+	UploadFile(ctx context.Context, key, name string, opts *MultipartOptions) error
+}
+
+// UploadFile uploads the file at name to key in parts, checking each part's
+// MD5 and the whole object's CRC64 against what OSS reports.
+func (b *OSSBucket) UploadFile(ctx context.Context, key, name string, opts *MultipartOptions) error {
+	return uploadMultipart(ctx, ossMultipart{b.Bucket}, key, name, opts)
+}
+
+type uploadedPart struct {
+	Number int    `json:"number"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag"`
+	CRC64  uint64 `json:"crc64"`
+}
+
+// checkpoint is the resumable state of one upload. It is only reused for
+// the same key, file, file version and part size.
+type checkpoint struct {
+	Key      string         `json:"key"`
+	File     string         `json:"file"`
+	Size     int64          `json:"size"`
+	ModTime  time.Time      `json:"modTime"`
+	PartSize int64          `json:"partSize"`
+	UploadID string         `json:"uploadId"`
+	Parts    []uploadedPart `json:"parts"`
+}
+
+func (cp *checkpoint) matches(other *checkpoint) bool {
+	return cp.Key == other.Key && cp.File == other.File && cp.Size == other.Size &&
+		cp.ModTime.Equal(other.ModTime) && cp.PartSize == other.PartSize && cp.UploadID != ""
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// save writes through a temporary file, so a crash mid-write leaves the
+// previous checkpoint intact.
+func (cp *checkpoint) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// multipartAPI is the slice of a multipart-capable store UploadFile needs.
+// CRC64 values are returned as reported, empty when the store sends none.
+type multipartAPI interface {
+	initiate(ctx context.Context, key, contentType string) (uploadID string, err error)
+	uploadPart(ctx context.Context, key, uploadID string, number int, data []byte, contentMD5 string) (etag, crc string, err error)
+	listParts(ctx context.Context, key, uploadID string) (map[int]string, error)
+	complete(ctx context.Context, key, uploadID string, parts []uploadedPart) (crc string, err error)
+	abort(ctx context.Context, key, uploadID string) error
+}
+
+func partSize(size int64, opts *MultipartOptions) (int64, error) {
+	n := int64(DEFAULT_PART_SIZE)
+	if opts != nil && opts.PartSize > 0 {
+		n = opts.PartSize
+	}
+	if n < MIN_PART_SIZE {
+		return 0, fmt.Errorf("%w: %d < %d", ErrPartSize, n, MIN_PART_SIZE)
+	}
+	return max(n, (size+MAX_PARTS-1)/MAX_PARTS), nil
+}
+
+func uploadMultipart(ctx context.Context, api multipartAPI, key, name string, opts *MultipartOptions) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	if opts == nil {
+		opts = &MultipartOptions{}
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size, err := partSize(stat.Size(), opts)
+	if err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(name)
+
+	cp := &checkpoint{Key: key, File: abs, Size: stat.Size(), ModTime: stat.ModTime(), PartSize: size}
+	if err := resume(ctx, api, cp, opts.Checkpoint); err != nil {
+		return err
+	}
+	if cp.UploadID == "" {
+		cp.UploadID, err = api.initiate(ctx, key, contentType(key, &PutOptions{ContentType: opts.ContentType}))
+		if err != nil {
+			return err
+		}
+		if err := cp.save(opts.Checkpoint); err != nil {
+			return err
+		}
+	}
+
+	err = uploadParts(ctx, api, f, cp, opts)
+	if err == nil {
+		err = completeMultipart(ctx, api, cp)
+		if opts.Checkpoint != "" && (err == nil || errors.Is(err, ErrChecksum)) {
+			// The upload ID is spent either way.
+			os.Remove(opts.Checkpoint)
+		}
+		return err
+	}
+
+	if opts.Checkpoint == "" {
+		api.abort(context.WithoutCancel(ctx), key, cp.UploadID)
+	}
+	return err
+}
+
+// resume fills cp from the checkpoint file when it describes the same
+// upload, keeping only the parts the store still has. A stale upload is
+// aborted.
+func resume(ctx context.Context, api multipartAPI, cp *checkpoint, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	saved, err := loadCheckpoint(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil || !saved.matches(cp) {
+		if err == nil && saved.UploadID != "" {
+			api.abort(ctx, saved.Key, saved.UploadID)
+		}
+		return os.Remove(path)
+	}
+
+	etags, err := api.listParts(ctx, saved.Key, saved.UploadID)
+	if errors.Is(err, ErrNotExist) {
+		return os.Remove(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	cp.UploadID = saved.UploadID
+	for _, part := range saved.Parts {
+		if etag, ok := etags[part.Number]; ok && strings.EqualFold(etag, part.ETag) {
+			cp.Parts = append(cp.Parts, part)
+		}
+	}
+	return nil
+}
+
+func uploadParts(ctx context.Context, api multipartAPI, f io.ReaderAt, cp *checkpoint, opts *MultipartOptions) error {
+	total := int((cp.Size + cp.PartSize - 1) / cp.PartSize)
+	total = max(total, 1)
+
+	done := make(map[int]bool)
+	progress := MultipartProgress{TotalParts: total, TotalBytes: cp.Size}
+	for _, part := range cp.Parts {
+		done[part.Number] = true
+		progress.Parts++
+		progress.Bytes += part.Size
+	}
+	if opts.Progress != nil {
+		opts.Progress(progress)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	numbers := make(chan int)
+	go func() {
+		defer close(numbers)
+		for number := 1; number <= total; number++ {
+			if done[number] {
+				continue
+			}
+			select {
+			case numbers <- number:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	concurrency := DEFAULT_UPLOAD_CONCURRENCY
+	if opts.Concurrency > 0 {
+		concurrency = opts.Concurrency
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				part, err := uploadPart(ctx, api, f, cp, number)
+				if err != nil {
+					cancel(err)
+					return
+				}
+
+				mu.Lock()
+				cp.Parts = append(cp.Parts, part)
+				err = cp.save(opts.Checkpoint)
+				progress.Parts++
+				progress.Bytes += part.Size
+				if opts.Progress != nil {
+					opts.Progress(progress)
+				}
+				mu.Unlock()
+
+				if err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+func uploadPart(ctx context.Context, api multipartAPI, f io.ReaderAt, cp *checkpoint, number int) (uploadedPart, error) {
+	offset := int64(number-1) * cp.PartSize
+	data := make([]byte, min(cp.PartSize, cp.Size-offset))
+	if _, err := f.ReadAt(data, offset); err != nil && !errors.Is(err, io.EOF) {
+		return uploadedPart{}, err
+	}
+
+	sum := md5.Sum(data)
+	part := uploadedPart{Number: number, Size: int64(len(data)), CRC64: crc64.Checksum(data, crcTable)}
+
+	etag, crc, err := api.uploadPart(ctx, cp.Key, cp.UploadID, number, data, base64.StdEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return part, fmt.Errorf("storage: upload part %d: %w", number, err)
+	}
+
+	part.ETag = strings.Trim(etag, `"`)
+	if !strings.EqualFold(part.ETag, hex.EncodeToString(sum[:])) {
+		return part, fmt.Errorf("%w: part %d MD5 %s, got ETag %s", ErrChecksum, number, hex.EncodeToString(sum[:]), part.ETag)
+	}
+	if err := checkCRC64(crc, part.CRC64); err != nil {
+		return part, fmt.Errorf("part %d: %w", number, err)
+	}
+	return part, nil
+}
+
+func completeMultipart(ctx context.Context, api multipartAPI, cp *checkpoint) error {
+	slices.SortFunc(cp.Parts, func(a, b uploadedPart) int { return a.Number - b.Number })
+
+	var want uint64
+	for _, part := range cp.Parts {
+		want = oss.CRC64Combine(want, part.CRC64, uint64(part.Size))
+	}
+
+	crc, err := api.complete(ctx, cp.Key, cp.UploadID, cp.Parts)
+	if err != nil {
+		return err
+	}
+	return checkCRC64(crc, want)
+}
+
+// checkCRC64 compares a reported CRC64, if any, with the local one.
+func checkCRC64(reported string, want uint64) error {
+	if reported == "" {
+		return nil
+	}
+	if got, err := strconv.ParseUint(reported, 10, 64); err != nil || got != want {
+		return fmt.Errorf("%w: CRC64 %d, got %s", ErrChecksum, want, reported)
+	}
+	return nil
+}
+
+// ossMultipart drives the OSS multipart API.
+type ossMultipart struct {
+	bucket *oss.Bucket
+}
+
+func (m ossMultipart) upload(key, uploadID string) oss.InitiateMultipartUploadResult {
+	return oss.InitiateMultipartUploadResult{Bucket: m.bucket.BucketName, Key: key, UploadID: uploadID}
+}
+
+func (m ossMultipart) initiate(ctx context.Context, key, contentType string) (string, error) {
+	result, err := m.bucket.InitiateMultipartUpload(key, oss.ContentType(contentType), oss.WithContext(ctx))
+	return result.UploadID, err
+}
+
+func (m ossMultipart) uploadPart(ctx context.Context, key, uploadID string, number int, data []byte, contentMD5 string) (string, string, error) {
+	var header http.Header
+	part, err := m.bucket.UploadPart(m.upload(key, uploadID), bytes.NewReader(data), int64(len(data)), number,
+		oss.ContentMD5(contentMD5), oss.GetResponseHeader(&header), oss.WithContext(ctx))
+	if err != nil {
+		return "", "", err
+	}
+	return part.ETag, header.Get(oss.HTTPHeaderOssCRC64), nil
+}
+
+func (m ossMultipart) listParts(ctx context.Context, key, uploadID string) (map[int]string, error) {
+	etags := make(map[int]string)
+	marker := 0
+	for {
+		result, err := m.bucket.ListUploadedParts(m.upload(key, uploadID), oss.PartNumberMarker(marker), oss.WithContext(ctx))
+		if err != nil {
+			// OSS answers NoSuchUpload with 404 once an upload is gone.
+			return nil, ossError(err)
+		}
+		for _, part := range result.UploadedParts {
+			etags[part.PartNumber] = strings.Trim(part.ETag, `"`)
+		}
+		if !result.IsTruncated {
+			return etags, nil
+		}
+		if marker, err = strconv.Atoi(result.NextPartNumberMarker); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (m ossMultipart) complete(ctx context.Context, key, uploadID string, parts []uploadedPart) (string, error) {
+	var ossParts []oss.UploadPart
+	for _, part := range parts {
+		ossParts = append(ossParts, oss.UploadPart{PartNumber: part.Number, ETag: part.ETag})
+	}
+
+	var header http.Header
+	_, err := m.bucket.CompleteMultipartUpload(m.upload(key, uploadID), ossParts, oss.GetResponseHeader(&header), oss.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	return header.Get(oss.HTTPHeaderOssCRC64), nil
+}
+
+func (m ossMultipart) abort(ctx context.Context, key, uploadID string) error {
+	return m.bucket.AbortMultipartUpload(m.upload(key, uploadID), oss.WithContext(ctx))
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeMultipart keeps multipart uploads in memory and can fail or corrupt
+// chosen parts.
+type fakeMultipart struct {
+	mu      sync.Mutex
+	uploads map[string]map[int][]byte
+	objects map[string][]byte
+	nextID  int
+	aborted []string
+
+	failPart    int
+	corruptETag int
+	corruptCRC  bool
+	uploaded    []int
+}
+
+func newFakeMultipart() *fakeMultipart {
+	return &fakeMultipart{uploads: make(map[string]map[int][]byte), objects: make(map[string][]byte)}
+}
+
+func (m *fakeMultipart) initiate(ctx context.Context, key, contentType string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	id := fmt.Sprintf("upload-%d", m.nextID)
+	m.uploads[id] = make(map[int][]byte)
+	return id, nil
+}
+
+func (m *fakeMultipart) uploadPart(ctx context.Context, key, uploadID string, number int, data []byte, contentMD5 string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if number == m.failPart {
+		return "", "", errors.New("connection reset")
+	}
+	parts, ok := m.uploads[uploadID]
+	if !ok {
+		return "", "", ErrNotExist
+	}
+	parts[number] = slices.Clone(data)
+	m.uploaded = append(m.uploaded, number)
+
+	sum := md5.Sum(data)
+	etag := hex.EncodeToString(sum[:])
+	if number == m.corruptETag {
+		etag = "00000000000000000000000000000000"
+	}
+	return `"` + etag + `"`, strconv.FormatUint(crc64.Checksum(data, crcTable), 10), nil
+}
+
+func (m *fakeMultipart) listParts(ctx context.Context, key, uploadID string) (map[int]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parts, ok := m.uploads[uploadID]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	etags := make(map[int]string)
+	for number, data := range parts {
+		sum := md5.Sum(data)
+		etags[number] = hex.EncodeToString(sum[:])
+	}
+	return etags, nil
+}
+
+func (m *fakeMultipart) complete(ctx context.Context, key, uploadID string, parts []uploadedPart) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var object []byte
+	for _, part := range parts {
+		object = append(object, m.uploads[uploadID][part.Number]...)
+	}
+	delete(m.uploads, uploadID)
+	m.objects[key] = object
+
+	crc := crc64.Checksum(object, crcTable)
+	if m.corruptCRC {
+		crc++
+	}
+	return strconv.FormatUint(crc, 10), nil
+}
+
+func (m *fakeMultipart) abort(ctx context.Context, key, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.uploads, uploadID)
+	m.aborted = append(m.aborted, uploadID)
+	return nil
+}
+
+func writeFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	name := filepath.Join(t.TempDir(), "archive.bin")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatalf("Failed to write the file: %v", err)
+	}
+	return name, data
+}
+
+func TestUploadMultipart(t *testing.T) {
+	ctx := context.Background()
+	name, data := writeFile(t, 5*MIN_PART_SIZE+123)
+
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprintf("Concurrency %d", concurrency), func(t *testing.T) {
+			api := newFakeMultipart()
+			var last MultipartProgress
+			err := uploadMultipart(ctx, api, "firmware/archive.bin", name, &MultipartOptions{
+				PartSize:    MIN_PART_SIZE,
+				Concurrency: concurrency,
+				Progress:    func(p MultipartProgress) { last = p },
+			})
+			if err != nil {
+				t.Fatalf("Failed to upload: %v", err)
+			}
+
+			if !bytes.Equal(api.objects["firmware/archive.bin"], data) {
+				t.Errorf("Uploaded object does not match")
+			}
+			if last.Parts != 6 || last.TotalParts != 6 || last.Bytes != int64(len(data)) || last.TotalBytes != int64(len(data)) {
+				t.Errorf("Unexpected final progress %+v", last)
+			}
+		})
+	}
+}
+
+func TestUploadMultipartResume(t *testing.T) {
+	ctx := context.Background()
+	name, data := writeFile(t, 5*MIN_PART_SIZE)
+	checkpoint := filepath.Join(t.TempDir(), "archive.ckp")
+
+	api := newFakeMultipart()
+	api.failPart = 4
+	opts := &MultipartOptions{PartSize: MIN_PART_SIZE, Concurrency: 1, Checkpoint: checkpoint}
+	if err := uploadMultipart(ctx, api, "archive.bin", name, opts); err == nil {
+		t.Fatalf("Expected the upload to fail at part 4")
+	}
+	if len(api.aborted) != 0 {
+		t.Fatalf("A resumable upload should not be aborted")
+	}
+
+	api.failPart = 0
+	api.uploaded = nil
+	if err := uploadMultipart(ctx, api, "archive.bin", name, opts); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if !slices.Equal(api.uploaded, []int{4, 5}) {
+		t.Errorf("Resumed upload sent parts %v, want [4 5]", api.uploaded)
+	}
+	if !bytes.Equal(api.objects["archive.bin"], data) {
+		t.Errorf("Resumed object does not match")
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("The checkpoint should be removed after completing")
+	}
+
+	// A checkpoint for a different part size starts a new upload and
+	// aborts the stale one.
+	api.failPart = 2
+	uploadMultipart(ctx, api, "archive.bin", name, opts)
+	api.failPart = 0
+	api.uploaded = nil
+	opts.PartSize = 2 * MIN_PART_SIZE
+	if err := uploadMultipart(ctx, api, "archive.bin", name, opts); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	if !slices.Equal(api.uploaded, []int{1, 2, 3}) || len(api.aborted) != 1 {
+		t.Errorf("Restart sent parts %v and aborted %v", api.uploaded, api.aborted)
+	}
+}
+
+func TestUploadMultipartErrors(t *testing.T) {
+	ctx := context.Background()
+	name, _ := writeFile(t, 3*MIN_PART_SIZE)
+
+	t.Run("Part size", func(t *testing.T) {
+		err := uploadMultipart(ctx, newFakeMultipart(), "a.bin", name, &MultipartOptions{PartSize: 1024})
+		if !errors.Is(err, ErrPartSize) {
+			t.Errorf("got %v, want ErrPartSize", err)
+		}
+	})
+
+	t.Run("Part MD5", func(t *testing.T) {
+		api := newFakeMultipart()
+		api.corruptETag = 2
+		err := uploadMultipart(ctx, api, "a.bin", name, &MultipartOptions{PartSize: MIN_PART_SIZE})
+		if !errors.Is(err, ErrChecksum) {
+			t.Errorf("got %v, want ErrChecksum", err)
+		}
+		if len(api.aborted) != 1 {
+			t.Errorf("A failed upload without a checkpoint should be aborted")
+		}
+	})
+
+	t.Run("Object CRC64", func(t *testing.T) {
+		api := newFakeMultipart()
+		api.corruptCRC = true
+		err := uploadMultipart(ctx, api, "a.bin", name, &MultipartOptions{PartSize: MIN_PART_SIZE})
+		if !errors.Is(err, ErrChecksum) {
+			t.Errorf("got %v, want ErrChecksum", err)
+		}
+	})
+}
+
+func TestPartSize(t *testing.T) {
+	testCases := []struct {
+		name string
+		size int64
+		opts *MultipartOptions
+		want int64
+	}{
+		{"Default", 1 << 30, nil, DEFAULT_PART_SIZE},
+		{"Explicit", 1 << 30, &MultipartOptions{PartSize: 1 << 20}, 1 << 20},
+		{"Grown to fit", 200 << 30, nil, (200<<30 + MAX_PARTS - 1) / MAX_PARTS},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := partSize(tc.size, tc.opts); err != nil || got != tc.want {
+				t.Errorf("partSize() = %d, %v, want %d", got, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// OSSBucket is a Bucket backed by Aliyun OSS.
+type OSSBucket struct {
+	Bucket *oss.Bucket
+}
+
+// OpenOSS connects to the named bucket with V4 signing in region. Pass the
+// credentials as options, e.g. oss.SetCredentialsProvider(creds.OSS()) with
+// a credentials.Cache.
+func OpenOSS(endpoint, region, name string, options ...oss.ClientOption) (*OSSBucket, error) {
+	options = append([]oss.ClientOption{oss.Region(region), oss.AuthVersion(oss.AuthV4)}, options...)
+
+	client, err := oss.New(endpoint, "", "", options...)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := client.Bucket(name)
+	if err != nil {
+		return nil, err
+	}
+	return &OSSBucket{Bucket: bucket}, nil
+}
+
+func (b *OSSBucket) Put(ctx context.Context, key string, r io.Reader, opts *PutOptions) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	return ossError(b.Bucket.PutObject(key, r, oss.ContentType(contentType(key, opts)), oss.WithContext(ctx)))
+}
+
+func (b *OSSBucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := b.Bucket.GetObject(key, oss.WithContext(ctx))
+	return r, ossError(err)
+}
+
+func (b *OSSBucket) Delete(ctx context.Context, key string) error {
+	return ossError(b.Bucket.DeleteObject(key, oss.WithContext(ctx)))
+}
+
+func (b *OSSBucket) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+	for {
+		result, err := b.Bucket.ListObjectsV2(oss.Prefix(prefix), oss.ContinuationToken(token), oss.WithContext(ctx))
+		if err != nil {
+			return nil, ossError(err)
+		}
+		for _, object := range result.Objects {
+			objects = append(objects, ObjectInfo{
+				Key:          object.Key,
+				Size:         object.Size,
+				ETag:         strings.Trim(object.ETag, `"`),
+				LastModified: object.LastModified,
+			})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	return objects, nil
+}
+
+func (b *OSSBucket) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	header, err := b.Bucket.GetObjectDetailedMeta(key, oss.WithContext(ctx))
+	if err != nil {
+		return nil, ossError(err)
+	}
+
+	size, _ := strconv.ParseInt(header.Get(oss.HTTPHeaderContentLength), 10, 64)
+	modified, _ := http.ParseTime(header.Get(oss.HTTPHeaderLastModified))
+	return &ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ContentType:  header.Get(oss.HTTPHeaderContentType),
+		ETag:         strings.Trim(header.Get(oss.HTTPHeaderEtag), `"`),
+		LastModified: modified,
+	}, nil
+}
+
+func (b *OSSBucket) SignURL(ctx context.Context, key, method string, expires time.Duration) (string, error) {
+	if err := checkMethod(method); err != nil {
+		return "", err
+	}
+	return b.Bucket.SignURL(key, oss.HTTPMethod(method), int64(expires/time.Second))
+}
+
+// ossError maps missing objects onto ErrNotExist.
+func ossError(err error) error {
+	var serviceErr oss.ServiceError
+	if errors.As(err, &serviceErr) && serviceErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", ErrNotExist, err)
+	}
+	return err
+}
@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+const (
+	SIGNING_ALGORITHM_V4 = "OSS4-HMAC-SHA256"
+	SIGNING_PRODUCT      = "oss"
+	UNSIGNED_PAYLOAD     = "UNSIGNED-PAYLOAD"
+	V4_TIME_LAYOUT       = "20060102T150405Z"
+	V4_DATE_LAYOUT       = "20060102"
+
+	// MAX_PRESIGN_EXPIRES is the longest validity OSS accepts for a V4
+	// signature.
+	MAX_PRESIGN_EXPIRES = 7 * 24 * time.Hour
+
+	DEFAULT_POST_SUCCESS_STATUS = http.StatusNoContent
+)
+
+var (
+	ErrExpires     = errors.New("storage: invalid signature expiry")
+	ErrCredentials = errors.New("storage: missing credentials")
+	ErrSizeRange   = errors.New("storage: invalid size range")
+)
+
+// Presigner issues V4-signed OSS URLs and PostObject forms, so clients can
+// transfer objects without going through our servers.
+type Presigner struct {
+	// Endpoint is the region endpoint, e.g.
+	// https://oss-cn-hongkong.aliyuncs.com.
+	Endpoint    string
+	Region      string
+	Bucket      string
+	Credentials oss.CredentialsProvider
+	// Now stamps signatures; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// Presigner returns a Presigner for b using its client's endpoint, region
+// and credentials.
+func (b *OSSBucket) Presigner() *Presigner {
+	config := b.Bucket.Client.Config
+	return &Presigner{
+		Endpoint:    config.Endpoint,
+		Region:      config.GetSignRegion(),
+		Bucket:      b.Bucket.BucketName,
+		Credentials: config.CredentialsProvider,
+	}
+}
+
+// SignOptions constrains a presigned request. Every set field must be sent
+// unchanged by the client, or OSS rejects the signature.
+type SignOptions struct {
+	ContentType string
+	// ContentLength pins the exact upload size when non-zero. Use a POST
+	// policy to allow a range instead.
+	ContentLength int64
+	ContentMD5    string
+}
+
+// SignedRequest is a presigned URL and the headers that must accompany it.
+type SignedRequest struct {
+	Method  string
+	URL     string
+	Header  http.Header
+	Expires time.Time
+}
+
+func (p *Presigner) now() time.Time {
+	if p.Now != nil {
+		return p.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (p *Presigner) credentials() (oss.Credentials, error) {
+	if p.Credentials == nil {
+		return nil, ErrCredentials
+	}
+	var creds oss.Credentials
+	if provider, ok := p.Credentials.(oss.CredentialsProviderE); ok {
+		var err error
+		if creds, err = provider.GetCredentialsE(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCredentials, err)
+		}
+	} else {
+		creds = p.Credentials.GetCredentials()
+	}
+	if creds == nil || creds.GetAccessKeyID() == "" || creds.GetAccessKeySecret() == "" {
+		return nil, ErrCredentials
+	}
+	return creds, nil
+}
+
+// SignPut presigns an upload of key.
+func (p *Presigner) SignPut(key string, expires time.Duration, opts *SignOptions) (*SignedRequest, error) {
+	return p.Sign(METHOD_PUT, key, expires, opts)
+}
+
+// SignGet presigns a download of key.
+func (p *Presigner) SignGet(key string, expires time.Duration) (*SignedRequest, error) {
+	return p.Sign(METHOD_GET, key, expires, nil)
+}
+
+// Sign presigns method on key with a query-string V4 signature valid for
+// expires.
+func (p *Presigner) Sign(method, key string, expires time.Duration, opts *SignOptions) (*SignedRequest, error) {
+	if err := checkMethod(method); err != nil {
+		return nil, err
+	}
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	if expires < time.Second || expires > MAX_PRESIGN_EXPIRES {
+		return nil, fmt.Errorf("%w: %s", ErrExpires, expires)
+	}
+	creds, err := p.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	if opts != nil {
+		if opts.ContentType != "" {
+			header.Set("Content-Type", opts.ContentType)
+		}
+		if opts.ContentMD5 != "" {
+			header.Set("Content-MD5", opts.ContentMD5)
+		}
+		if opts.ContentLength > 0 {
+			header.Set("Content-Length", strconv.FormatInt(opts.ContentLength, 10))
+		}
+	}
+
+	now := p.now()
+	params := map[string]string{
+		oss.HTTPParamSignatureVersion: SIGNING_ALGORITHM_V4,
+		oss.HTTPParamCredential:       p.credential(creds, now),
+		oss.HTTPParamDate:             now.Format(V4_TIME_LAYOUT),
+		oss.HTTPParamExpiresV2:        strconv.FormatInt(int64(expires/time.Second), 10),
+	}
+	if token := creds.GetSecurityToken(); token != "" {
+		params[oss.HTTPParamOssSecurityToken] = token
+	}
+	additional := additionalHeaders(header)
+	if len(additional) > 0 {
+		params[oss.HTTPParamAdditionalHeadersV2] = strings.Join(additional, ";")
+	}
+
+	query := canonicalQuery(params)
+	request := strings.Join([]string{
+		method,
+		"/" + p.Bucket + "/" + escapeKey(key),
+		query,
+		canonicalHeaders(header, additional),
+		strings.Join(additional, ";"),
+		UNSIGNED_PAYLOAD,
+	}, "\n")
+	signature := p.signature(creds, now, p.stringToSign(now, request))
+
+	return &SignedRequest{
+		Method:  method,
+		URL:     fmt.Sprintf("%s/%s?%s&%s=%s", p.bucketURL(), escapeKey(key), query, oss.HTTPParamSignatureV2, signature),
+		Header:  header,
+		Expires: now.Add(expires),
+	}, nil
+}
+
+// Callback asks OSS to POST to URL after a successful upload and relay its
+// response to the client. Body may use OSS variables such as ${object}.
+type Callback struct {
+	URL      string `json:"callbackUrl"`
+	Host     string `json:"callbackHost,omitempty"`
+	Body     string `json:"callbackBody"`
+	BodyType string `json:"callbackBodyType,omitempty"`
+}
+
+// PostOptions constrains a PostObject form.
+type PostOptions struct {
+	// KeyPrefix restricts the keys the form may upload to.
+	KeyPrefix string
+	Expires   time.Duration
+	// ContentType, when set, is pinned in the policy.
+	ContentType string
+	// MinSize and MaxSize bound the upload in bytes when MaxSize is set.
+	MinSize int64
+	MaxSize int64
+	// SuccessStatus defaults to DEFAULT_POST_SUCCESS_STATUS.
+	SuccessStatus int
+	Callback      *Callback
+}
+
+// PostForm is an HTML form upload to URL. Clients send Fields followed by
+// "key", within KeyPrefix, and finally "file".
+type PostForm struct {
+	URL     string
+	Fields  map[string]string
+	Expires time.Time
+}
+
+// PostPolicy signs a PostObject policy for browser and app uploads.
+func (p *Presigner) PostPolicy(opts PostOptions) (*PostForm, error) {
+	if opts.Expires < time.Second || opts.Expires > MAX_PRESIGN_EXPIRES {
+		return nil, fmt.Errorf("%w: %s", ErrExpires, opts.Expires)
+	}
+	if opts.MinSize < 0 || opts.MaxSize < opts.MinSize {
+		return nil, fmt.Errorf("%w: [%d, %d]", ErrSizeRange, opts.MinSize, opts.MaxSize)
+	}
+	creds, err := p.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	now := p.now()
+	status := opts.SuccessStatus
+	if status == 0 {
+		status = DEFAULT_POST_SUCCESS_STATUS
+	}
+
+	fields := map[string]string{
+		oss.HTTPParamSignatureVersion: SIGNING_ALGORITHM_V4,
+		oss.HTTPParamCredential:       p.credential(creds, now),
+		oss.HTTPParamDate:             now.Format(V4_TIME_LAYOUT),
+		"success_action_status":       strconv.Itoa(status),
+	}
+	conditions := []any{
+		map[string]string{"bucket": p.Bucket},
+		[]string{"starts-with", "$key", opts.KeyPrefix},
+	}
+	if opts.MaxSize > 0 {
+		conditions = append(conditions, []any{"content-length-range", opts.MinSize, opts.MaxSize})
+	}
+	if opts.ContentType != "" {
+		fields["Content-Type"] = opts.ContentType
+		conditions = append(conditions, []string{"eq", "$content-type", opts.ContentType})
+	}
+	if token := creds.GetSecurityToken(); token != "" {
+		fields[oss.HTTPParamOssSecurityToken] = token
+	}
+	if opts.Callback != nil {
+		callback, err := json.Marshal(opts.Callback)
+		if err != nil {
+			return nil, err
+		}
+		fields["callback"] = base64.StdEncoding.EncodeToString(callback)
+	}
+	for _, name := range sortedKeys(fields) {
+		if name != "Content-Type" {
+			conditions = append(conditions, map[string]string{name: fields[name]})
+		}
+	}
+
+	policy, err := json.Marshal(map[string]any{
+		"expiration": now.Add(opts.Expires).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fields["policy"] = base64.StdEncoding.EncodeToString(policy)
+	fields[oss.HTTPParamSignatureV2] = p.signature(creds, now, fields["policy"])
+	return &PostForm{URL: p.bucketURL(), Fields: fields, Expires: now.Add(opts.Expires)}, nil
+}
+
+func (p *Presigner) credential(creds oss.Credentials, now time.Time) string {
+	return fmt.Sprintf("%s/%s", creds.GetAccessKeyID(), p.scope(now))
+}
+
+func (p *Presigner) scope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aliyun_v4_request", now.Format(V4_DATE_LAYOUT), p.Region, SIGNING_PRODUCT)
+}
+
+func (p *Presigner) stringToSign(now time.Time, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{SIGNING_ALGORITHM_V4, now.Format(V4_TIME_LAYOUT), p.scope(now), hex.EncodeToString(sum[:])}, "\n")
+}
+
+// signature derives the day's signing key and signs s with it.
+func (p *Presigner) signature(creds oss.Credentials, now time.Time, s string) string {
+	key := []byte("aliyun_v4" + creds.GetAccessKeySecret())
+	for _, part := range []string{now.Format(V4_DATE_LAYOUT), p.Region, SIGNING_PRODUCT, "aliyun_v4_request", s} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(key)
+}
+
+// bucketURL is the virtual-hosted bucket URL, e.g.
+// https://bucket.oss-cn-hongkong.aliyuncs.com.
+func (p *Presigner) bucketURL() string {
+	scheme, host, found := strings.Cut(p.Endpoint, "://")
+	if !found {
+		scheme, host = "https", p.Endpoint
+	}
+	return fmt.Sprintf("%s://%s.%s", scheme, p.Bucket, strings.TrimSuffix(host, "/"))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// escapeKey percent-encodes key as OSS canonicalizes it, keeping slashes.
+func escapeKey(key string) string {
+	return strings.ReplaceAll(escape(key), "%2F", "/")
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func canonicalQuery(params map[string]string) string {
+	var pairs []string
+	for _, name := range sortedKeys(params) {
+		pairs = append(pairs, escape(name)+"="+escape(params[name]))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// additionalHeaders lists the signed headers V4 does not sign implicitly.
+func additionalHeaders(header http.Header) []string {
+	var names []string
+	for name := range header {
+		lower := strings.ToLower(name)
+		if lower != "content-type" && lower != "content-md5" && !strings.HasPrefix(lower, "x-oss-") {
+			names = append(names, lower)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// canonicalHeaders renders the signed headers, one "name:value\n" each.
+func canonicalHeaders(header http.Header, additional []string) string {
+	values := make(map[string]string)
+	for name, vs := range header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "content-md5" || strings.HasPrefix(lower, "x-oss-") || slices.Contains(additional, lower) {
+			values[lower] = strings.TrimSpace(vs[0])
+		}
+	}
+
+	var b strings.Builder
+	for _, name := range sortedKeys(values) {
+		b.WriteString(name + ":" + values[name] + "\n")
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+const (
+	testAccessKeyID     = "LTAI5tTestAccessKeyId"
+	testAccessKeySecret = "TestAccessKeySecret"
+	testEndpoint        = "https://oss-cn-hongkong.aliyuncs.com"
+	testRegion          = "cn-hongkong"
+	testBucketName      = "examplebucket"
+)
+
+type staticCredentials struct {
+	id, secret, token string
+}
+
+func (c staticCredentials) GetAccessKeyID() string          { return c.id }
+func (c staticCredentials) GetAccessKeySecret() string      { return c.secret }
+func (c staticCredentials) GetSecurityToken() string        { return c.token }
+func (c staticCredentials) GetCredentials() oss.Credentials { return c }
+
+func newTestPresigner(now time.Time) *Presigner {
+	return &Presigner{
+		Endpoint:    testEndpoint,
+		Region:      testRegion,
+		Bucket:      testBucketName,
+		Credentials: staticCredentials{id: testAccessKeyID, secret: testAccessKeySecret},
+		Now:         func() time.Time { return now },
+	}
+}
+
+func TestPresignerVectors(t *testing.T) {
+	p := newTestPresigner(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+
+	testCases := []struct {
+		name      string
+		method    string
+		key       string
+		opts      *SignOptions
+		url       string
+		signature string
+	}{
+		{
+			name:   "GET",
+			method: METHOD_GET,
+			key:    "logs/2024-05-01.log",
+			url: "https://examplebucket.oss-cn-hongkong.aliyuncs.com/logs/2024-05-01.log?" +
+				"x-oss-credential=LTAI5tTestAccessKeyId%2F20240501%2Fcn-hongkong%2Foss%2Faliyun_v4_request&x-oss-date=20240501T080000Z" +
+				"&x-oss-expires=900&x-oss-signature-version=OSS4-HMAC-SHA256",
+			signature: "04c3268baf1eba2cb4a2d1f064a49e3ab972476aae3357459ac8ec2cbcf970d4",
+		},
+		{
+			name:   "PUT with constraints",
+			method: METHOD_PUT,
+			key:    "avatars/user 1.png",
+			opts:   &SignOptions{ContentType: "image/png", ContentLength: 2048},
+			url: "https://examplebucket.oss-cn-hongkong.aliyuncs.com/avatars/user%201.png?" +
+				"x-oss-additional-headers=content-length&x-oss-credential=LTAI5tTestAccessKeyId%2F20240501%2Fcn-hongkong%2Foss%2Faliyun_v4_request" +
+				"&x-oss-date=20240501T080000Z&x-oss-expires=900&x-oss-signature-version=OSS4-HMAC-SHA256",
+			signature: "24665c91767b3d3a8de37c04c4dcd1de5f1163ce1058d81b64ed7684c838ac6f",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signed, err := p.Sign(tc.method, tc.key, 15*time.Minute, tc.opts)
+			if err != nil {
+				t.Fatalf("Failed to sign: %v", err)
+			}
+
+			base, signature, _ := strings.Cut(signed.URL, "&x-oss-signature=")
+			if base != tc.url {
+				t.Errorf("URL = %s\nwant  %s", base, tc.url)
+			}
+			if signature != tc.signature {
+				t.Errorf("signature = %s, want %s", signature, tc.signature)
+			}
+		})
+	}
+}
+
+// TestPresignerMatchesSDK signs with the OSS SDK, then re-signs at the same
+// instant and expects the same signature.
+func TestPresignerMatchesSDK(t *testing.T) {
+	client, err := oss.New(testEndpoint, testAccessKeyID, testAccessKeySecret,
+		oss.Region(testRegion), oss.AuthVersion(oss.AuthV4), oss.AdditionalHeaders([]string{"content-length"}))
+	if err != nil {
+		t.Fatalf("Failed to create the OSS client: %v", err)
+	}
+	bucket, err := client.Bucket(testBucketName)
+	if err != nil {
+		t.Fatalf("Failed to get the bucket: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		method  oss.HTTPMethod
+		key     string
+		options []oss.Option
+		opts    *SignOptions
+	}{
+		{"GET", oss.HTTPGet, "logs/2024-05-01.log", nil, nil},
+		{"PUT", oss.HTTPPut, "avatars/user 1.png", []oss.Option{oss.ContentType("image/png")}, &SignOptions{ContentType: "image/png"}},
+		{
+			"PUT with size", oss.HTTPPut, "logs/app.log",
+			[]oss.Option{oss.ContentType("text/plain"), oss.ContentLength(2048)},
+			&SignOptions{ContentType: "text/plain", ContentLength: 2048},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sdkURL, err := bucket.SignURL(tc.key, tc.method, 900, tc.options...)
+			if err != nil {
+				t.Fatalf("Failed to sign with the SDK: %v", err)
+			}
+			u, _ := url.Parse(sdkURL)
+			query := u.Query()
+
+			now, _ := time.Parse(V4_TIME_LAYOUT, query.Get(oss.HTTPParamDate))
+			expires, _ := strconv.Atoi(query.Get(oss.HTTPParamExpiresV2))
+			signed, err := newTestPresigner(now).Sign(string(tc.method), tc.key, time.Duration(expires)*time.Second, tc.opts)
+			if err != nil {
+				t.Fatalf("Failed to sign: %v", err)
+			}
+
+			ours, _ := url.Parse(signed.URL)
+			if got, want := ours.Query().Get(oss.HTTPParamSignatureV2), query.Get(oss.HTTPParamSignatureV2); got != want {
+				t.Errorf("signature = %s, SDK signed %s", got, want)
+			}
+			if ours.Host != u.Host || ours.Path != u.Path {
+				t.Errorf("URL = %s, SDK signed %s", signed.URL, sdkURL)
+			}
+		})
+	}
+}
+
+func TestPostPolicy(t *testing.T) {
+	p := newTestPresigner(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+
+	form, err := p.PostPolicy(PostOptions{
+		KeyPrefix:   "avatars/",
+		Expires:     time.Hour,
+		ContentType: "image/png",
+		MaxSize:     1 << 20,
+		Callback: &Callback{
+			URL:      "https://api.example.com/oss/callback",
+			Body:     "object=${object}&size=${size}",
+			BodyType: "application/x-www-form-urlencoded",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to sign the policy: %v", err)
+	}
+
+	if form.URL != "https://examplebucket.oss-cn-hongkong.aliyuncs.com" || form.Fields["success_action_status"] != "204" {
+		t.Errorf("Unexpected form %+v", form)
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(form.Fields["policy"])
+	var policy struct {
+		Expiration string `json:"expiration"`
+		Conditions []any  `json:"conditions"`
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		t.Fatalf("Failed to decode the policy: %v", err)
+	}
+	if policy.Expiration != "2024-05-01T09:00:00.000Z" {
+		t.Errorf("expiration = %s", policy.Expiration)
+	}
+	for _, want := range []string{
+		`{"bucket":"examplebucket"}`,
+		`["starts-with","$key","avatars/"]`,
+		`["content-length-range",0,1048576]`,
+		`["eq","$content-type","image/png"]`,
+		`{"x-oss-signature-version":"OSS4-HMAC-SHA256"}`,
+		`{"x-oss-credential":"LTAI5tTestAccessKeyId/20240501/cn-hongkong/oss/aliyun_v4_request"}`,
+		`{"callback":"` + form.Fields["callback"] + `"}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Policy %s is missing %s", data, want)
+		}
+	}
+
+	callback, _ := base64.StdEncoding.DecodeString(form.Fields["callback"])
+	if !strings.Contains(string(callback), `"callbackUrl":"https://api.example.com/oss/callback"`) {
+		t.Errorf("Unexpected callback %s", callback)
+	}
+
+	if want := "aefc08b159f2090f85680c7684b1d001781abde08d68b6653e64f0b134d59e67"; form.Fields["x-oss-signature"] != want {
+		t.Errorf("signature = %s, want %s", form.Fields["x-oss-signature"], want)
+	}
+}
+
+func TestPresignerErrors(t *testing.T) {
+	p := newTestPresigner(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+
+	if _, err := p.SignGet("a.txt", 8*24*time.Hour); !errors.Is(err, ErrExpires) {
+		t.Errorf("got %v, want ErrExpires", err)
+	}
+	if _, err := p.Sign("DELETE", "a.txt", time.Hour, nil); !errors.Is(err, ErrMethod) {
+		t.Errorf("got %v, want ErrMethod", err)
+	}
+	if _, err := p.SignGet("../a.txt", time.Hour); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got %v, want ErrInvalidKey", err)
+	}
+	if _, err := p.PostPolicy(PostOptions{Expires: time.Hour, MinSize: 10, MaxSize: 5}); !errors.Is(err, ErrSizeRange) {
+		t.Errorf("got %v, want ErrSizeRange", err)
+	}
+
+	p.Credentials = staticCredentials{}
+	if _, err := p.SignGet("a.txt", time.Hour); !errors.Is(err, ErrCredentials) {
+		t.Errorf("got %v, want ErrCredentials", err)
+	}
+}
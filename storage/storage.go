@@ -0,0 +1,131 @@
+// Package storage abstracts object storage so feature code can run against
+// Aliyun OSS in production and a local directory or memory elsewhere.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	METHOD_GET = "GET"
+	METHOD_PUT = "PUT"
+
+	DEFAULT_CONTENT_TYPE = "application/octet-stream"
+)
+
+var (
+	ErrNotExist   = errors.New("storage: object does not exist")
+	ErrInvalidKey = errors.New("storage: invalid object key")
+	ErrMethod     = errors.New("storage: unsupported signing method")
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	// ETag is the backend's content hash, empty where it has none.
+	ETag         string
+	LastModified time.Time
+}
+
+// PutOptions tunes Put. A nil *PutOptions uses the defaults.
+type PutOptions struct {
+	// ContentType defaults to a guess from the key's extension.
+	ContentType string
+}
+
+// Bucket is a flat namespace of objects addressed by slash-separated keys.
+// Missing objects are reported as ErrNotExist, except by Delete, which
+// treats them as already deleted.
+type Bucket interface {
+	Put(ctx context.Context, key string, r io.Reader, opts *PutOptions) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// SignURL returns a URL granting method on key until expires elapses.
+	SignURL(ctx context.Context, key, method string, expires time.Duration) (string, error)
+}
+
+// PutFile uploads the file at name to key, in parts when it is larger than
+// DEFAULT_PART_SIZE and b is a FileUploader.
+func PutFile(ctx context.Context, b Bucket, key, name string, opts *PutOptions) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if u, ok := b.(FileUploader); ok {
+		if stat, err := f.Stat(); err == nil && stat.Size() > DEFAULT_PART_SIZE {
+			multipart := &MultipartOptions{}
+			if opts != nil {
+				multipart.ContentType = opts.ContentType
+			}
+			return u.UploadFile(ctx, key, name, multipart)
+		}
+	}
+	return b.Put(ctx, key, f, opts)
+}
+
+// GetFile downloads key into the file at name, leaving no partial file
+// behind on failure.
+func GetFile(ctx context.Context, b Bucket, key, name string) error {
+	r, err := b.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	return f.Close()
+}
+
+// CheckKey rejects keys that are empty, absolute, or that escape their
+// prefix with "." or ".." segments.
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+func contentType(key string, opts *PutOptions) string {
+	if opts != nil && opts.ContentType != "" {
+		return opts.ContentType
+	}
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		return t
+	}
+	return DEFAULT_CONTENT_TYPE
+}
+
+func checkMethod(method string) error {
+	if method != METHOD_GET && method != METHOD_PUT {
+		return fmt.Errorf("%w: %s", ErrMethod, method)
+	}
+	return nil
+}
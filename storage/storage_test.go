@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+func TestBuckets(t *testing.T) {
+	testCases := []struct {
+		name   string
+		bucket func(t *testing.T) Bucket
+	}{
+		{"Dir", func(t *testing.T) Bucket { return &DirBucket{Root: t.TempDir()} }},
+		{"Missing dir", func(t *testing.T) Bucket { return &DirBucket{Root: filepath.Join(t.TempDir(), "new")} }},
+		{"Memory", func(t *testing.T) Bucket { return NewMemoryBucket() }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testBucket(t, tc.bucket(t))
+		})
+	}
+}
+
+// testBucket checks the behaviour every Bucket shares.
+func testBucket(t *testing.T, b Bucket) {
+	ctx := context.Background()
+
+	if objects, err := b.List(ctx, ""); err != nil || len(objects) != 0 {
+		t.Fatalf("List() on an empty bucket = %v, %v", objects, err)
+	}
+
+	for key, data := range map[string]string{
+		"assets/a.txt":        "hello",
+		"assets/b/c.json":     `{"c":1}`,
+		"assetsx/d.bin":       "d",
+		"firmware/3.40.hwdev": "project",
+	} {
+		if err := b.Put(ctx, key, strings.NewReader(data), nil); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	if err := b.Put(ctx, "assets/a.txt", strings.NewReader("hello again"), &PutOptions{ContentType: "text/x-test"}); err != nil {
+		t.Fatalf("Failed to overwrite: %v", err)
+	}
+
+	r, err := b.Get(ctx, "assets/a.txt")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "hello again" {
+		t.Errorf("Get() = %q", data)
+	}
+
+	info, err := b.Stat(ctx, "assets/b/c.json")
+	if err != nil {
+		t.Fatalf("Failed to stat: %v", err)
+	}
+	if info.Key != "assets/b/c.json" || info.Size != 7 || info.ContentType != "application/json" || info.LastModified.IsZero() {
+		t.Errorf("Unexpected info %+v", info)
+	}
+
+	objects, err := b.List(ctx, "assets/")
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	if got := strings.Join(keys, ","); got != "assets/a.txt,assets/b/c.json" {
+		t.Errorf("List(assets/) = %s", got)
+	}
+	if objects, _ := b.List(ctx, "assets"); len(objects) != 3 {
+		t.Errorf("List(assets) = %+v, want 3 objects", objects)
+	}
+
+	if _, err := b.SignURL(ctx, "assets/a.txt", METHOD_GET, time.Hour); err != nil {
+		t.Errorf("Failed to sign: %v", err)
+	}
+	if _, err := b.SignURL(ctx, "assets/a.txt", "DELETE", time.Hour); !errors.Is(err, ErrMethod) {
+		t.Errorf("got %v, want ErrMethod", err)
+	}
+
+	if err := b.Delete(ctx, "assets/a.txt"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := b.Delete(ctx, "assets/a.txt"); err != nil {
+		t.Errorf("Deleting a missing object failed: %v", err)
+	}
+	if _, err := b.Get(ctx, "assets/a.txt"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Get() after delete got %v, want ErrNotExist", err)
+	}
+	if _, err := b.Stat(ctx, "assets/b"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat() of a prefix got %v, want ErrNotExist", err)
+	}
+
+	for _, key := range []string{"", "/abs", "a/../../escape", "a//b", "dir/"} {
+		if err := b.Put(ctx, key, strings.NewReader("x"), nil); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBucket()
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "a.txt")
+	os.WriteFile(src, []byte("file"), 0o644)
+	if err := PutFile(ctx, b, "a.txt", src, nil); err != nil {
+		t.Fatalf("Failed to put the file: %v", err)
+	}
+
+	dst := filepath.Join(dir, "b.txt")
+	if err := GetFile(ctx, b, "a.txt", dst); err != nil {
+		t.Fatalf("Failed to get the file: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "file" {
+		t.Errorf("Downloaded %q", data)
+	}
+
+	if err := GetFile(ctx, b, "missing", filepath.Join(dir, "missing")); !errors.Is(err, ErrNotExist) {
+		t.Errorf("got %v, want ErrNotExist", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("A failed download left a file behind")
+	}
+}
+
+func TestMemoryBucketVerifyURL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	b := NewMemoryBucket()
+	b.Now = func() time.Time { return now }
+
+	signed, err := b.SignURL(ctx, "assets/a b.txt", METHOD_PUT, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	if key, err := b.VerifyURL(signed, METHOD_PUT); err != nil || key != "assets/a b.txt" {
+		t.Errorf("VerifyURL() = %q, %v", key, err)
+	}
+	if _, err := b.VerifyURL(signed, METHOD_GET); !errors.Is(err, ErrMethod) {
+		t.Errorf("got %v, want ErrMethod", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := b.VerifyURL(signed, METHOD_PUT); err == nil {
+		t.Errorf("Expected an expired URL to fail")
+	}
+}
+
+func TestOSSError(t *testing.T) {
+	missing := oss.ServiceError{Code: "NoSuchKey", StatusCode: http.StatusNotFound}
+	if err := ossError(missing); !errors.Is(err, ErrNotExist) {
+		t.Errorf("got %v, want ErrNotExist", err)
+	}
+
+	denied := oss.ServiceError{Code: "AccessDenied", StatusCode: http.StatusForbidden}
+	if err := ossError(denied); errors.Is(err, ErrNotExist) {
+		t.Errorf("An access error should not map to ErrNotExist")
+	}
+}
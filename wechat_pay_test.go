@@ -12,6 +12,8 @@ import (
 	"github.com/wechatpay-apiv3/wechatpay-go/services/payments/h5"
 	"github.com/wechatpay-apiv3/wechatpay-go/services/payments/native"
 	"github.com/wechatpay-apiv3/wechatpay-go/utils"
+
+	"tests/wechatpay/wechatpaytest"
 )
 
 const (
@@ -131,28 +133,11 @@ func TestWechatPayH5Prepay(t *testing.T) {
 		H5_PREPAY_H5_INFO_TYPE_ANDROID = "Android"
 	)
 
-	appId := os.Getenv("WECHAT_PAY_APP_ID")
-	mchId := os.Getenv("WECHAT_PAY_MCH_ID")
-	serialNumber := os.Getenv("WECHAT_PAY_MCH_CERTIFICATE_SERIAL_NUMBER")
-	apiKey := os.Getenv("WECHAT_PAY_MCH_API_V3_KEY")
-
 	var (
 		ctx context.Context = context.Background()
 	)
 
-	pk, err := utils.LoadPrivateKeyWithPath(WECHATPAY_PRIVATE_KEY_PATH)
-	if err != nil {
-		t.Fatalf("Failed to load merchant private key: %s\n", err.Error())
-	}
-
-	opts := []core.ClientOption{
-		option.WithWechatPayAutoAuthCipher(mchId, serialNumber, pk, apiKey),
-	}
-
-	client, err := core.NewClient(ctx, opts...)
-	if err != nil {
-		t.Fatalf("Failed to new wechat pay client: %s\n", err.Error())
-	}
+	client, appId, mchId := newWechatPayClient(t, ctx)
 
 	svc := h5.H5ApiService{Client: client}
 	resp, result, err := svc.Prepay(ctx, h5.PrepayRequest{
@@ -191,24 +176,7 @@ func TestWechatPayAppPrepay(t *testing.T) {
 		ctx context.Context = context.Background()
 	)
 
-	appId := os.Getenv("WECHAT_PAY_APP_ID")
-	mchId := os.Getenv("WECHAT_PAY_MCH_ID")
-	serialNumber := os.Getenv("WECHAT_PAY_MCH_CERTIFICATE_SERIAL_NUMBER")
-	apiKey := os.Getenv("WECHAT_PAY_MCH_API_V3_KEY")
-
-	pk, err := utils.LoadPrivateKeyWithPath(WECHATPAY_PRIVATE_KEY_PATH)
-	if err != nil {
-		t.Fatalf("Failed to load merchant private key: %s\n", err.Error())
-	}
-
-	opts := []core.ClientOption{
-		option.WithWechatPayAutoAuthCipher(mchId, serialNumber, pk, apiKey),
-	}
-
-	client, err := core.NewClient(ctx, opts...)
-	if err != nil {
-		t.Fatalf("Failed to new wechat pay client: %s\n", err.Error())
-	}
+	client, appId, mchId := newWechatPayClient(t, ctx)
 
 	svc := app.AppApiService{Client: client}
 	resp, result, err := svc.Prepay(ctx, app.PrepayRequest{
@@ -241,24 +209,7 @@ func TestWechatPayNativePrepay(t *testing.T) {
 		ctx context.Context = context.Background()
 	)
 
-	appId := os.Getenv("WECHAT_PAY_APP_ID")
-	mchId := os.Getenv("WECHAT_PAY_MCH_ID")
-	serialNumber := os.Getenv("WECHAT_PAY_MCH_CERTIFICATE_SERIAL_NUMBER")
-	apiKey := os.Getenv("WECHAT_PAY_MCH_API_V3_KEY")
-
-	pk, err := utils.LoadPrivateKeyWithPath(WECHATPAY_PRIVATE_KEY_PATH)
-	if err != nil {
-		t.Fatalf("Failed to load merchant private key: %s\n", err.Error())
-	}
-
-	opts := []core.ClientOption{
-		option.WithWechatPayAutoAuthCipher(mchId, serialNumber, pk, apiKey),
-	}
-
-	client, err := core.NewClient(ctx, opts...)
-	if err != nil {
-		t.Fatalf("Failed to new wechat pay client: %s\n", err.Error())
-	}
+	client, appId, mchId := newWechatPayClient(t, ctx)
 
 	svc := native.NativeApiService{Client: client}
 
@@ -278,3 +229,45 @@ func TestWechatPayNativePrepay(t *testing.T) {
 
 	t.Logf("status=%d resp=%s", result.Response.StatusCode, resp)
 }
+
+// newWechatPayClient returns a client for the real API when WECHAT_PAY_MCH_ID
+// is set, otherwise a client for a local mock server.
+func newWechatPayClient(t *testing.T, ctx context.Context) (*core.Client, string, string) {
+	appId := os.Getenv("WECHAT_PAY_APP_ID")
+	mchId := os.Getenv("WECHAT_PAY_MCH_ID")
+	serialNumber := os.Getenv("WECHAT_PAY_MCH_CERTIFICATE_SERIAL_NUMBER")
+	apiKey := os.Getenv("WECHAT_PAY_MCH_API_V3_KEY")
+
+	var opts []core.ClientOption
+
+	if mchId != "" {
+		pk, err := utils.LoadPrivateKeyWithPath(WECHATPAY_PRIVATE_KEY_PATH)
+		if err != nil {
+			t.Fatalf("Failed to load merchant private key: %s\n", err.Error())
+		}
+
+		opts = []core.ClientOption{
+			option.WithWechatPayAutoAuthCipher(mchId, serialNumber, pk, apiKey),
+		}
+	} else {
+		server, err := wechatpaytest.NewServer()
+		if err != nil {
+			t.Fatalf("Failed to start wechat pay mock server: %s\n", err.Error())
+		}
+		t.Cleanup(server.Close)
+
+		opts, err = server.ClientOptions(ctx)
+		if err != nil {
+			t.Fatalf("Failed to build wechat pay mock options: %s\n", err.Error())
+		}
+
+		appId, mchId = server.AppID, server.MchID
+	}
+
+	client, err := core.NewClient(ctx, opts...)
+	if err != nil {
+		t.Fatalf("Failed to new wechat pay client: %s\n", err.Error())
+	}
+
+	return client, appId, mchId
+}
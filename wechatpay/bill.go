@@ -0,0 +1,490 @@
+// Package wechatpay adds the WeChat Pay v3 APIs that the SDK does not ship.
+// Everything builds on the same *core.Client the payment services use.
+package wechatpay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/wechatpay-apiv3/wechatpay-go/core"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/auth/validators"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/consts"
+)
+
+const (
+	BILL_TRADE_PATH     = "/v3/bill/tradebill"
+	BILL_FUND_FLOW_PATH = "/v3/bill/fundflowbill"
+	BILL_DATE_LAYOUT    = "2006-01-02"
+	BILL_TIME_LAYOUT    = "2006-01-02 15:04:05"
+
+	// Bill type: ALL / SUCCESS / REFUND
+	BILL_TYPE_ALL     = "ALL"
+	BILL_TYPE_SUCCESS = "SUCCESS"
+	BILL_TYPE_REFUND  = "REFUND"
+
+	// Account type: BASIC / OPERATION / FEES
+	BILL_ACCOUNT_TYPE_BASIC     = "BASIC"
+	BILL_ACCOUNT_TYPE_OPERATION = "OPERATION"
+	BILL_ACCOUNT_TYPE_FEES      = "FEES"
+
+	BILL_TAR_TYPE_GZIP = "GZIP"
+	BILL_HASH_TYPE     = "SHA1"
+)
+
+var (
+	ErrBillHashMismatch = errors.New("wechatpay: bill hash mismatch")
+
+	billLocation = time.FixedZone("CST", 8*60*60)
+)
+
+// BillApiService downloads and parses the daily trade and fund-flow bills.
+type BillApiService struct {
+	Client *core.Client
+}
+
+type TradeBillRequest struct {
+	BillDate time.Time
+	BillType string
+	Gzip     bool
+}
+
+type FundFlowBillRequest struct {
+	BillDate    time.Time
+	AccountType string
+	Gzip        bool
+}
+
+// BillLink is the response of the apply-bill endpoints.
+type BillLink struct {
+	HashType    string `json:"hash_type"`
+	HashValue   string `json:"hash_value"`
+	DownloadURL string `json:"download_url"`
+}
+
+type TradeBillRow struct {
+	TradeTime          time.Time
+	AppID              string
+	MchID              string
+	SubMchID           string
+	DeviceInfo         string
+	TransactionID      string
+	OutTradeNo         string
+	OpenID             string
+	TradeType          string
+	TradeState         string
+	BankType           string
+	Currency           string
+	SettlementAmount   decimal.Decimal
+	CouponAmount       decimal.Decimal
+	RefundID           string
+	OutRefundNo        string
+	RefundAmount       decimal.Decimal
+	CouponRefundAmount decimal.Decimal
+	RefundType         string
+	RefundStatus       string
+	Description        string
+	Attach             string
+	Fee                decimal.Decimal
+	Rate               string
+	OrderAmount        decimal.Decimal
+	RefundApplyAmount  decimal.Decimal
+	RateRemark         string
+}
+
+type TradeBillSummary struct {
+	TotalCount         int
+	SettlementAmount   decimal.Decimal
+	RefundAmount       decimal.Decimal
+	CouponRefundAmount decimal.Decimal
+	Fee                decimal.Decimal
+	OrderAmount        decimal.Decimal
+	RefundApplyAmount  decimal.Decimal
+}
+
+type TradeBill struct {
+	Rows    []TradeBillRow
+	Summary TradeBillSummary
+}
+
+type FundFlowBillRow struct {
+	AccountingTime time.Time
+	TransactionID  string
+	FlowID         string
+	BusinessName   string
+	BusinessType   string
+	Direction      string
+	Amount         decimal.Decimal
+	Balance        decimal.Decimal
+	Applicant      string
+	Remark         string
+	VoucherNo      string
+}
+
+type FundFlowBillSummary struct {
+	TotalCount    int
+	IncomeCount   int
+	IncomeAmount  decimal.Decimal
+	ExpenseCount  int
+	ExpenseAmount decimal.Decimal
+}
+
+type FundFlowBill struct {
+	Rows    []FundFlowBillRow
+	Summary FundFlowBillSummary
+}
+
+// ApplyTradeBill requests the download link of the trade bill.
+func (a *BillApiService) ApplyTradeBill(ctx context.Context, req TradeBillRequest) (*BillLink, error) {
+	query := url.Values{"bill_date": {req.BillDate.Format(BILL_DATE_LAYOUT)}}
+	if req.BillType != "" {
+		query.Set("bill_type", req.BillType)
+	}
+	if req.Gzip {
+		query.Set("tar_type", BILL_TAR_TYPE_GZIP)
+	}
+
+	return a.apply(ctx, BILL_TRADE_PATH, query)
+}
+
+// ApplyFundFlowBill requests the download link of the fund-flow bill.
+func (a *BillApiService) ApplyFundFlowBill(ctx context.Context, req FundFlowBillRequest) (*BillLink, error) {
+	query := url.Values{"bill_date": {req.BillDate.Format(BILL_DATE_LAYOUT)}}
+	if req.AccountType != "" {
+		query.Set("account_type", req.AccountType)
+	}
+	if req.Gzip {
+		query.Set("tar_type", BILL_TAR_TYPE_GZIP)
+	}
+
+	return a.apply(ctx, BILL_FUND_FLOW_PATH, query)
+}
+
+// DownloadTradeBill fetches, verifies and parses the trade bill of a day.
+func (a *BillApiService) DownloadTradeBill(ctx context.Context, req TradeBillRequest) (*TradeBill, error) {
+	link, err := a.ApplyTradeBill(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := a.Download(ctx, link, req.Gzip)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTradeBill(bytes.NewReader(data))
+}
+
+// DownloadFundFlowBill fetches, verifies and parses the fund-flow bill of a day.
+func (a *BillApiService) DownloadFundFlowBill(ctx context.Context, req FundFlowBillRequest) (*FundFlowBill, error) {
+	link, err := a.ApplyFundFlowBill(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := a.Download(ctx, link, req.Gzip)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFundFlowBill(bytes.NewReader(data))
+}
+
+// Download fetches the bill behind link and checks its hash. The hash is
+// computed over the uncompressed bill, so gzip bills are inflated first.
+func (a *BillApiService) Download(ctx context.Context, link *BillLink, gzipped bool) ([]byte, error) {
+	// The download response is a raw file without a WeChat Pay signature.
+	client := core.NewClientWithValidator(a.Client, &validators.NullValidator{})
+
+	result, err := client.Get(ctx, link.DownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("wechatpay: download bill: %w", err)
+	}
+	defer result.Response.Body.Close()
+
+	var r io.Reader = result.Response.Body
+	if gzipped {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("wechatpay: open gzip bill: %w", err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("wechatpay: read bill: %w", err)
+	}
+
+	if err := verifyBillHash(link, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (a *BillApiService) apply(ctx context.Context, path string, query url.Values) (*BillLink, error) {
+	result, err := a.Client.Request(ctx, http.MethodGet, consts.WechatPayAPIServer+path, http.Header{}, query, nil, consts.ApplicationJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Response.Body.Close()
+
+	link := new(BillLink)
+	if err := json.NewDecoder(result.Response.Body).Decode(link); err != nil {
+		return nil, fmt.Errorf("wechatpay: decode bill link: %w", err)
+	}
+
+	return link, nil
+}
+
+func verifyBillHash(link *BillLink, data []byte) error {
+	if !strings.EqualFold(link.HashType, BILL_HASH_TYPE) {
+		return fmt.Errorf("wechatpay: unsupported bill hash type %q", link.HashType)
+	}
+
+	sum := sha1.Sum(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), link.HashValue) {
+		return ErrBillHashMismatch
+	}
+
+	return nil
+}
+
+// ParseTradeBill parses a trade bill of any bill type. Columns are looked up
+// by their header name, so ALL, SUCCESS and REFUND bills share one row type.
+func ParseTradeBill(r io.Reader) (*TradeBill, error) {
+	detail, summary, err := readBill(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bill := &TradeBill{Rows: make([]TradeBillRow, 0, len(detail.rows))}
+	for _, row := range detail.rows {
+		var (
+			item TradeBillRow
+			p    = billFieldParser{table: detail, row: row}
+		)
+
+		item.TradeTime = p.time("交易时间")
+		item.AppID = p.string("公众账号ID")
+		item.MchID = p.string("商户号")
+		item.SubMchID = p.string("特约商户号")
+		item.DeviceInfo = p.string("设备号")
+		item.TransactionID = p.string("微信订单号")
+		item.OutTradeNo = p.string("商户订单号")
+		item.OpenID = p.string("用户标识")
+		item.TradeType = p.string("交易类型")
+		item.TradeState = p.string("交易状态")
+		item.BankType = p.string("付款银行")
+		item.Currency = p.string("货币种类")
+		item.SettlementAmount = p.decimal("应结订单金额")
+		item.CouponAmount = p.decimal("代金券金额")
+		item.RefundID = p.string("微信退款单号")
+		item.OutRefundNo = p.string("商户退款单号")
+		item.RefundAmount = p.decimal("退款金额")
+		item.CouponRefundAmount = p.decimal("充值券退款金额")
+		item.RefundType = p.string("退款类型")
+		item.RefundStatus = p.string("退款状态")
+		item.Description = p.string("商品名称")
+		item.Attach = p.string("商户数据包")
+		item.Fee = p.decimal("手续费")
+		item.Rate = p.string("费率")
+		item.OrderAmount = p.decimal("订单金额")
+		item.RefundApplyAmount = p.decimal("申请退款金额")
+		item.RateRemark = p.string("费率备注")
+
+		if p.err != nil {
+			return nil, p.err
+		}
+		bill.Rows = append(bill.Rows, item)
+	}
+
+	if len(summary.rows) > 0 {
+		p := billFieldParser{table: summary, row: summary.rows[0]}
+
+		bill.Summary.TotalCount = p.int("总交易单数")
+		bill.Summary.SettlementAmount = p.decimal("应结订单总金额")
+		bill.Summary.RefundAmount = p.decimal("退款总金额")
+		bill.Summary.CouponRefundAmount = p.decimal("充值券退款总金额")
+		bill.Summary.Fee = p.decimal("手续费总金额")
+		bill.Summary.OrderAmount = p.decimal("订单总金额")
+		bill.Summary.RefundApplyAmount = p.decimal("申请退款总金额")
+
+		if p.err != nil {
+			return nil, p.err
+		}
+	}
+
+	return bill, nil
+}
+
+// ParseFundFlowBill parses a fund-flow bill.
+func ParseFundFlowBill(r io.Reader) (*FundFlowBill, error) {
+	detail, summary, err := readBill(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bill := &FundFlowBill{Rows: make([]FundFlowBillRow, 0, len(detail.rows))}
+	for _, row := range detail.rows {
+		var (
+			item FundFlowBillRow
+			p    = billFieldParser{table: detail, row: row}
+		)
+
+		item.AccountingTime = p.time("记账时间")
+		item.TransactionID = p.string("微信支付业务单号")
+		item.FlowID = p.string("资金流水单号")
+		item.BusinessName = p.string("业务名称")
+		item.BusinessType = p.string("业务类型")
+		item.Direction = p.string("收支类型")
+		item.Amount = p.decimal("收支金额（元）")
+		item.Balance = p.decimal("账户结余（元）")
+		item.Applicant = p.string("资金变更提交申请人")
+		item.Remark = p.string("备注")
+		item.VoucherNo = p.string("业务凭证号")
+
+		if p.err != nil {
+			return nil, p.err
+		}
+		bill.Rows = append(bill.Rows, item)
+	}
+
+	if len(summary.rows) > 0 {
+		p := billFieldParser{table: summary, row: summary.rows[0]}
+
+		bill.Summary.TotalCount = p.int("资金流水总笔数")
+		bill.Summary.IncomeCount = p.int("收入笔数")
+		bill.Summary.IncomeAmount = p.decimal("收入金额")
+		bill.Summary.ExpenseCount = p.int("支出笔数")
+		bill.Summary.ExpenseAmount = p.decimal("支出金额")
+
+		if p.err != nil {
+			return nil, p.err
+		}
+	}
+
+	return bill, nil
+}
+
+type billTable struct {
+	columns map[string]int
+	rows    [][]string
+}
+
+// readBill splits a bill into its detail and summary tables. Each table
+// starts with a header line whose fields are not prefixed with a backtick.
+func readBill(r io.Reader) (*billTable, *billTable, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var tables []*billTable
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("wechatpay: read bill: %w", err)
+		}
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+
+		if !strings.HasPrefix(record[0], "`") {
+			table := &billTable{columns: make(map[string]int, len(record))}
+			for i, name := range record {
+				table.columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+			}
+			tables = append(tables, table)
+			continue
+		}
+
+		if len(tables) == 0 {
+			return nil, nil, errors.New("wechatpay: bill row before header")
+		}
+
+		for i := range record {
+			record[i] = strings.TrimSpace(strings.TrimPrefix(record[i], "`"))
+		}
+		tables[len(tables)-1].rows = append(tables[len(tables)-1].rows, record)
+	}
+
+	switch len(tables) {
+	case 0:
+		return nil, nil, errors.New("wechatpay: empty bill")
+	case 1:
+		return tables[0], &billTable{}, nil
+	default:
+		return tables[0], tables[1], nil
+	}
+}
+
+type billFieldParser struct {
+	table *billTable
+	row   []string
+	err   error
+}
+
+func (p *billFieldParser) string(name string) string {
+	i, ok := p.table.columns[name]
+	if !ok || i >= len(p.row) {
+		return ""
+	}
+	return p.row[i]
+}
+
+func (p *billFieldParser) decimal(name string) decimal.Decimal {
+	s := p.string(name)
+	if s == "" || p.err != nil {
+		return decimal.Zero
+	}
+
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		p.err = fmt.Errorf("wechatpay: parse bill field %s=%q: %w", name, s, err)
+	}
+	return d
+}
+
+func (p *billFieldParser) int(name string) int {
+	s := p.string(name)
+	if s == "" || p.err != nil {
+		return 0
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		p.err = fmt.Errorf("wechatpay: parse bill field %s=%q: %w", name, s, err)
+	}
+	return n
+}
+
+func (p *billFieldParser) time(name string) time.Time {
+	s := p.string(name)
+	if s == "" || p.err != nil {
+		return time.Time{}
+	}
+
+	t, err := time.ParseInLocation(BILL_TIME_LAYOUT, s, billLocation)
+	if err != nil {
+		p.err = fmt.Errorf("wechatpay: parse bill field %s=%q: %w", name, s, err)
+	}
+	return t
+}
@@ -0,0 +1,179 @@
+package wechatpay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/wechatpay-apiv3/wechatpay-go/core"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/option"
+)
+
+const testTradeBill = "交易时间,公众账号ID,商户号,特约商户号,设备号,微信订单号,商户订单号,用户标识,交易类型,交易状态,付款银行,货币种类,应结订单金额,代金券金额,微信退款单号,商户退款单号,退款金额,充值券退款金额,退款类型,退款状态,商品名称,商户数据包,手续费,费率,订单金额,申请退款金额,费率备注\n" +
+	"`2024-06-11 09:00:00,`wx0001,`1900000001,`0,`,`4200000001,`001,`oUpF8uMuAJO_M2pxb1Q9zNjWeS6o,`NATIVE,`SUCCESS,`OTHERS,`CNY,`0.01,`0.00,`0,`0,`0.00,`0.00,`,`,`TEST,`,`0.00000,`0.60%,`0.01,`0.00,`\n" +
+	"`2024-06-11 10:30:00,`wx0001,`1900000001,`0,`,`4200000002,`002,`oUpF8uMuAJO_M2pxb1Q9zNjWeS6o,`APP,`REFUND,`OTHERS,`CNY,`0.00,`0.00,`5000000001,`R002,`1.10,`0.00,`ORIGINAL,`SUCCESS,`TEST,`,`-0.01000,`0.60%,`0.00,`1.10,`\n" +
+	"总交易单数,应结订单总金额,退款总金额,充值券退款总金额,手续费总金额,订单总金额,申请退款总金额\n" +
+	"`2,`0.01,`1.10,`0.00,`-0.01000,`0.01,`1.10\n"
+
+const testFundFlowBill = "记账时间,微信支付业务单号,资金流水单号,业务名称,业务类型,收支类型,收支金额（元）,账户结余（元）,资金变更提交申请人,备注,业务凭证号\n" +
+	"`2024-06-11 09:00:01,`4200000001,`F001,`交易,`交易,`收入,`0.01,`100.01,`system,`,`4200000001\n" +
+	"资金流水总笔数,收入笔数,收入金额,支出笔数,支出金额\n" +
+	"`1,`1,`0.01,`0,`0.00\n"
+
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newBillTestClient(t *testing.T, handler http.Handler) *core.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	target, _ := url.Parse(server.URL)
+
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate merchant private key: %v", err)
+	}
+
+	client, err := core.NewClient(context.Background(),
+		option.WithMerchantCredential("1900000001", "TESTSERIAL", pk),
+		option.WithoutValidator(),
+		option.WithHTTPClient(&http.Client{Transport: rewriteTransport{target: target}}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to new wechat pay client: %v", err)
+	}
+
+	return client
+}
+
+func billHandler(t *testing.T, path, content string, gzipped bool, hash string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("bill_date") != "2024-06-11" {
+			t.Errorf("unexpected bill_date %q", r.URL.Query().Get("bill_date"))
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "WECHATPAY2-SHA256-RSA2048 ") {
+			t.Errorf("missing authorization header")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(BillLink{
+			HashType:    BILL_HASH_TYPE,
+			HashValue:   hash,
+			DownloadURL: "https://api.mch.weixin.qq.com/v3/billdownload/file?token=abc",
+		})
+	})
+
+	mux.HandleFunc("/v3/billdownload/file", func(w http.ResponseWriter, r *http.Request) {
+		if !gzipped {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		gw := gzip.NewWriter(w)
+		_, _ = gw.Write([]byte(content))
+		_ = gw.Close()
+	})
+
+	return mux
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadTradeBill(t *testing.T) {
+	for _, gzipped := range []bool{false, true} {
+		client := newBillTestClient(t, billHandler(t, BILL_TRADE_PATH, testTradeBill, gzipped, sha1Hex(testTradeBill)))
+		svc := BillApiService{Client: client}
+
+		bill, err := svc.DownloadTradeBill(context.Background(), TradeBillRequest{
+			BillDate: time.Date(2024, 6, 11, 0, 0, 0, 0, time.Local),
+			BillType: BILL_TYPE_ALL,
+			Gzip:     gzipped,
+		})
+		if err != nil {
+			t.Fatalf("Failed to download trade bill (gzip=%v): %v", gzipped, err)
+		}
+
+		if len(bill.Rows) != 2 {
+			t.Fatalf("got %d rows, want 2", len(bill.Rows))
+		}
+
+		row := bill.Rows[1]
+		if row.OutRefundNo != "R002" || !row.RefundAmount.Equal(decimal.RequireFromString("1.10")) {
+			t.Errorf("unexpected refund row: %+v", row)
+		}
+		if row.TradeTime.Format(BILL_TIME_LAYOUT) != "2024-06-11 10:30:00" {
+			t.Errorf("unexpected trade time %v", row.TradeTime)
+		}
+		if bill.Summary.TotalCount != 2 || !bill.Summary.Fee.Equal(decimal.RequireFromString("-0.01")) {
+			t.Errorf("unexpected summary: %+v", bill.Summary)
+		}
+	}
+}
+
+func TestDownloadFundFlowBill(t *testing.T) {
+	client := newBillTestClient(t, billHandler(t, BILL_FUND_FLOW_PATH, testFundFlowBill, true, sha1Hex(testFundFlowBill)))
+	svc := BillApiService{Client: client}
+
+	bill, err := svc.DownloadFundFlowBill(context.Background(), FundFlowBillRequest{
+		BillDate:    time.Date(2024, 6, 11, 0, 0, 0, 0, time.Local),
+		AccountType: BILL_ACCOUNT_TYPE_BASIC,
+		Gzip:        true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to download fund flow bill: %v", err)
+	}
+
+	if len(bill.Rows) != 1 || !bill.Rows[0].Balance.Equal(decimal.RequireFromString("100.01")) {
+		t.Errorf("unexpected rows: %+v", bill.Rows)
+	}
+	if bill.Summary.IncomeCount != 1 || !bill.Summary.IncomeAmount.Equal(decimal.RequireFromString("0.01")) {
+		t.Errorf("unexpected summary: %+v", bill.Summary)
+	}
+}
+
+func TestDownloadBillHashMismatch(t *testing.T) {
+	client := newBillTestClient(t, billHandler(t, BILL_TRADE_PATH, testTradeBill, false, sha1Hex("tampered")))
+	svc := BillApiService{Client: client}
+
+	_, err := svc.DownloadTradeBill(context.Background(), TradeBillRequest{
+		BillDate: time.Date(2024, 6, 11, 0, 0, 0, 0, time.Local),
+	})
+	if !errors.Is(err, ErrBillHashMismatch) {
+		t.Fatalf("got %v, want ErrBillHashMismatch", err)
+	}
+}
+
+func TestParseTradeBillInvalidAmount(t *testing.T) {
+	content := strings.Replace(testTradeBill, "`0.01,`0.00,`0,`0", "`abc,`0.00,`0,`0", 1)
+
+	if _, err := ParseTradeBill(bytes.NewReader([]byte(content))); err == nil {
+		t.Fatalf("expected error for invalid amount")
+	}
+}
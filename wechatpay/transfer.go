@@ -0,0 +1,385 @@
+package wechatpay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/wechatpay-apiv3/wechatpay-go/core"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/notify"
+	"github.com/wechatpay-apiv3/wechatpay-go/services/transferbatch"
+
+	"tests/money"
+)
+
+const (
+	// Batch status: ACCEPTED / PROCESSING / FINISHED / CLOSED
+	TRANSFER_BATCH_STATUS_ACCEPTED   = "ACCEPTED"
+	TRANSFER_BATCH_STATUS_PROCESSING = "PROCESSING"
+	TRANSFER_BATCH_STATUS_FINISHED   = "FINISHED"
+	TRANSFER_BATCH_STATUS_CLOSED     = "CLOSED"
+
+	// Detail status: INIT / WAIT_PAY / PROCESSING / SUCCESS / FAIL
+	TRANSFER_DETAIL_STATUS_INIT       = "INIT"
+	TRANSFER_DETAIL_STATUS_WAIT_PAY   = "WAIT_PAY"
+	TRANSFER_DETAIL_STATUS_PROCESSING = "PROCESSING"
+	TRANSFER_DETAIL_STATUS_SUCCESS    = "SUCCESS"
+	TRANSFER_DETAIL_STATUS_FAIL       = "FAIL"
+
+	EVENT_TYPE_TRANSFER_BATCH_FINISHED = "MCHTRANSFER.BATCH.FINISHED"
+	EVENT_TYPE_TRANSFER_BATCH_CLOSED   = "MCHTRANSFER.BATCH.CLOSED"
+
+	TRANSFER_MAX_DETAILS = 1000
+	TRANSFER_NO_MAX_LEN  = 32
+
+	// WeChat Pay requires the real name for a single transfer of 2000 yuan or more.
+	TRANSFER_USER_NAME_THRESHOLD = 2000
+)
+
+var (
+	ErrInvalidTransferAmount = errors.New("wechatpay: invalid transfer amount")
+
+	transferNoPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+)
+
+// TransferApiService pays users through the merchant transfer API. User
+// names are encrypted with the client's cipher, so the client must be built
+// with a platform certificate or WeChat Pay public key.
+type TransferApiService struct {
+	Client *core.Client
+}
+
+type TransferDetail struct {
+	OutDetailNo string
+	OpenID      string
+	Amount      decimal.Decimal
+	Remark      string
+	// UserName is optional below TRANSFER_USER_NAME_THRESHOLD yuan.
+	UserName string
+}
+
+type TransferRequest struct {
+	AppID           string
+	OutBatchNo      string
+	BatchName       string
+	BatchRemark     string
+	TransferSceneID string
+	NotifyURL       string
+	Details         []TransferDetail
+}
+
+type TransferBatch struct {
+	OutBatchNo    string
+	BatchID       string
+	BatchStatus   string
+	CloseReason   string
+	TotalAmount   decimal.Decimal
+	TotalNum      int64
+	SuccessAmount decimal.Decimal
+	SuccessNum    int64
+	FailAmount    decimal.Decimal
+	FailNum       int64
+	CreateTime    time.Time
+	UpdateTime    time.Time
+	Details       []TransferDetailStatus
+}
+
+type TransferDetailStatus struct {
+	OutDetailNo  string
+	DetailID     string
+	DetailStatus string
+	Amount       decimal.Decimal
+	OpenID       string
+	FailReason   string
+	UpdateTime   time.Time
+}
+
+// TransferBatchNotification is the decrypted resource of the
+// MCHTRANSFER.BATCH.* notifications.
+type TransferBatchNotification struct {
+	EventType     string          `json:"-"`
+	MchID         string          `json:"mchid"`
+	OutBatchNo    string          `json:"out_batch_no"`
+	BatchID       string          `json:"batch_id"`
+	BatchStatus   string          `json:"batch_status"`
+	CloseReason   string          `json:"close_reason"`
+	TotalNum      int64           `json:"total_num"`
+	TotalAmount   decimal.Decimal `json:"-"`
+	SuccessNum    int64           `json:"success_num"`
+	SuccessAmount decimal.Decimal `json:"-"`
+	FailNum       int64           `json:"fail_num"`
+	FailAmount    decimal.Decimal `json:"-"`
+	UpdateTime    time.Time       `json:"update_time"`
+
+	TotalAmountFen   int64 `json:"total_amount"`
+	SuccessAmountFen int64 `json:"success_amount"`
+	FailAmountFen    int64 `json:"fail_amount"`
+}
+
+// NewOutBatchNo derives an out_batch_no from a business key, so retrying the
+// same payout always reuses the same number and WeChat Pay deduplicates it.
+func NewOutBatchNo(prefix, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	no := prefix + strings.ToUpper(hex.EncodeToString(sum[:]))
+	return no[:TRANSFER_NO_MAX_LEN]
+}
+
+// YuanToFen converts a yuan amount to fen, rejecting negative amounts and
+// amounts with sub-fen precision.
+func YuanToFen(amount decimal.Decimal) (int64, error) {
+	a, err := money.New(amount, money.CNY)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidTransferAmount, err)
+	}
+
+	return a.WechatPay(), nil
+}
+
+// FenToYuan converts a fen amount to yuan.
+func FenToYuan(fen int64) decimal.Decimal {
+	return decimal.New(fen, -2)
+}
+
+// Transfer starts a batch transfer. When the batch already exists, for
+// example because a previous attempt timed out after WeChat Pay accepted
+// it, the existing batch is returned instead of an error.
+func (a *TransferApiService) Transfer(ctx context.Context, req TransferRequest) (*TransferBatch, error) {
+	input, err := buildTransferInput(req)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := transferbatch.TransferBatchApiService{Client: a.Client}
+	resp, _, err := svc.InitiateBatchTransfer(ctx, *input)
+	if err != nil {
+		var apiErr *core.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode >= http.StatusInternalServerError {
+			return nil, err
+		}
+
+		existing, queryErr := a.QueryBatch(ctx, req.OutBatchNo, false)
+		if queryErr != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+
+	batch := &TransferBatch{
+		OutBatchNo:  stringValue(resp.OutBatchNo),
+		BatchID:     stringValue(resp.BatchId),
+		BatchStatus: stringValue(resp.BatchStatus),
+		TotalAmount: FenToYuan(*input.TotalAmount),
+		TotalNum:    *input.TotalNum,
+	}
+	if resp.CreateTime != nil {
+		batch.CreateTime = *resp.CreateTime
+	}
+
+	return batch, nil
+}
+
+// TransferToUser pays a single user, using a one-detail batch.
+func (a *TransferApiService) TransferToUser(ctx context.Context, appID, outBatchNo, batchName string, detail TransferDetail) (*TransferBatch, error) {
+	return a.Transfer(ctx, TransferRequest{
+		AppID:       appID,
+		OutBatchNo:  outBatchNo,
+		BatchName:   batchName,
+		BatchRemark: detail.Remark,
+		Details:     []TransferDetail{detail},
+	})
+}
+
+// QueryBatch returns the status of a batch, with its details when needDetail is set.
+func (a *TransferApiService) QueryBatch(ctx context.Context, outBatchNo string, needDetail bool) (*TransferBatch, error) {
+	svc := transferbatch.TransferBatchApiService{Client: a.Client}
+
+	resp, _, err := svc.GetTransferBatchByOutNo(ctx, transferbatch.GetTransferBatchByOutNoRequest{
+		OutBatchNo:      core.String(outBatchNo),
+		NeedQueryDetail: core.Bool(needDetail),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.TransferBatch == nil {
+		return nil, fmt.Errorf("wechatpay: transfer batch %s missing in response", outBatchNo)
+	}
+
+	b := resp.TransferBatch
+	batch := &TransferBatch{
+		OutBatchNo:    stringValue(b.OutBatchNo),
+		BatchID:       stringValue(b.BatchId),
+		BatchStatus:   stringValue(b.BatchStatus),
+		TotalAmount:   FenToYuan(int64Value(b.TotalAmount)),
+		TotalNum:      int64Value(b.TotalNum),
+		SuccessAmount: FenToYuan(int64Value(b.SuccessAmount)),
+		SuccessNum:    int64Value(b.SuccessNum),
+		FailAmount:    FenToYuan(int64Value(b.FailAmount)),
+		FailNum:       int64Value(b.FailNum),
+	}
+	if b.CloseReason != nil {
+		batch.CloseReason = string(*b.CloseReason)
+	}
+	if b.CreateTime != nil {
+		batch.CreateTime = *b.CreateTime
+	}
+	if b.UpdateTime != nil {
+		batch.UpdateTime = *b.UpdateTime
+	}
+
+	for _, d := range resp.TransferDetailList {
+		batch.Details = append(batch.Details, TransferDetailStatus{
+			OutDetailNo:  stringValue(d.OutDetailNo),
+			DetailID:     stringValue(d.DetailId),
+			DetailStatus: stringValue(d.DetailStatus),
+		})
+	}
+
+	return batch, nil
+}
+
+// QueryDetail returns the status of a single transfer detail.
+func (a *TransferApiService) QueryDetail(ctx context.Context, outBatchNo, outDetailNo string) (*TransferDetailStatus, error) {
+	svc := transferbatch.TransferDetailApiService{Client: a.Client}
+
+	resp, _, err := svc.GetTransferDetailByOutNo(ctx, transferbatch.GetTransferDetailByOutNoRequest{
+		OutBatchNo:  core.String(outBatchNo),
+		OutDetailNo: core.String(outDetailNo),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &TransferDetailStatus{
+		OutDetailNo:  stringValue(resp.OutDetailNo),
+		DetailID:     stringValue(resp.DetailId),
+		DetailStatus: stringValue(resp.DetailStatus),
+		Amount:       FenToYuan(int64Value(resp.TransferAmount)),
+		OpenID:       stringValue(resp.Openid),
+	}
+	if resp.FailReason != nil {
+		detail.FailReason = string(*resp.FailReason)
+	}
+	if resp.UpdateTime != nil {
+		detail.UpdateTime = *resp.UpdateTime
+	}
+
+	return detail, nil
+}
+
+// ParseTransferNotification verifies and decrypts a MCHTRANSFER.BATCH.*
+// notification.
+func ParseTransferNotification(ctx context.Context, handler *notify.Handler, r *http.Request) (*TransferBatchNotification, error) {
+	n := new(TransferBatchNotification)
+
+	req, err := handler.ParseNotifyRequest(ctx, r, n)
+	if err != nil {
+		return nil, err
+	}
+
+	n.EventType = req.EventType
+	n.TotalAmount = FenToYuan(n.TotalAmountFen)
+	n.SuccessAmount = FenToYuan(n.SuccessAmountFen)
+	n.FailAmount = FenToYuan(n.FailAmountFen)
+
+	return n, nil
+}
+
+func buildTransferInput(req TransferRequest) (*transferbatch.InitiateBatchTransferRequest, error) {
+	if err := validateTransferNo("out_batch_no", req.OutBatchNo); err != nil {
+		return nil, err
+	}
+	if len(req.Details) == 0 || len(req.Details) > TRANSFER_MAX_DETAILS {
+		return nil, fmt.Errorf("wechatpay: transfer needs 1 to %d details, got %d", TRANSFER_MAX_DETAILS, len(req.Details))
+	}
+
+	var (
+		total     int64
+		seen      = make(map[string]struct{}, len(req.Details))
+		details   = make([]transferbatch.TransferDetailInput, 0, len(req.Details))
+		threshold = decimal.NewFromInt(TRANSFER_USER_NAME_THRESHOLD)
+	)
+
+	for _, d := range req.Details {
+		if err := validateTransferNo("out_detail_no", d.OutDetailNo); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[d.OutDetailNo]; ok {
+			return nil, fmt.Errorf("wechatpay: duplicate out_detail_no %s", d.OutDetailNo)
+		}
+		seen[d.OutDetailNo] = struct{}{}
+
+		if d.OpenID == "" {
+			return nil, fmt.Errorf("wechatpay: transfer detail %s has no openid", d.OutDetailNo)
+		}
+
+		fen, err := YuanToFen(d.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("transfer detail %s: %w", d.OutDetailNo, err)
+		}
+		if fen == 0 {
+			return nil, fmt.Errorf("%w: transfer detail %s is zero", ErrInvalidTransferAmount, d.OutDetailNo)
+		}
+		if d.UserName == "" && d.Amount.GreaterThanOrEqual(threshold) {
+			return nil, fmt.Errorf("wechatpay: transfer detail %s of %s yuan needs user_name", d.OutDetailNo, d.Amount)
+		}
+
+		total += fen
+
+		input := transferbatch.TransferDetailInput{
+			OutDetailNo:    core.String(d.OutDetailNo),
+			TransferAmount: core.Int64(fen),
+			TransferRemark: core.String(d.Remark),
+			Openid:         core.String(d.OpenID),
+		}
+		if d.UserName != "" {
+			input.UserName = core.String(d.UserName)
+		}
+		details = append(details, input)
+	}
+
+	input := &transferbatch.InitiateBatchTransferRequest{
+		Appid:              core.String(req.AppID),
+		OutBatchNo:         core.String(req.OutBatchNo),
+		BatchName:          core.String(req.BatchName),
+		BatchRemark:        core.String(req.BatchRemark),
+		TotalAmount:        core.Int64(total),
+		TotalNum:           core.Int64(int64(len(details))),
+		TransferDetailList: details,
+	}
+	if req.TransferSceneID != "" {
+		input.TransferSceneId = core.String(req.TransferSceneID)
+	}
+	if req.NotifyURL != "" {
+		input.NotifyUrl = core.String(req.NotifyURL)
+	}
+
+	return input, nil
+}
+
+func validateTransferNo(field, no string) error {
+	if no == "" || len(no) > TRANSFER_NO_MAX_LEN || !transferNoPattern.MatchString(no) {
+		return fmt.Errorf("wechatpay: invalid %s %q", field, no)
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func int64Value(i *int64) int64 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
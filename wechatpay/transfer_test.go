@@ -0,0 +1,151 @@
+package wechatpay_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/wechatpay-apiv3/wechatpay-go/core"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/auth/verifiers"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/notify"
+
+	"tests/wechatpay"
+	"tests/wechatpay/wechatpaytest"
+)
+
+func TestTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	server, err := wechatpaytest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start mock server: %v", err)
+	}
+	defer server.Close()
+
+	opts, err := server.ClientOptions(ctx)
+	if err != nil {
+		t.Fatalf("Failed to build client options: %v", err)
+	}
+	client, err := core.NewClient(ctx, opts...)
+	if err != nil {
+		t.Fatalf("Failed to new wechat pay client: %v", err)
+	}
+
+	handler := notify.NewNotifyHandler(server.APIv3Key, verifiers.NewSHA256WithRSAVerifier(
+		core.NewCertificateMapWithList([]*x509.Certificate{server.PlatformCert}),
+	))
+	notifications := make(chan *wechatpay.TransferBatchNotification, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := wechatpay.ParseTransferNotification(r.Context(), handler, r)
+		if err != nil {
+			t.Errorf("Failed to parse transfer notification: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		notifications <- n
+	}))
+	defer callback.Close()
+
+	outBatchNo := wechatpay.NewOutBatchNo("CB", "cashback:2024-06-11:user-1")
+	if outBatchNo != wechatpay.NewOutBatchNo("CB", "cashback:2024-06-11:user-1") {
+		t.Fatalf("out_batch_no is not deterministic")
+	}
+
+	req := wechatpay.TransferRequest{
+		AppID:       server.AppID,
+		OutBatchNo:  outBatchNo,
+		BatchName:   "cashback",
+		BatchRemark: "cashback",
+		NotifyURL:   callback.URL,
+		Details: []wechatpay.TransferDetail{
+			{OutDetailNo: "D001", OpenID: "o-user-1", Amount: decimal.RequireFromString("1.10"), Remark: "cashback"},
+			{OutDetailNo: "D002", OpenID: "o-user-2", Amount: decimal.RequireFromString("2000"), Remark: "withdraw", UserName: "张三"},
+		},
+	}
+
+	svc := wechatpay.TransferApiService{Client: client}
+	batch, err := svc.Transfer(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to transfer: %v", err)
+	}
+	if !batch.TotalAmount.Equal(decimal.RequireFromString("2001.10")) || batch.TotalNum != 2 {
+		t.Errorf("unexpected batch totals: %+v", batch)
+	}
+
+	if name, _ := server.TransferUserName(outBatchNo, "D002"); name != "张三" {
+		t.Errorf("got decrypted user_name %q, want 张三", name)
+	}
+
+	retried, err := svc.Transfer(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to retry transfer: %v", err)
+	}
+	if retried.BatchID != batch.BatchID {
+		t.Errorf("retry created batch %s, want %s", retried.BatchID, batch.BatchID)
+	}
+
+	if err := server.FinishTransferBatch(ctx, outBatchNo, "D002"); err != nil {
+		t.Fatalf("Failed to finish transfer batch: %v", err)
+	}
+
+	n := <-notifications
+	if n.EventType != wechatpay.EVENT_TYPE_TRANSFER_BATCH_FINISHED || !n.FailAmount.Equal(decimal.NewFromInt(2000)) {
+		t.Errorf("unexpected notification: %+v", n)
+	}
+
+	detail, err := svc.QueryDetail(ctx, outBatchNo, "D001")
+	if err != nil {
+		t.Fatalf("Failed to query transfer detail: %v", err)
+	}
+	if detail.DetailStatus != wechatpay.TRANSFER_DETAIL_STATUS_SUCCESS || !detail.Amount.Equal(decimal.RequireFromString("1.1")) {
+		t.Errorf("unexpected detail: %+v", detail)
+	}
+
+	queried, err := svc.QueryBatch(ctx, outBatchNo, true)
+	if err != nil {
+		t.Fatalf("Failed to query transfer batch: %v", err)
+	}
+	if queried.BatchStatus != wechatpay.TRANSFER_BATCH_STATUS_FINISHED || len(queried.Details) != 2 {
+		t.Errorf("unexpected batch: %+v", queried)
+	}
+}
+
+func TestTransferValidation(t *testing.T) {
+	svc := wechatpay.TransferApiService{}
+
+	testCases := []struct {
+		name   string
+		amount string
+		user   string
+	}{
+		{"Sub-fen amount", "0.001", ""},
+		{"Negative amount", "-1", ""},
+		{"Zero amount", "0", ""},
+		{"Large amount without user name", "2000.00", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.Transfer(context.Background(), wechatpay.TransferRequest{
+				OutBatchNo: "B001",
+				Details: []wechatpay.TransferDetail{
+					{OutDetailNo: "D001", OpenID: "o-user", Amount: decimal.RequireFromString(tc.amount), UserName: tc.user},
+				},
+			})
+			if err == nil {
+				t.Fatalf("expected error for amount %s", tc.amount)
+			}
+		})
+	}
+
+	if _, err := wechatpay.YuanToFen(decimal.RequireFromString("0.015")); !errors.Is(err, wechatpay.ErrInvalidTransferAmount) {
+		t.Errorf("got %v, want ErrInvalidTransferAmount", err)
+	}
+	if fen, _ := wechatpay.YuanToFen(decimal.RequireFromString("12.30")); fen != 1230 {
+		t.Errorf("got %d fen, want 1230", fen)
+	}
+}
@@ -0,0 +1,513 @@
+package wechatpay
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wechatpay-apiv3/wechatpay-go/core"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/auth/validators"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/consts"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/option"
+	"github.com/wechatpay-apiv3/wechatpay-go/utils"
+)
+
+const (
+	CERTIFICATES_PATH = "/v3/certificates"
+
+	// Serials of the WeChat Pay public keys start with this prefix, platform
+	// certificate serials are upper-case hex.
+	PUBLIC_KEY_ID_PREFIX = "PUB_KEY_ID_"
+
+	DEFAULT_REFRESH_INTERVAL     = 12 * time.Hour
+	DEFAULT_MIN_REFRESH_INTERVAL = time.Minute
+
+	// UNKNOWN_SERIAL_MAX_LABELS caps the serials UnknownSerials keeps apart;
+	// the serial comes from unauthenticated callbacks, so the rest are
+	// counted under UNKNOWN_SERIAL_OTHER.
+	UNKNOWN_SERIAL_MAX_LABELS = 64
+	UNKNOWN_SERIAL_OTHER      = "other"
+)
+
+var (
+	ErrUnknownSerial = errors.New("wechatpay: unknown verifier serial")
+
+	// UnknownSerials counts signatures received with a serial the store does
+	// not know, keyed by serial for the first UNKNOWN_SERIAL_MAX_LABELS
+	// serials. It is published through expvar.
+	UnknownSerials = expvar.NewMap("wechatpay_verifier_unknown_serial_total")
+
+	unknownSerialsMu     sync.Mutex
+	unknownSerialsLabels int
+)
+
+func countUnknownSerial(serial string) {
+	unknownSerialsMu.Lock()
+	defer unknownSerialsMu.Unlock()
+
+	if UnknownSerials.Get(serial) == nil {
+		if unknownSerialsLabels >= UNKNOWN_SERIAL_MAX_LABELS {
+			serial = UNKNOWN_SERIAL_OTHER
+		} else {
+			unknownSerialsLabels++
+		}
+	}
+	UnknownSerials.Add(serial, 1)
+}
+
+// CertificateSource fetches the current platform certificates keyed by serial.
+type CertificateSource func(ctx context.Context) (map[string]*x509.Certificate, error)
+
+// VerifierStore holds the platform certificates and WeChat Pay public keys
+// keyed by serial. It implements auth.Verifier, core.CertificateGetter and
+// cipher.Encryptor, so it can back response validation, callback
+// verification and sensitive-field encryption at the same time.
+type VerifierStore struct {
+	// Path, when set, is the JSON file the store is loaded from and saved to.
+	Path string
+	// Source refreshes the platform certificates. Nil disables refreshing.
+	Source CertificateSource
+	// MinRefreshInterval rate-limits refreshes triggered by unknown serials.
+	MinRefreshInterval time.Duration
+	// OnUnknownSerial is called in addition to the UnknownSerials metric.
+	OnUnknownSerial func(serial string)
+
+	mu           sync.RWMutex
+	certificates map[string]*x509.Certificate
+	publicKeys   map[string]*rsa.PublicKey
+	publicKeyID  string
+	// lastRefresh is when a refresh last succeeded or, for refreshes
+	// triggered by unknown serials, was last attempted.
+	lastRefresh time.Time
+	refreshMu   sync.Mutex
+}
+
+type verifierStoreFile struct {
+	Certificates map[string]string `json:"certificates"`
+	PublicKeys   map[string]string `json:"public_keys"`
+	PublicKeyID  string            `json:"public_key_id,omitempty"`
+}
+
+// NewVerifierStore returns a store persisted at path. An existing file is
+// loaded; a missing one is not an error. Pass an empty path to keep the
+// store in memory only.
+func NewVerifierStore(path string, source CertificateSource) (*VerifierStore, error) {
+	s := &VerifierStore{
+		Path:               path,
+		Source:             source,
+		MinRefreshInterval: DEFAULT_MIN_REFRESH_INTERVAL,
+		certificates:       map[string]*x509.Certificate{},
+		publicKeys:         map[string]*rsa.PublicKey{},
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	if err := s.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// AddCertificate adds a platform certificate under its own serial.
+func (s *VerifierStore) AddCertificate(cert *x509.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.certificates[utils.GetCertificateSerialNumber(*cert)] = cert
+}
+
+// AddPublicKey adds a WeChat Pay public key. The most recently added key is
+// preferred for encryption and advertised through GetSerial.
+func (s *VerifierStore) AddPublicKey(id string, key *rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.publicKeys[id] = key
+	s.publicKeyID = id
+}
+
+// Verify checks a SHA256-RSA signature against the key or certificate with
+// the given serial. An unknown serial is counted and triggers a refresh
+// before giving up.
+func (s *VerifierStore) Verify(ctx context.Context, serial, message, signature string) error {
+	key, ok := s.lookup(ctx, serial)
+	if !ok {
+		countUnknownSerial(serial)
+		if s.OnUnknownSerial != nil {
+			s.OnUnknownSerial(serial)
+		}
+
+		if s.Source != nil {
+			if err := s.refreshThrottled(ctx); err != nil {
+				return fmt.Errorf("%w %s: refresh: %v", ErrUnknownSerial, serial, err)
+			}
+			key, ok = s.lookup(ctx, serial)
+		}
+		if !ok {
+			return fmt.Errorf("%w %s", ErrUnknownSerial, serial)
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("wechatpay: signature is not base64 encoded: %w", err)
+	}
+
+	hashed := sha256.Sum256([]byte(message))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+		return fmt.Errorf("wechatpay: verify signature with serial %s: %w", serial, err)
+	}
+
+	return nil
+}
+
+// GetSerial returns the serial advertised to WeChat Pay in Wechatpay-Serial.
+func (s *VerifierStore) GetSerial(ctx context.Context) (string, error) {
+	serial, _ := s.SelectCertificate(ctx)
+	if serial == "" {
+		return "", errors.New("wechatpay: verifier store is empty")
+	}
+	return serial, nil
+}
+
+// Get implements core.CertificateGetter.
+func (s *VerifierStore) Get(_ context.Context, serial string) (*x509.Certificate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cert, ok := s.certificates[serial]
+	return cert, ok
+}
+
+// GetAll implements core.CertificateGetter.
+func (s *VerifierStore) GetAll(_ context.Context) map[string]*x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m := make(map[string]*x509.Certificate, len(s.certificates))
+	for serial, cert := range s.certificates {
+		m[serial] = cert
+	}
+	return m
+}
+
+// GetNewestSerial implements core.CertificateGetter. The newest certificate
+// is the valid one that expires last.
+func (s *VerifierStore) GetNewestSerial(_ context.Context) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		newest string
+		expire time.Time
+		now    = time.Now()
+	)
+	for serial, cert := range s.certificates {
+		if !utils.IsCertValid(*cert, now) {
+			continue
+		}
+		if cert.NotAfter.After(expire) {
+			newest, expire = serial, cert.NotAfter
+		}
+	}
+	return newest
+}
+
+// SelectCertificate implements cipher.Encryptor. The public key wins over
+// platform certificates once one is configured.
+func (s *VerifierStore) SelectCertificate(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	publicKeyID := s.publicKeyID
+	s.mu.RUnlock()
+
+	if publicKeyID != "" {
+		return publicKeyID, nil
+	}
+
+	serial := s.GetNewestSerial(ctx)
+	if serial == "" {
+		return "", errors.New("wechatpay: no valid platform certificate")
+	}
+	return serial, nil
+}
+
+// Encrypt implements cipher.Encryptor with RSA-OAEP.
+func (s *VerifierStore) Encrypt(ctx context.Context, serial, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	key, ok := s.lookup(ctx, serial)
+	if !ok {
+		return "", fmt.Errorf("%w %s", ErrUnknownSerial, serial)
+	}
+
+	return utils.EncryptOAEPWithPublicKey(plaintext, key)
+}
+
+// ClientOption makes a core.Client validate responses against the store.
+func (s *VerifierStore) ClientOption() core.ClientOption {
+	return option.WithVerifier(s)
+}
+
+// Refresh merges the platform certificates from Source into the store, drops
+// expired ones and persists the result. Public keys are left untouched.
+func (s *VerifierStore) Refresh(ctx context.Context) error {
+	if s.Source == nil {
+		return errors.New("wechatpay: verifier store has no certificate source")
+	}
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	certificates, err := s.Source(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for serial, cert := range certificates {
+		s.certificates[serial] = cert
+	}
+	// Drop expired certificates, WeChat Pay overlaps the old and new ones
+	// during a rotation so the old one is only needed until it expires.
+	now := time.Now()
+	for serial, cert := range s.certificates {
+		if utils.IsCertExpired(*cert, now) {
+			delete(s.certificates, serial)
+		}
+	}
+	s.lastRefresh = now
+	s.mu.Unlock()
+
+	return s.Save()
+}
+
+// Start refreshes the store every interval until ctx is done. Refresh errors
+// are passed to onError, which may be nil.
+func (s *VerifierStore) Start(ctx context.Context, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = DEFAULT_REFRESH_INTERVAL
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Refresh(ctx); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Save writes the store to Path atomically. It is a no-op without a Path.
+func (s *VerifierStore) Save() error {
+	if s.Path == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	file := verifierStoreFile{
+		Certificates: make(map[string]string, len(s.certificates)),
+		PublicKeys:   make(map[string]string, len(s.publicKeys)),
+		PublicKeyID:  s.publicKeyID,
+	}
+	for serial, cert := range s.certificates {
+		file.Certificates[serial] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+	for id, key := range s.publicKeys {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			s.mu.RUnlock()
+			return fmt.Errorf("wechatpay: marshal public key %s: %w", id, err)
+		}
+		file.PublicKeys[id] = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	s.mu.RUnlock()
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+func (s *VerifierStore) load() error {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+
+	var file verifierStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("wechatpay: decode verifier store %s: %w", s.Path, err)
+	}
+
+	for serial, content := range file.Certificates {
+		cert, err := utils.LoadCertificate(content)
+		if err != nil {
+			return fmt.Errorf("wechatpay: load certificate %s: %w", serial, err)
+		}
+		s.certificates[serial] = cert
+	}
+	for id, content := range file.PublicKeys {
+		key, err := utils.LoadPublicKey(content)
+		if err != nil {
+			return fmt.Errorf("wechatpay: load public key %s: %w", id, err)
+		}
+		s.publicKeys[id] = key
+	}
+	s.publicKeyID = file.PublicKeyID
+
+	return nil
+}
+
+func (s *VerifierStore) lookup(_ context.Context, serial string) (*rsa.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if strings.HasPrefix(serial, PUBLIC_KEY_ID_PREFIX) {
+		key, ok := s.publicKeys[serial]
+		return key, ok
+	}
+
+	cert, ok := s.certificates[serial]
+	if !ok {
+		return nil, false
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	return key, ok
+}
+
+// refreshThrottled claims the refresh slot before refreshing, so that failed
+// attempts count toward MinRefreshInterval too and concurrent callers with
+// unknown serials trigger a single refresh between them.
+func (s *VerifierStore) refreshThrottled(ctx context.Context) error {
+	s.mu.Lock()
+	if time.Since(s.lastRefresh) < s.MinRefreshInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastRefresh = time.Now()
+	s.mu.Unlock()
+
+	return s.Refresh(ctx)
+}
+
+// NewCertificateSource downloads platform certificates from /v3/certificates
+// with client and decrypts them with the API v3 key. The response is
+// verified against the downloaded certificates themselves.
+func NewCertificateSource(client *core.Client, apiV3Key string) CertificateSource {
+	client = core.NewClientWithValidator(client, &validators.NullValidator{})
+
+	return func(ctx context.Context) (map[string]*x509.Certificate, error) {
+		result, err := client.Get(ctx, consts.WechatPayAPIServer+CERTIFICATES_PATH)
+		if err != nil {
+			return nil, fmt.Errorf("wechatpay: download certificates: %w", err)
+		}
+		defer result.Response.Body.Close()
+
+		body, err := io.ReadAll(result.Response.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp struct {
+			Data []struct {
+				SerialNo           string `json:"serial_no"`
+				EncryptCertificate struct {
+					Nonce          string `json:"nonce"`
+					AssociatedData string `json:"associated_data"`
+					Ciphertext     string `json:"ciphertext"`
+				} `json:"encrypt_certificate"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("wechatpay: decode certificates: %w", err)
+		}
+
+		certificates := make(map[string]*x509.Certificate, len(resp.Data))
+		for _, item := range resp.Data {
+			content, err := utils.DecryptAES256GCM(apiV3Key, item.EncryptCertificate.AssociatedData,
+				item.EncryptCertificate.Nonce, item.EncryptCertificate.Ciphertext)
+			if err != nil {
+				return nil, fmt.Errorf("wechatpay: decrypt certificate %s: %w", item.SerialNo, err)
+			}
+
+			cert, err := utils.LoadCertificate(content)
+			if err != nil {
+				return nil, fmt.Errorf("wechatpay: parse certificate %s: %w", item.SerialNo, err)
+			}
+			certificates[item.SerialNo] = cert
+		}
+
+		if len(certificates) == 0 {
+			return nil, errors.New("wechatpay: no certificate downloaded")
+		}
+
+		header := result.Response.Header
+		cert, ok := certificates[header.Get(consts.WechatPaySerial)]
+		if !ok {
+			return nil, fmt.Errorf("%w %s in certificates response", ErrUnknownSerial, header.Get(consts.WechatPaySerial))
+		}
+
+		message := fmt.Sprintf("%s\n%s\n%s\n", header.Get(consts.WechatPayTimestamp), header.Get(consts.WechatPayNonce), body)
+		sig, err := base64.StdEncoding.DecodeString(header.Get(consts.WechatPaySignature))
+		if err != nil {
+			return nil, fmt.Errorf("wechatpay: certificates response signature: %w", err)
+		}
+		hashed := sha256.Sum256([]byte(message))
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("wechatpay: certificates response signed by non-RSA certificate %s", header.Get(consts.WechatPaySerial))
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+			return nil, fmt.Errorf("wechatpay: verify certificates response: %w", err)
+		}
+
+		return certificates, nil
+	}
+}
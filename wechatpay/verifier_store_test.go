@@ -0,0 +1,227 @@
+package wechatpay_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wechatpay-apiv3/wechatpay-go/core"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/notify"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/option"
+	"github.com/wechatpay-apiv3/wechatpay-go/services/payments"
+	"github.com/wechatpay-apiv3/wechatpay-go/services/payments/native"
+
+	"tests/wechatpay"
+	"tests/wechatpay/wechatpaytest"
+)
+
+func newStoreTestClient(t *testing.T, server *wechatpaytest.Server, store *wechatpay.VerifierStore) *core.Client {
+	t.Helper()
+
+	client, err := core.NewClient(context.Background(),
+		option.WithMerchantCredential(server.MchID, server.MerchantSerialNo, server.MerchantKey),
+		store.ClientOption(),
+		option.WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to new wechat pay client: %v", err)
+	}
+	return client
+}
+
+func newCertificateSource(t *testing.T, server *wechatpaytest.Server) wechatpay.CertificateSource {
+	t.Helper()
+
+	client, err := core.NewClient(context.Background(),
+		option.WithMerchantCredential(server.MchID, server.MerchantSerialNo, server.MerchantKey),
+		option.WithoutValidator(),
+		option.WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to new wechat pay client: %v", err)
+	}
+	return wechatpay.NewCertificateSource(client, server.APIv3Key)
+}
+
+func prepay(ctx context.Context, client *core.Client, server *wechatpaytest.Server, outTradeNo string) error {
+	svc := native.NativeApiService{Client: client}
+	_, _, err := svc.Prepay(ctx, native.PrepayRequest{
+		Appid:       core.String(server.AppID),
+		Mchid:       core.String(server.MchID),
+		Description: core.String("TEST"),
+		OutTradeNo:  core.String(outTradeNo),
+		NotifyUrl:   core.String("https://example.com/notify"),
+		Amount:      &native.Amount{Total: core.Int64(1)},
+	})
+	return err
+}
+
+func TestVerifierStoreRotation(t *testing.T) {
+	ctx := context.Background()
+
+	server, err := wechatpaytest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start mock server: %v", err)
+	}
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "verifiers.json")
+	store, err := wechatpay.NewVerifierStore(path, newCertificateSource(t, server))
+	if err != nil {
+		t.Fatalf("Failed to create verifier store: %v", err)
+	}
+	store.MinRefreshInterval = 0
+
+	var unknown []string
+	store.OnUnknownSerial = func(serial string) { unknown = append(unknown, serial) }
+
+	if err := store.Refresh(ctx); err != nil {
+		t.Fatalf("Failed to refresh verifier store: %v", err)
+	}
+
+	client := newStoreTestClient(t, server, store)
+	if err := prepay(ctx, client, server, "001"); err != nil {
+		t.Fatalf("Failed to prepay before rotation: %v", err)
+	}
+
+	if err := server.RotatePlatformCertificate(); err != nil {
+		t.Fatalf("Failed to rotate platform certificate: %v", err)
+	}
+
+	if err := prepay(ctx, client, server, "002"); err != nil {
+		t.Fatalf("Failed to prepay after rotation: %v", err)
+	}
+
+	if len(unknown) != 1 || unknown[0] != server.PlatformSerialNo {
+		t.Errorf("got unknown serials %v, want [%s]", unknown, server.PlatformSerialNo)
+	}
+	if got := wechatpay.UnknownSerials.Get(server.PlatformSerialNo); got == nil || got.String() != "1" {
+		t.Errorf("got unknown serial metric %v, want 1", got)
+	}
+	if serial, _ := store.GetSerial(ctx); serial != server.PlatformSerialNo {
+		t.Errorf("got serial %s, want newest %s", serial, server.PlatformSerialNo)
+	}
+
+	reloaded, err := wechatpay.NewVerifierStore(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to reload verifier store: %v", err)
+	}
+	if got := len(reloaded.GetAll(ctx)); got != 2 {
+		t.Errorf("got %d persisted certificates, want 2", got)
+	}
+}
+
+func TestVerifierStorePublicKeyCallback(t *testing.T) {
+	const PUBLIC_KEY_ID = "PUB_KEY_ID_0119000000012024061100000000000001"
+
+	ctx := context.Background()
+
+	server, err := wechatpaytest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start mock server: %v", err)
+	}
+	defer server.Close()
+	server.PublicKeyID = PUBLIC_KEY_ID
+
+	store, err := wechatpay.NewVerifierStore("", nil)
+	if err != nil {
+		t.Fatalf("Failed to create verifier store: %v", err)
+	}
+	store.AddPublicKey(PUBLIC_KEY_ID, &server.PlatformKey.PublicKey)
+
+	handler := notify.NewNotifyHandler(server.APIv3Key, store)
+	received := make(chan error, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := handler.ParseNotifyRequest(r.Context(), r, new(payments.Transaction))
+		received <- err
+	}))
+	defer callback.Close()
+
+	err = server.Notify(ctx, callback.URL, wechatpaytest.EVENT_TYPE_TRANSACTION_SUCCESS, "transaction", map[string]string{
+		"out_trade_no": "001",
+		"trade_state":  wechatpaytest.TRADE_STATE_SUCCESS,
+	})
+	if err != nil {
+		t.Fatalf("Failed to send notification: %v", err)
+	}
+	if err := <-received; err != nil {
+		t.Fatalf("Failed to verify notification: %v", err)
+	}
+
+	if serial, _ := store.GetSerial(ctx); serial != PUBLIC_KEY_ID {
+		t.Errorf("got serial %s, want %s", serial, PUBLIC_KEY_ID)
+	}
+
+	err = store.Verify(ctx, "PUB_KEY_ID_UNKNOWN", "message", "c2lnbmF0dXJl")
+	if !errors.Is(err, wechatpay.ErrUnknownSerial) {
+		t.Errorf("got %v, want ErrUnknownSerial", err)
+	}
+}
+
+func TestVerifierStoreUnknownSerialLabels(t *testing.T) {
+	ctx := context.Background()
+	store, err := wechatpay.NewVerifierStore("", nil)
+	if err != nil {
+		t.Fatalf("Failed to create verifier store: %v", err)
+	}
+
+	for i := range 2 * wechatpay.UNKNOWN_SERIAL_MAX_LABELS {
+		serial := fmt.Sprintf("FORGED_SERIAL_%d", i)
+		if err := store.Verify(ctx, serial, "message", "c2lnbmF0dXJl"); !errors.Is(err, wechatpay.ErrUnknownSerial) {
+			t.Fatalf("got %v, want ErrUnknownSerial", err)
+		}
+	}
+
+	labels := 0
+	wechatpay.UnknownSerials.Do(func(kv expvar.KeyValue) {
+		if kv.Key != wechatpay.UNKNOWN_SERIAL_OTHER {
+			labels++
+		}
+	})
+	if labels > wechatpay.UNKNOWN_SERIAL_MAX_LABELS {
+		t.Errorf("got %d serial labels, want at most %d", labels, wechatpay.UNKNOWN_SERIAL_MAX_LABELS)
+	}
+	if got := wechatpay.UnknownSerials.Get(wechatpay.UNKNOWN_SERIAL_OTHER); got == nil || got.String() == "0" {
+		t.Errorf("got %v under %q, want the overflow counted", got, wechatpay.UNKNOWN_SERIAL_OTHER)
+	}
+}
+
+func TestVerifierStoreRefreshThrottled(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	source := func(context.Context) (map[string]*x509.Certificate, error) {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return nil, errors.New("certificates unavailable")
+	}
+	store, err := wechatpay.NewVerifierStore("", source)
+	if err != nil {
+		t.Fatalf("Failed to create verifier store: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Verify(ctx, "UNKNOWN_SERIAL", "message", "c2lnbmF0dXJl")
+		}()
+	}
+	wg.Wait()
+
+	// The failed refresh still counts toward MinRefreshInterval.
+	store.Verify(ctx, "UNKNOWN_SERIAL", "message", "c2lnbmF0dXJl")
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got %d certificate downloads, want 1", got)
+	}
+}
@@ -0,0 +1,671 @@
+// Package wechatpaytest provides an in-process mock of the WeChat Pay v3
+// endpoints, so prepay, query, refund and callback flows can be tested
+// without merchant credentials or network access.
+package wechatpaytest
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wechatpay-apiv3/wechatpay-go/core"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/downloader"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/option"
+	"github.com/wechatpay-apiv3/wechatpay-go/utils"
+)
+
+const (
+	AUTHORIZATION_SCHEMA = "WECHATPAY2-SHA256-RSA2048"
+	AEAD_ALGORITHM       = "AEAD_AES_256_GCM"
+
+	API_HOST        = "api.mch.weixin.qq.com"
+	API_BACKUP_HOST = "api2.mch.weixin.qq.com"
+
+	EVENT_TYPE_TRANSACTION_SUCCESS     = "TRANSACTION.SUCCESS"
+	EVENT_TYPE_REFUND_SUCCESS          = "REFUND.SUCCESS"
+	EVENT_TYPE_TRANSFER_BATCH_FINISHED = "MCHTRANSFER.BATCH.FINISHED"
+
+	TRADE_STATE_NOTPAY  = "NOTPAY"
+	TRADE_STATE_SUCCESS = "SUCCESS"
+	TRADE_STATE_REFUND  = "REFUND"
+)
+
+// Server is a mock WeChat Pay v3 API. Requests must carry a valid
+// WECHATPAY2-SHA256-RSA2048 Authorization header made with MerchantKey, and
+// every response is signed with the generated platform certificate.
+type Server struct {
+	*httptest.Server
+
+	MchID            string
+	AppID            string
+	MerchantSerialNo string
+	MerchantKey      *rsa.PrivateKey
+	APIv3Key         string
+
+	PlatformSerialNo string
+	PlatformKey      *rsa.PrivateKey
+	PlatformCert     *x509.Certificate
+
+	// PublicKeyID, when set, switches the server to the WeChat Pay public key
+	// mode: responses carry it as Wechatpay-Serial and are signed with
+	// PlatformKey, whose public half plays the WeChat Pay public key.
+	PublicKeyID string
+
+	// NotifyClient sends callbacks fired by Notify, Pay and Refund.
+	NotifyClient *http.Client
+
+	notifications sync.WaitGroup
+
+	mu           sync.Mutex
+	retired      []*x509.Certificate
+	transactions map[string]*transaction
+	refunds      map[string]map[string]any
+	batches      map[string]*transferBatch
+	sequence     int
+}
+
+type transaction struct {
+	AppID         string `json:"appid"`
+	MchID         string `json:"mchid"`
+	Description   string `json:"description"`
+	OutTradeNo    string `json:"out_trade_no"`
+	TransactionID string `json:"transaction_id"`
+	TradeType     string `json:"trade_type"`
+	TradeState    string `json:"trade_state"`
+	NotifyURL     string `json:"notify_url"`
+	Attach        string `json:"attach,omitempty"`
+	SuccessTime   string `json:"success_time,omitempty"`
+	Amount        struct {
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	} `json:"amount"`
+}
+
+// NewServer starts a mock server with a freshly generated merchant key,
+// platform certificate and API v3 key.
+func NewServer() (*Server, error) {
+	merchantKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("wechatpaytest: generate merchant key: %w", err)
+	}
+
+	platformKey, platformCert, err := NewPlatformCertificate(time.Now().AddDate(5, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		MchID:            "1900000001",
+		AppID:            "wxd678efh567hg6787",
+		MerchantSerialNo: "5157F09EFDC096DE15EBE81A47057A7232F1B8E1",
+		MerchantKey:      merchantKey,
+		APIv3Key:         "0123456789abcdef0123456789abcdef",
+		PlatformSerialNo: utils.GetCertificateSerialNumber(*platformCert),
+		PlatformKey:      platformKey,
+		PlatformCert:     platformCert,
+		NotifyClient:     http.DefaultClient,
+		transactions:     map[string]*transaction{},
+		refunds:          map[string]map[string]any{},
+		batches:          map[string]*transferBatch{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v3/pay/transactions/h5", s.handlePrepay("MWEB"))
+	mux.HandleFunc("POST /v3/pay/transactions/app", s.handlePrepay("APP"))
+	mux.HandleFunc("POST /v3/pay/transactions/native", s.handlePrepay("NATIVE"))
+	mux.HandleFunc("GET /v3/pay/transactions/out-trade-no/{no}", s.handleQuery)
+	mux.HandleFunc("GET /v3/pay/transactions/id/{id}", s.handleQuery)
+	mux.HandleFunc("POST /v3/pay/transactions/out-trade-no/{no}/close", s.handleClose)
+	mux.HandleFunc("POST /v3/refund/domestic/refunds", s.handleRefund)
+	mux.HandleFunc("GET /v3/refund/domestic/refunds/{no}", s.handleRefundQuery)
+	mux.HandleFunc("GET /v3/certificates", s.handleCertificates)
+	mux.HandleFunc("POST /v3/transfer/batches", s.handleTransferBatch)
+	mux.HandleFunc("GET /v3/transfer/batches/out-batch-no/{no}", s.handleTransferBatchQuery)
+	mux.HandleFunc("GET /v3/transfer/batches/out-batch-no/{no}/details/out-detail-no/{detail}", s.handleTransferDetailQuery)
+
+	s.Server = httptest.NewServer(s.authenticate(mux))
+	return s, nil
+}
+
+// NewPlatformCertificate generates a self-signed platform certificate valid
+// from now until notAfter.
+func NewPlatformCertificate(notAfter time.Time) (*rsa.PrivateKey, *x509.Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wechatpaytest: generate platform key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("wechatpaytest: generate platform serial: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "Tenpay.com Root CA", Organization: []string{"Tenpay.com"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wechatpaytest: create platform certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wechatpaytest: parse platform certificate: %w", err)
+	}
+
+	return key, cert, nil
+}
+
+// RotatePlatformCertificate issues a new platform certificate and signs
+// with it from now on. The old certificate is still listed by
+// /v3/certificates, as WeChat Pay does during a rotation.
+func (s *Server) RotatePlatformCertificate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, cert, err := NewPlatformCertificate(s.PlatformCert.NotAfter.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+
+	s.retired = append(s.retired, s.PlatformCert)
+	s.PlatformKey = key
+	s.PlatformCert = cert
+	s.PlatformSerialNo = utils.GetCertificateSerialNumber(*cert)
+	return nil
+}
+
+// Close shuts the server down and waits for the refund notifications it
+// still has in flight.
+func (s *Server) Close() {
+	s.Server.Close()
+	s.notifications.Wait()
+}
+
+// Client returns an HTTP client that sends API_HOST and API_BACKUP_HOST
+// traffic to the mock server. Requests to any other host go out unchanged.
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{Transport: &rewriteTransport{target: target}}
+}
+
+// ClientOptions returns the options for a core.Client talking to the mock.
+// Platform certificates are downloaded from the mock's /v3/certificates.
+func (s *Server) ClientOptions(ctx context.Context) ([]core.ClientOption, error) {
+	bootstrap, err := core.NewClient(ctx,
+		option.WithMerchantCredential(s.MchID, s.MerchantSerialNo, s.MerchantKey),
+		option.WithoutValidator(),
+		option.WithHTTPClient(s.Client()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := downloader.NewCertificateDownloaderMgr(ctx)
+	if err := mgr.RegisterDownloaderWithClient(ctx, bootstrap, s.MchID, s.APIv3Key); err != nil {
+		return nil, err
+	}
+
+	return []core.ClientOption{
+		option.WithWechatPayAutoAuthCipherUsingDownloaderMgr(s.MchID, s.MerchantSerialNo, s.MerchantKey, mgr),
+		option.WithHTTPClient(s.Client()),
+	}, nil
+}
+
+// Pay marks an order as paid and fires TRANSACTION.SUCCESS at its notify_url.
+func (s *Server) Pay(ctx context.Context, outTradeNo string) error {
+	s.mu.Lock()
+	tx, ok := s.transactions[outTradeNo]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("wechatpaytest: order %s not found", outTradeNo)
+	}
+	tx.TradeState = TRADE_STATE_SUCCESS
+	tx.SuccessTime = time.Now().Format(time.RFC3339)
+	snapshot := *tx
+	s.mu.Unlock()
+
+	if snapshot.NotifyURL == "" {
+		return nil
+	}
+	return s.Notify(ctx, snapshot.NotifyURL, EVENT_TYPE_TRANSACTION_SUCCESS, "transaction", snapshot)
+}
+
+// Notify encrypts resource with the API v3 key, signs the envelope with the
+// platform key and posts it to notifyURL.
+func (s *Server) Notify(ctx context.Context, notifyURL, eventType, originalType string, resource any) error {
+	plaintext, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+
+	nonce := randomString(12)
+	ciphertext, err := s.seal(plaintext, originalType, nonce)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"id":            randomString(32),
+		"create_time":   time.Now().Format(time.RFC3339),
+		"resource_type": "encrypt-resource",
+		"event_type":    eventType,
+		"summary":       "mock notification",
+		"resource": map[string]string{
+			"original_type":   originalType,
+			"algorithm":       AEAD_ALGORITHM,
+			"ciphertext":      ciphertext,
+			"associated_data": originalType,
+			"nonce":           nonce,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifyURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := s.signHeader(req.Header, body); err != nil {
+		return err
+	}
+
+	resp, err := s.NotifyClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("wechatpaytest: send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("wechatpaytest: notification rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "PARAM_ERROR", err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err := s.verifyAuthorization(r, body); err != nil {
+			s.writeError(w, http.StatusUnauthorized, "SIGN_ERROR", err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) verifyAuthorization(r *http.Request, body []byte) error {
+	schema, params, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || schema != AUTHORIZATION_SCHEMA {
+		return errors.New("invalid authorization schema")
+	}
+
+	fields := map[string]string{}
+	for _, item := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return fmt.Errorf("malformed authorization field %q", item)
+		}
+		fields[key] = strings.Trim(value, `"`)
+	}
+
+	if fields["mchid"] != s.MchID {
+		return fmt.Errorf("unknown mchid %q", fields["mchid"])
+	}
+	if fields["serial_no"] != s.MerchantSerialNo {
+		return fmt.Errorf("unknown serial_no %q", fields["serial_no"])
+	}
+
+	timestamp, err := strconv.ParseInt(fields["timestamp"], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", fields["timestamp"])
+	}
+	if d := time.Since(time.Unix(timestamp, 0)); d > 5*time.Minute || d < -5*time.Minute {
+		return errors.New("timestamp expired")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(fields["signature"])
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+
+	message := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n", r.Method, r.URL.RequestURI(), fields["timestamp"], fields["nonce_str"], body)
+	hashed := sha256.Sum256([]byte(message))
+	if err := rsa.VerifyPKCS1v15(&s.MerchantKey.PublicKey, crypto.SHA256, hashed[:], signature); err != nil {
+		return errors.New("signature verification failed")
+	}
+
+	return nil
+}
+
+func (s *Server) handlePrepay(tradeType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tx := new(transaction)
+		if err := json.NewDecoder(r.Body).Decode(tx); err != nil {
+			s.writeError(w, http.StatusBadRequest, "PARAM_ERROR", err.Error())
+			return
+		}
+		if tx.OutTradeNo == "" || tx.Amount.Total <= 0 {
+			s.writeError(w, http.StatusBadRequest, "PARAM_ERROR", "out_trade_no and amount.total are required")
+			return
+		}
+		if tx.MchID != s.MchID {
+			s.writeError(w, http.StatusBadRequest, "MCH_NOT_EXISTS", "mchid mismatch")
+			return
+		}
+		if tx.Amount.Currency == "" {
+			tx.Amount.Currency = "CNY"
+		}
+
+		s.mu.Lock()
+		if _, ok := s.transactions[tx.OutTradeNo]; ok {
+			s.mu.Unlock()
+			s.writeError(w, http.StatusBadRequest, "OUT_TRADE_NO_USED", "out_trade_no already used")
+			return
+		}
+		s.sequence++
+		tx.TransactionID = fmt.Sprintf("42000000%012d", s.sequence)
+		tx.TradeType = tradeType
+		tx.TradeState = TRADE_STATE_NOTPAY
+		s.transactions[tx.OutTradeNo] = tx
+		prepayID := fmt.Sprintf("wx%s%010d", time.Now().Format("20060102150405"), s.sequence)
+		s.mu.Unlock()
+
+		switch tradeType {
+		case "MWEB":
+			s.writeJSON(w, http.StatusOK, map[string]string{"h5_url": "https://wx.tenpay.com/cgi-bin/mmpayweb-bin/checkmweb?prepay_id=" + prepayID})
+		case "APP":
+			s.writeJSON(w, http.StatusOK, map[string]string{"prepay_id": prepayID})
+		case "NATIVE":
+			s.writeJSON(w, http.StatusOK, map[string]string{"code_url": "weixin://wxpay/bizpayurl?pr=" + prepayID})
+		}
+	}
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	tx := s.lookup(r.PathValue("no"), r.PathValue("id"))
+	if tx == nil {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusNotFound, "ORDER_NOT_EXIST", "order not exist")
+		return
+	}
+	snapshot := *tx
+	s.mu.Unlock()
+
+	s.writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (s *Server) handleClose(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	tx := s.lookup(r.PathValue("no"), "")
+	if tx == nil {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusNotFound, "ORDER_NOT_EXIST", "order not exist")
+		return
+	}
+	if tx.TradeState == TRADE_STATE_SUCCESS {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusBadRequest, "ORDERPAID", "order paid")
+		return
+	}
+	tx.TradeState = "CLOSED"
+	s.mu.Unlock()
+
+	s.writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *Server) handleRefund(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TransactionID string `json:"transaction_id"`
+		OutTradeNo    string `json:"out_trade_no"`
+		OutRefundNo   string `json:"out_refund_no"`
+		NotifyURL     string `json:"notify_url"`
+		Amount        struct {
+			Refund   int64  `json:"refund"`
+			Total    int64  `json:"total"`
+			Currency string `json:"currency"`
+		} `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "PARAM_ERROR", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	tx := s.lookup(req.OutTradeNo, req.TransactionID)
+	if tx == nil || tx.TradeState != TRADE_STATE_SUCCESS {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusBadRequest, "RESOURCE_NOT_EXISTS", "order not paid")
+		return
+	}
+	if req.Amount.Refund <= 0 || req.Amount.Refund > tx.Amount.Total || req.Amount.Total != tx.Amount.Total {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "invalid refund amount")
+		return
+	}
+	if refund, ok := s.refunds[req.OutRefundNo]; ok {
+		s.mu.Unlock()
+		s.writeJSON(w, http.StatusOK, refund)
+		return
+	}
+
+	s.sequence++
+	now := time.Now().Format(time.RFC3339)
+	refund := map[string]any{
+		"refund_id":             fmt.Sprintf("50000000%012d", s.sequence),
+		"out_refund_no":         req.OutRefundNo,
+		"transaction_id":        tx.TransactionID,
+		"out_trade_no":          tx.OutTradeNo,
+		"channel":               "ORIGINAL",
+		"user_received_account": "支付用户零钱",
+		"success_time":          now,
+		"create_time":           now,
+		"status":                "SUCCESS",
+		"funds_account":         "AVAILABLE",
+		"amount": map[string]any{
+			"total":             tx.Amount.Total,
+			"refund":            req.Amount.Refund,
+			"payer_total":       tx.Amount.Total,
+			"payer_refund":      req.Amount.Refund,
+			"settlement_refund": req.Amount.Refund,
+			"settlement_total":  tx.Amount.Total,
+			"discount_refund":   0,
+			"currency":          tx.Amount.Currency,
+		},
+	}
+	s.refunds[req.OutRefundNo] = refund
+	if req.Amount.Refund == tx.Amount.Total {
+		tx.TradeState = TRADE_STATE_REFUND
+	}
+	s.mu.Unlock()
+
+	s.writeJSON(w, http.StatusOK, refund)
+
+	if req.NotifyURL != "" {
+		s.notifications.Add(1)
+		go func() {
+			defer s.notifications.Done()
+			_ = s.Notify(context.Background(), req.NotifyURL, EVENT_TYPE_REFUND_SUCCESS, "refund", refund)
+		}()
+	}
+}
+
+func (s *Server) handleRefundQuery(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	refund, ok := s.refunds[r.PathValue("no")]
+	s.mu.Unlock()
+
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "RESOURCE_NOT_EXISTS", "refund not exist")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, refund)
+}
+
+func (s *Server) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	certificates := append([]*x509.Certificate{s.PlatformCert}, s.retired...)
+	s.mu.Unlock()
+
+	data := make([]map[string]any, 0, len(certificates))
+	for _, cert := range certificates {
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+
+		nonce := randomString(12)
+		ciphertext, err := s.seal(certPEM, "certificate", nonce)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "SYSTEM_ERROR", err.Error())
+			return
+		}
+
+		data = append(data, map[string]any{
+			"serial_no":      utils.GetCertificateSerialNumber(*cert),
+			"effective_time": cert.NotBefore.Format(time.RFC3339),
+			"expire_time":    cert.NotAfter.Format(time.RFC3339),
+			"encrypt_certificate": map[string]string{
+				"algorithm":       AEAD_ALGORITHM,
+				"nonce":           nonce,
+				"associated_data": "certificate",
+				"ciphertext":      ciphertext,
+			},
+		})
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{"data": data})
+}
+
+// lookup must be called with s.mu held.
+func (s *Server) lookup(outTradeNo, transactionID string) *transaction {
+	if tx, ok := s.transactions[outTradeNo]; ok {
+		return tx
+	}
+	for _, tx := range s.transactions {
+		if transactionID != "" && tx.TransactionID == transactionID {
+			return tx
+		}
+	}
+	return nil
+}
+
+func (s *Server) seal(plaintext []byte, associatedData, nonce string) (string, error) {
+	block, err := aes.NewCipher([]byte(s.APIv3Key))
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nil, []byte(nonce), plaintext, []byte(associatedData))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *Server) signHeader(header http.Header, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randomString(32)
+
+	s.mu.Lock()
+	key, serial := s.PlatformKey, s.PlatformSerialNo
+	if s.PublicKeyID != "" {
+		serial = s.PublicKeyID
+	}
+	s.mu.Unlock()
+
+	signature, err := utils.SignSHA256WithRSA(fmt.Sprintf("%s\n%s\n%s\n", timestamp, nonce, body), key)
+	if err != nil {
+		return err
+	}
+
+	header.Set("Wechatpay-Timestamp", timestamp)
+	header.Set("Wechatpay-Nonce", nonce)
+	header.Set("Wechatpay-Serial", serial)
+	header.Set("Wechatpay-Signature", signature)
+	header.Set("Request-Id", randomString(16))
+	return nil
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	var body []byte
+	if v != nil {
+		var err error
+		if body, err = json.Marshal(v); err != nil {
+			status, body = http.StatusInternalServerError, []byte(`{"code":"SYSTEM_ERROR"}`)
+		}
+	}
+
+	if err := s.signHeader(w.Header(), body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(body) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, code, message string) {
+	s.writeJSON(w, status, map[string]string{"code": code, "message": message})
+}
+
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if host := req.URL.Hostname(); host == API_HOST || host == API_BACKUP_HOST {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = t.target.Scheme
+		req.URL.Host = t.target.Host
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func randomString(n int) string {
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	for i := range buf {
+		buf[i] = letters[int(buf[i])%len(letters)]
+	}
+	return string(buf)
+}
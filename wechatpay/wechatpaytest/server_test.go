@@ -0,0 +1,218 @@
+package wechatpaytest
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wechatpay-apiv3/wechatpay-go/core"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/auth/verifiers"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/notify"
+	"github.com/wechatpay-apiv3/wechatpay-go/core/option"
+	"github.com/wechatpay-apiv3/wechatpay-go/services/payments"
+	"github.com/wechatpay-apiv3/wechatpay-go/services/payments/native"
+	"github.com/wechatpay-apiv3/wechatpay-go/services/refunddomestic"
+)
+
+func newTestClient(t *testing.T) (*Server, *core.Client) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	server, err := NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start mock server: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	opts, err := server.ClientOptions(ctx)
+	if err != nil {
+		t.Fatalf("Failed to build client options: %v", err)
+	}
+
+	client, err := core.NewClient(ctx, opts...)
+	if err != nil {
+		t.Fatalf("Failed to new wechat pay client: %v", err)
+	}
+
+	return server, client
+}
+
+func TestServerPrepayPayRefund(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestClient(t)
+
+	notifications := make(chan *payments.Transaction, 1)
+	handler := notify.NewNotifyHandler(server.APIv3Key, verifiers.NewSHA256WithRSAVerifier(core.NewCertificateMapWithList(
+		[]*x509.Certificate{server.PlatformCert},
+	)))
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx := new(payments.Transaction)
+		if _, err := handler.ParseNotifyRequest(r.Context(), r, tx); err != nil {
+			t.Errorf("Failed to parse notification: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		notifications <- tx
+	}))
+	defer callback.Close()
+
+	svc := native.NativeApiService{Client: client}
+	resp, _, err := svc.Prepay(ctx, native.PrepayRequest{
+		Appid:       core.String(server.AppID),
+		Mchid:       core.String(server.MchID),
+		Description: core.String("TEST"),
+		OutTradeNo:  core.String("001"),
+		NotifyUrl:   core.String(callback.URL),
+		Amount:      &native.Amount{Total: core.Int64(100)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create native prepay order: %v", err)
+	}
+	if !strings.HasPrefix(*resp.CodeUrl, "weixin://") {
+		t.Errorf("unexpected code_url %q", *resp.CodeUrl)
+	}
+
+	if err := server.Pay(ctx, "001"); err != nil {
+		t.Fatalf("Failed to pay order: %v", err)
+	}
+
+	tx := <-notifications
+	if *tx.TradeState != TRADE_STATE_SUCCESS || *tx.OutTradeNo != "001" {
+		t.Errorf("unexpected notification: %v", tx)
+	}
+
+	queried, _, err := svc.QueryOrderByOutTradeNo(ctx, native.QueryOrderByOutTradeNoRequest{
+		OutTradeNo: core.String("001"),
+		Mchid:      core.String(server.MchID),
+	})
+	if err != nil {
+		t.Fatalf("Failed to query order: %v", err)
+	}
+	if *queried.TradeState != TRADE_STATE_SUCCESS {
+		t.Errorf("got trade_state %s, want SUCCESS", *queried.TradeState)
+	}
+
+	refunds := refunddomestic.RefundsApiService{Client: client}
+	refund, _, err := refunds.Create(ctx, refunddomestic.CreateRequest{
+		OutTradeNo:  core.String("001"),
+		OutRefundNo: core.String("R001"),
+		Amount: &refunddomestic.AmountReq{
+			Refund:   core.Int64(100),
+			Total:    core.Int64(100),
+			Currency: core.String("CNY"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create refund: %v", err)
+	}
+	if *refund.Status != refunddomestic.STATUS_SUCCESS {
+		t.Errorf("got refund status %s, want SUCCESS", *refund.Status)
+	}
+}
+
+func TestServerRejectsBadSignature(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newTestClient(t)
+
+	other, err := NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start mock server: %v", err)
+	}
+	defer other.Close()
+
+	// Signed with a different merchant key than the one the server expects.
+	client, err := core.NewClient(ctx,
+		option.WithMerchantCredential(server.MchID, server.MerchantSerialNo, other.MerchantKey),
+		option.WithoutValidator(),
+		option.WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to new wechat pay client: %v", err)
+	}
+
+	svc := native.NativeApiService{Client: client}
+	_, _, err = svc.Prepay(ctx, native.PrepayRequest{
+		Appid:       core.String(server.AppID),
+		Mchid:       core.String(server.MchID),
+		Description: core.String("TEST"),
+		OutTradeNo:  core.String("002"),
+		NotifyUrl:   core.String("https://example.com/notify"),
+		Amount:      &native.Amount{Total: core.Int64(1)},
+	})
+	if !core.IsAPIError(err, "SIGN_ERROR") {
+		t.Fatalf("got %v, want SIGN_ERROR", err)
+	}
+}
+
+func TestServerClientRewritesOnlyWechatPay(t *testing.T) {
+	server, _ := newTestClient(t)
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "other")
+	}))
+	defer other.Close()
+
+	resp, err := server.Client().Get(other.URL)
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "other" {
+		t.Errorf("got %q, want the request left on its own host", body)
+	}
+}
+
+func TestServerCloseWaitsForNotifications(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestClient(t)
+
+	var delivered atomic.Int32
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		delivered.Add(1)
+	}))
+	defer callback.Close()
+
+	svc := native.NativeApiService{Client: client}
+	if _, _, err := svc.Prepay(ctx, native.PrepayRequest{
+		Appid:       core.String(server.AppID),
+		Mchid:       core.String(server.MchID),
+		Description: core.String("TEST"),
+		OutTradeNo:  core.String("003"),
+		NotifyUrl:   core.String(callback.URL),
+		Amount:      &native.Amount{Total: core.Int64(100)},
+	}); err != nil {
+		t.Fatalf("Failed to create native prepay order: %v", err)
+	}
+	if err := server.Pay(ctx, "003"); err != nil {
+		t.Fatalf("Failed to pay order: %v", err)
+	}
+
+	refunds := refunddomestic.RefundsApiService{Client: client}
+	if _, _, err := refunds.Create(ctx, refunddomestic.CreateRequest{
+		OutTradeNo:  core.String("003"),
+		OutRefundNo: core.String("R003"),
+		NotifyUrl:   core.String(callback.URL),
+		Amount: &refunddomestic.AmountReq{
+			Refund:   core.Int64(100),
+			Total:    core.Int64(100),
+			Currency: core.String("CNY"),
+		},
+	}); err != nil {
+		t.Fatalf("Failed to create refund: %v", err)
+	}
+
+	server.Close()
+	if got := delivered.Load(); got != 2 {
+		t.Errorf("got %d notifications delivered after Close, want 2", got)
+	}
+}
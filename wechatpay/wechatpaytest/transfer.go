@@ -0,0 +1,246 @@
+package wechatpaytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/wechatpay-apiv3/wechatpay-go/utils"
+)
+
+type transferBatch struct {
+	MchID       string           `json:"mchid"`
+	AppID       string           `json:"appid"`
+	OutBatchNo  string           `json:"out_batch_no"`
+	BatchID     string           `json:"batch_id"`
+	BatchName   string           `json:"batch_name"`
+	BatchRemark string           `json:"batch_remark"`
+	BatchStatus string           `json:"batch_status"`
+	BatchType   string           `json:"batch_type"`
+	TotalAmount int64            `json:"total_amount"`
+	TotalNum    int64            `json:"total_num"`
+	NotifyURL   string           `json:"notify_url,omitempty"`
+	CreateTime  string           `json:"create_time"`
+	UpdateTime  string           `json:"update_time"`
+	Details     []transferDetail `json:"transfer_detail_list"`
+}
+
+type transferDetail struct {
+	OutDetailNo    string `json:"out_detail_no"`
+	DetailID       string `json:"detail_id"`
+	DetailStatus   string `json:"detail_status"`
+	TransferAmount int64  `json:"transfer_amount"`
+	TransferRemark string `json:"transfer_remark"`
+	OpenID         string `json:"openid"`
+	UserName       string `json:"user_name,omitempty"`
+	FailReason     string `json:"fail_reason,omitempty"`
+}
+
+// TransferUserName returns the decrypted user_name of a transfer detail, so
+// tests can check that the client encrypted it for the platform key.
+func (s *Server) TransferUserName(outBatchNo, outDetailNo string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch, ok := s.batches[outBatchNo]
+	if !ok {
+		return "", false
+	}
+	for _, d := range batch.Details {
+		if d.OutDetailNo == outDetailNo {
+			return d.UserName, true
+		}
+	}
+	return "", false
+}
+
+// FinishTransferBatch settles a batch: the details listed in failed fail
+// with ACCOUNT_FROZEN, the others succeed. MCHTRANSFER.BATCH.FINISHED is
+// fired at the batch notify_url when one was given.
+func (s *Server) FinishTransferBatch(ctx context.Context, outBatchNo string, failed ...string) error {
+	s.mu.Lock()
+	batch, ok := s.batches[outBatchNo]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("wechatpaytest: transfer batch %s not found", outBatchNo)
+	}
+
+	var successNum, successAmount, failNum, failAmount int64
+	for i := range batch.Details {
+		d := &batch.Details[i]
+		if slices.Contains(failed, d.OutDetailNo) {
+			d.DetailStatus, d.FailReason = "FAIL", "ACCOUNT_FROZEN"
+			failNum, failAmount = failNum+1, failAmount+d.TransferAmount
+			continue
+		}
+		d.DetailStatus = "SUCCESS"
+		successNum, successAmount = successNum+1, successAmount+d.TransferAmount
+	}
+	batch.BatchStatus = "FINISHED"
+	batch.UpdateTime = time.Now().Format(time.RFC3339)
+	notifyURL := batch.NotifyURL
+
+	resource := map[string]any{
+		"mchid":          batch.MchID,
+		"out_batch_no":   batch.OutBatchNo,
+		"batch_id":       batch.BatchID,
+		"batch_status":   batch.BatchStatus,
+		"total_num":      batch.TotalNum,
+		"total_amount":   batch.TotalAmount,
+		"success_amount": successAmount,
+		"success_num":    successNum,
+		"fail_amount":    failAmount,
+		"fail_num":       failNum,
+		"update_time":    batch.UpdateTime,
+	}
+	s.mu.Unlock()
+
+	if notifyURL == "" {
+		return nil
+	}
+	return s.Notify(ctx, notifyURL, EVENT_TYPE_TRANSFER_BATCH_FINISHED, "mch_payment", resource)
+}
+
+func (s *Server) handleTransferBatch(w http.ResponseWriter, r *http.Request) {
+	batch := new(transferBatch)
+	if err := json.NewDecoder(r.Body).Decode(batch); err != nil {
+		s.writeError(w, http.StatusBadRequest, "PARAM_ERROR", err.Error())
+		return
+	}
+
+	var total int64
+	for i := range batch.Details {
+		d := &batch.Details[i]
+		total += d.TransferAmount
+
+		if d.UserName == "" {
+			continue
+		}
+
+		s.mu.Lock()
+		serial, key := s.PlatformSerialNo, s.PlatformKey
+		if s.PublicKeyID != "" {
+			serial = s.PublicKeyID
+		}
+		s.mu.Unlock()
+
+		if r.Header.Get("Wechatpay-Serial") != serial {
+			s.writeError(w, http.StatusBadRequest, "PARAM_ERROR", "Wechatpay-Serial does not match the encryption key")
+			return
+		}
+
+		name, err := utils.DecryptOAEP(d.UserName, key)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "PARAM_ERROR", "user_name is not encrypted with the platform key")
+			return
+		}
+		d.UserName = name
+	}
+
+	if total != batch.TotalAmount || int64(len(batch.Details)) != batch.TotalNum {
+		s.writeError(w, http.StatusBadRequest, "PARAM_ERROR", "total_amount or total_num mismatch")
+		return
+	}
+
+	s.mu.Lock()
+	if _, ok := s.batches[batch.OutBatchNo]; ok {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "out_batch_no already exists")
+		return
+	}
+	s.sequence++
+	now := time.Now().Format(time.RFC3339)
+	batch.MchID = s.MchID
+	batch.BatchID = fmt.Sprintf("1030000071100999991182020050700019%04d", s.sequence)
+	batch.BatchStatus = "ACCEPTED"
+	batch.BatchType = "API"
+	batch.CreateTime, batch.UpdateTime = now, now
+	for i := range batch.Details {
+		batch.Details[i].DetailID = fmt.Sprintf("%s%04d", batch.BatchID, i)
+		batch.Details[i].DetailStatus = "INIT"
+	}
+	s.batches[batch.OutBatchNo] = batch
+	s.mu.Unlock()
+
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"out_batch_no": batch.OutBatchNo,
+		"batch_id":     batch.BatchID,
+		"create_time":  batch.CreateTime,
+		"batch_status": batch.BatchStatus,
+	})
+}
+
+func (s *Server) handleTransferBatchQuery(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	batch, ok := s.batches[r.PathValue("no")]
+	if !ok {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusNotFound, "NOT_FOUND", "transfer batch not found")
+		return
+	}
+
+	resp := map[string]any{"transfer_batch": batch}
+	if r.URL.Query().Get("need_query_detail") == "true" {
+		details := make([]map[string]string, 0, len(batch.Details))
+		for _, d := range batch.Details {
+			details = append(details, map[string]string{
+				"detail_id":     d.DetailID,
+				"out_detail_no": d.OutDetailNo,
+				"detail_status": d.DetailStatus,
+			})
+		}
+		resp["transfer_detail_list"] = details
+	}
+	body, err := json.Marshal(resp)
+	s.mu.Unlock()
+
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "SYSTEM_ERROR", err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, json.RawMessage(body))
+}
+
+func (s *Server) handleTransferDetailQuery(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	batch, ok := s.batches[r.PathValue("no")]
+	if !ok {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusNotFound, "NOT_FOUND", "transfer batch not found")
+		return
+	}
+
+	var resp map[string]any
+	for _, d := range batch.Details {
+		if d.OutDetailNo != r.PathValue("detail") {
+			continue
+		}
+		resp = map[string]any{
+			"mchid":           batch.MchID,
+			"out_batch_no":    batch.OutBatchNo,
+			"batch_id":        batch.BatchID,
+			"appid":           batch.AppID,
+			"out_detail_no":   d.OutDetailNo,
+			"detail_id":       d.DetailID,
+			"detail_status":   d.DetailStatus,
+			"transfer_amount": d.TransferAmount,
+			"transfer_remark": d.TransferRemark,
+			"openid":          d.OpenID,
+			"initiate_time":   batch.CreateTime,
+			"update_time":     batch.UpdateTime,
+		}
+		if d.FailReason != "" {
+			resp["fail_reason"] = d.FailReason
+		}
+	}
+	s.mu.Unlock()
+
+	if resp == nil {
+		s.writeError(w, http.StatusNotFound, "NOT_FOUND", "transfer detail not found")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}